@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -28,6 +29,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create collector: %v", err)
 	}
+	defer gpuCollector.Close()
 
 	promMetrics := metrics.New()
 
@@ -39,6 +41,7 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/topology", handleTopology(gpuCollector))
 	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
 	server := &http.Server{
@@ -52,17 +55,72 @@ func main() {
 
 		for {
 			gpuMetrics, err := gpuCollector.CollectGPUMetrics()
-			if err != nil {
+			if err != nil && gpuMetrics == nil {
 				log.Printf("Failed to collect GPU metrics: %v", err)
 			} else {
+				if err != nil {
+					log.Printf("Some GPU metrics could not be collected: %v", err)
+				}
 				promMetrics.UpdateGPU(gpuMetrics)
 				log.Printf("GPU metrics updated: %d items", len(gpuMetrics))
 			}
 
-			processes, err := gpuCollector.CollectProcesses()
+			migDevices, err := gpuCollector.CollectMIGDevices()
+			if err != nil && migDevices == nil {
+				log.Printf("Failed to collect MIG devices: %v", err)
+			} else {
+				if err != nil {
+					log.Printf("Some MIG device information could not be collected: %v", err)
+				}
+				promMetrics.UpdateMIGDevices(migDevices)
+			}
+
+			vgpus, err := gpuCollector.CollectVGPUs()
+			if err != nil && vgpus == nil {
+				log.Printf("Failed to collect vGPUs: %v", err)
+			} else {
+				if err != nil {
+					log.Printf("Some vGPU information could not be collected: %v", err)
+				}
+				promMetrics.UpdateVGPUs(vgpus)
+			}
+
+			nvlinks, err := gpuCollector.CollectNVLinks()
+			if err != nil && nvlinks == nil {
+				log.Printf("Failed to collect NVLinks: %v", err)
+			} else {
+				if err != nil {
+					log.Printf("Some NVLink counters could not be collected: %v", err)
+				}
+				promMetrics.UpdateNVLinks(nvlinks)
+			}
+
+			topology, err := gpuCollector.CollectTopology()
 			if err != nil {
+				log.Printf("Failed to collect GPU topology: %v", err)
+			} else {
+				promMetrics.UpdateTopology(topology)
+			}
+
+			accounting, err := gpuCollector.CollectAccountingStats()
+			if err != nil && accounting == nil {
+				log.Printf("Failed to collect accounting statistics: %v", err)
+			} else {
+				if err != nil {
+					log.Printf("Some accounted processes could not be read: %v", err)
+				}
+				promMetrics.UpdateAccountingStats(accounting)
+			}
+
+			promMetrics.UpdateXIDErrors(gpuCollector.CollectXIDErrors())
+
+			processes, err := gpuCollector.CollectProcesses()
+			if err != nil && len(processes) == 0 {
 				log.Printf("Failed to collect process information: %v", err)
 			} else {
+				if err != nil {
+					log.Printf("Some process information could not be collected: %v", err)
+				}
 				promMetrics.UpdateProcesses(processes)
 				if len(processes) == 0 {
 					log.Printf("Process information updated: no GPU processes running")
@@ -109,3 +167,24 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, `{"status":"ok","timestamp":"`+time.Now().Format(time.RFC3339)+`"}`)
 }
+
+// handleTopology serves the GPU topology as last collected.
+func handleTopology(gpuCollector *collector.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		topology := gpuCollector.Topology()
+		if topology == nil {
+			http.Error(w, "GPU topology not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(topology); err != nil {
+			log.Printf("Failed to write GPU topology: %v", err)
+		}
+	}
+}
@@ -2,14 +2,18 @@ module github.com/nvidia-gpu-list-exporter
 
 go 1.22
 
-require github.com/prometheus/client_golang v1.17.0
+require (
+	github.com/ebitengine/purego v0.8.4
+	github.com/prometheus/client_golang v1.17.0
+	github.com/prometheus/common v0.45.0
+)
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
 	github.com/prometheus/client_model v0.5.0 // indirect
-	github.com/prometheus/common v0.45.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
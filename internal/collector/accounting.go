@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// accountedAppQueryFields are the --query-accounted-apps fields read by AccountedApps.
+var accountedAppQueryFields = []string{
+	"gpu_uuid",
+	"pid",
+	"gpu_utilization",
+	"mem_utilization",
+	"max_memory_usage",
+	"time",
+	"is_running",
+}
+
+// AccountedApps reads the driver's accounting buffers with
+// --query-accounted-apps. It returns nothing unless accounting mode was
+// enabled on a GPU when GPUs last ran. Rows that cannot be parsed are
+// skipped and reported in the returned error.
+func (s *nvidiaSmiSource) AccountedApps(ctx context.Context) ([]AccountedApp, error) {
+	s.mu.Lock()
+	accountingEnabled := s.accountingEnabled
+	s.mu.Unlock()
+
+	if !accountingEnabled {
+		return nil, nil
+	}
+
+	table, err := s.query(ctx, "query-accounted-apps", accountedAppQueryFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAccountedApps(table)
+}
+
+func parseAccountedApps(table *queryTable) ([]AccountedApp, error) {
+	apps := make([]AccountedApp, 0, table.len())
+	var errs []error
+
+	for i := 0; i < table.len(); i++ {
+		row := table.row(i)
+
+		// nvidia-smi reports the run time in milliseconds
+		elapsed := time.Duration(row.Float("time") * float64(time.Millisecond))
+
+		app := AccountedApp{
+			GPUUUID:           row.Text("gpu_uuid"),
+			PID:               row.Int("pid"),
+			GPUUtilization:    row.Float("gpu_utilization"),
+			MemoryUtilization: row.Float("mem_utilization"),
+			MaxMemoryUsage:    row.Bytes("max_memory_usage"),
+			Time:              elapsed,
+			Running:           row.Bool("is_running"),
+		}
+		if err := row.Err(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		apps = append(apps, app)
+	}
+
+	return apps, errors.Join(errs...)
+}
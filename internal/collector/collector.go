@@ -1,27 +1,93 @@
-// Package collector provides GPU metrics collection using nvidia-smi.
+// Package collector provides GPU metrics collection from pluggable sources such as nvidia-smi.
 package collector
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"maps"
 	"os"
-	"os/exec"
-	"strconv"
-	"strings"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/nvidia-gpu-list-exporter/pkg/types"
 )
 
-// Collector collects GPU metrics using nvidia-smi.
+// Collector collects GPU metrics from a Source.
 type Collector struct {
 	config   types.CollectorConfig
 	hostname string
+	source   Source
+	proc     procReader
+	xid      *xidWatcher // nil if Xid errors are not monitored
+
+	mu         sync.Mutex
+	devices    map[string]gpuDevice // every GPU seen so far, by PCI location
+	migDevices []types.MIGDevice    // as last collected
+	topology   *types.Topology      // as last collected
+
+	accounting    map[string]*types.AccountingStats // by GPU UUID
+	accountedSeen map[accountedKey]bool             // finished processes in the last accounting buffers read
+	finished      []finishedProcess                 // finished processes counted within finishedProcessRetention
 }
 
-// New creates a new Collector instance.
+// finishedProcessRetention is how long each finished process is reported
+// individually after it was counted, so that scrapes can pick it up without
+// keeping a series for every process that ever ran.
+const finishedProcessRetention = 5 * time.Minute
+
+// finishedProcess is a finished process reported individually until
+// finishedProcessRetention after it was counted.
+type finishedProcess struct {
+	gpuUUID string
+	process types.AccountedProcess
+	counted time.Time
+}
+
+// accountingMemoryBuckets are the bounds in bytes by which finished
+// processes are counted by peak memory usage, from 256 MiB to 128 GiB.
+var accountingMemoryBuckets = []uint64{
+	256 << 20, 512 << 20, 1 << 30, 2 << 30, 4 << 30, 8 << 30,
+	16 << 30, 32 << 30, 64 << 30, 128 << 30,
+}
+
+// accountedKey identifies a finished process in the accounting buffers.
+// PIDs can be reused, so the run time and peak memory are part of it.
+type accountedKey struct {
+	gpuUUID   string
+	pid       int
+	time      time.Duration
+	maxMemory uint64
+}
+
+// gpuDevice identifies a GPU found at a PCI address.
+type gpuDevice struct {
+	id       int
+	uuid     string
+	name     string
+	pciBusID string
+}
+
+// New creates a new Collector instance using the source selected in config.
 func New(config types.CollectorConfig) (*Collector, error) {
+	config = applyDefaults(config)
+
+	source, err := newSource(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithSource(config, source)
+}
+
+// NewWithSource creates a new Collector instance that reads from source.
+func NewWithSource(config types.CollectorConfig, source Source) (*Collector, error) {
+	config = applyDefaults(config)
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hostname: %w", err)
@@ -37,340 +103,444 @@ func New(config types.CollectorConfig) (*Collector, error) {
 		hostname = config.HostnameOverride
 	}
 
-	if config.NvidiaSmiPath == "" {
-		config.NvidiaSmiPath = "nvidia-smi"
-	}
-
-	if config.Timeout == 0 {
-		config.Timeout = 10 * time.Second
-	}
-
 	c := &Collector{
 		config:   config,
 		hostname: hostname,
+		source:   source,
+		proc:     procReader{root: config.ProcfsPath},
+		devices:  make(map[string]gpuDevice),
+
+		accounting:    make(map[string]*types.AccountingStats),
+		accountedSeen: make(map[accountedKey]bool),
 	}
 
-	if err := c.checkAvailability(); err != nil {
-		return nil, fmt.Errorf("nvidia-smi availability check failed: %w", err)
+	if config.KmsgPath != "" {
+		xid, err := newXIDWatcher(config.KmsgPath)
+		if err != nil {
+			log.Printf("Xid error monitoring disabled: %v", err)
+		} else {
+			c.xid = xid
+		}
 	}
 
 	return c, nil
 }
 
-func (c *Collector) checkAvailability() error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
-	defer cancel()
+// Close stops background work started by the Collector and its source.
+func (c *Collector) Close() error {
+	var errs []error
+	if c.xid != nil {
+		errs = append(errs, c.xid.Close())
+	}
+	if closer, ok := c.source.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func applyDefaults(config types.CollectorConfig) types.CollectorConfig {
+	if config.NvidiaSmiPath == "" {
+		config.NvidiaSmiPath = "nvidia-smi"
+	}
 
-	cmd := exec.CommandContext(ctx, c.config.NvidiaSmiPath, "--version")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("nvidia-smi not found or cannot be executed: %w", err)
+	if config.ProcfsPath == "" {
+		config.ProcfsPath = "/proc"
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
 	}
-	return nil
+
+	return config
 }
 
 // CollectGPUMetrics collects current GPU metrics.
+// If only part of the data could be collected, the metrics are still
+// returned with the missing values left zero, together with an error
+// describing what is missing; unparsable fields are reported as *FieldError.
 func (c *Collector) CollectGPUMetrics() ([]types.GPUMetrics, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
 	defer cancel()
 
-	query := "timestamp,index,gpu_name,memory.free,memory.used,memory.total,utilization.gpu,utilization.memory,temperature.gpu"
-	cmd := exec.CommandContext(ctx, c.config.NvidiaSmiPath,
-		"--query-gpu="+query,
-		"--format=csv,noheader")
-
-	output, err := cmd.Output()
-	if err != nil {
+	metrics, err := c.source.GPUs(ctx)
+	if metrics == nil && err != nil {
 		return nil, fmt.Errorf("failed to get GPU metrics: %w", err)
 	}
 
-	return c.parseGPUMetrics(string(output))
-}
-
-func (c *Collector) parseGPUMetrics(output string) ([]types.GPUMetrics, error) {
-	reader := csv.NewReader(strings.NewReader(output))
-	reader.TrimLeadingSpace = true
-
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	for i := range metrics {
+		metrics[i].Hostname = c.hostname
 	}
+	c.rememberDevices(metrics)
 
-	metrics := make([]types.GPUMetrics, 0, len(records))
+	return metrics, err
+}
 
-	for _, record := range records {
-		if len(record) != 9 {
+// rememberDevices records the PCI address of each GPU so that Xid errors
+// can be attributed to it, even after it has fallen off the bus.
+func (c *Collector) rememberDevices(metrics []types.GPUMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, metric := range metrics {
+		address, ok := pciLocation(metric.PCIBusID)
+		if !ok {
 			continue
 		}
-
-		timestampStr := strings.TrimSpace(record[0])
-		timestamp, err := time.Parse("2006/01/02 15:04:05.000", timestampStr)
-		if err != nil {
-			timestamp = time.Now()
+		c.devices[address] = gpuDevice{
+			id:       metric.GPUID,
+			uuid:     metric.UUID,
+			name:     metric.GPUName,
+			pciBusID: metric.PCIBusID,
 		}
+	}
+}
 
-		gpuIndexStr := strings.TrimSpace(record[1])
-		gpuIndex, err := strconv.Atoi(gpuIndexStr)
-		if err != nil {
-			continue
-		}
+// CollectXIDErrors returns the Xid errors logged by the driver since the
+// oldest retained kernel log record, one entry per GPU that reported any.
+// GPUs are identified by the GPU metrics collected so far; errors for a PCI
+// address not seen yet have an empty UUID and a GPU ID of -1.
+// It returns nil if Xid errors are not monitored.
+func (c *Collector) CollectXIDErrors() []types.XIDErrors {
+	if c.xid == nil {
+		return nil
+	}
 
-		gpuName := strings.TrimSpace(record[2])
-		if gpuName == "" {
-			gpuName = "unknown"
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		freeMemory, err := c.parseUint64(record[3])
-		if err != nil {
-			continue
+	snapshot := c.xid.snapshot()
+	xidErrors := make([]types.XIDErrors, 0, len(snapshot))
+	for address, counts := range snapshot {
+		device, ok := c.devices[address]
+		if !ok {
+			device = gpuDevice{id: -1, pciBusID: address}
 		}
 
-		usedMemory, err := c.parseUint64(record[4])
-		if err != nil {
-			continue
-		}
+		xidErrors = append(xidErrors, types.XIDErrors{
+			Hostname: c.hostname,
+			GPUID:    device.id,
+			GPUUUID:  device.uuid,
+			GPUName:  device.name,
+			PCIBusID: device.pciBusID,
+			Counts:   counts.counts,
+			LastXID:  counts.last.xid,
+			LastPID:  counts.last.pid,
+		})
+	}
 
-		totalMemory, err := c.parseUint64(record[5])
-		if err != nil {
-			continue
-		}
+	sort.Slice(xidErrors, func(i, j int) bool { return xidErrors[i].PCIBusID < xidErrors[j].PCIBusID })
+	return xidErrors
+}
 
-		gpuUtil, err := c.parseFloat(record[6])
-		if err != nil {
-			continue
-		}
+// CollectMIGDevices collects the MIG devices of GPUs in MIG mode. It returns
+// nil if the source cannot enumerate MIG devices. As with CollectGPUMetrics,
+// devices may be returned together with an error describing missing details.
+func (c *Collector) CollectMIGDevices() ([]types.MIGDevice, error) {
+	source, ok := c.source.(MIGSource)
+	if !ok {
+		return nil, nil
+	}
 
-		memUtil, err := c.parseFloat(record[7])
-		if err != nil {
-			continue
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
 
-		temperature, err := c.parseFloat(record[8])
-		if err != nil {
-			continue
-		}
+	devices, err := source.MIGDevices(ctx)
+	if devices == nil && err != nil {
+		return nil, fmt.Errorf("failed to get MIG devices: %w", err)
+	}
 
-		metric := types.GPUMetrics{
-			Hostname:          c.hostname,
-			GPUID:             gpuIndex,
-			Timestamp:         timestamp,
-			GPUName:           gpuName,
-			Temperature:       temperature,
-			FreeMemory:        freeMemory,
-			UsedMemory:        usedMemory,
-			TotalMemory:       totalMemory,
-			GPUUtilization:    gpuUtil,
-			MemoryUtilization: memUtil,
-		}
-		metrics = append(metrics, metric)
+	for i := range devices {
+		devices[i].Hostname = c.hostname
 	}
 
-	return metrics, nil
+	c.mu.Lock()
+	c.migDevices = devices
+	c.mu.Unlock()
+
+	return devices, err
 }
 
-func (c *Collector) parseFloat(s string) (float64, error) {
-	s = strings.TrimSpace(s)
-	if s == "" || s == "N/A" || s == "[Not Supported]" {
-		return 0.0, nil
+// CollectNVLinks collects the NVLinks of every GPU. It returns nil if the
+// source cannot read NVLinks. As with CollectGPUMetrics, links may be
+// returned together with an error describing missing counters.
+func (c *Collector) CollectNVLinks() ([]types.NVLink, error) {
+	source, ok := c.source.(NVLinkSource)
+	if !ok {
+		return nil, nil
 	}
 
-	s = strings.ReplaceAll(s, "%", "")
-	s = strings.ReplaceAll(s, "℃", "")
-	s = strings.ReplaceAll(s, "W", "")
-	s = strings.TrimSpace(s)
-
-	return strconv.ParseFloat(s, 64)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
 
-func (c *Collector) parseUint64(s string) (uint64, error) {
-	s = strings.TrimSpace(s)
-	if s == "" || s == "N/A" || s == "[Not Supported]" {
-		return 0, nil
+	links, err := source.NVLinks(ctx)
+	if links == nil && err != nil {
+		return nil, fmt.Errorf("failed to get NVLinks: %w", err)
 	}
 
-	s = strings.ReplaceAll(s, "MiB", "")
-	s = strings.ReplaceAll(s, "GiB", "")
-	s = strings.ReplaceAll(s, "KiB", "")
-	s = strings.ReplaceAll(s, "MB", "")
-	s = strings.ReplaceAll(s, "GB", "")
-	s = strings.ReplaceAll(s, "KB", "")
-	s = strings.TrimSpace(s)
+	for i := range links {
+		links[i].Hostname = c.hostname
+	}
 
-	return strconv.ParseUint(s, 10, 64)
+	return links, err
 }
 
-// CollectProcesses collects GPU process information.
-func (c *Collector) CollectProcesses() ([]types.GPUProcess, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout*2)
+// CollectVGPUs collects the active vGPUs of GPUs hosting vGPUs. It returns
+// nil if the source cannot enumerate vGPUs. As with CollectGPUMetrics,
+// vGPUs may be returned together with an error describing missing details.
+func (c *Collector) CollectVGPUs() ([]types.VGPU, error) {
+	source, ok := c.source.(VGPUSource)
+	if !ok {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
 	defer cancel()
 
-	// GPU UUIDからGPU IDへのマッピングを取得
-	gpuMapping, err := c.getGPUMapping(ctx)
-	if err != nil {
-		return []types.GPUProcess{}, fmt.Errorf("failed to get GPU mapping: %w", err)
+	vgpus, err := source.VGPUs(ctx)
+	if vgpus == nil && err != nil {
+		return nil, fmt.Errorf("failed to get vGPUs: %w", err)
 	}
 
-	// get detailed process information
-	script := `
-	set -euo pipefail
-	
-	# get GPU process information from nvidia-smi
-	nvidia_output=$(nvidia-smi --query-compute-apps=timestamp,gpu_uuid,pid,process_name,used_gpu_memory --format=csv,noheader 2>/dev/null || echo "")
-	
-	if [ -z "$nvidia_output" ]; then
-		exit 0  # if no processes, exit
-	fi
-	
-	echo "$nvidia_output" | while IFS=',' read -r timestamp gpu_uuid pid process_name gpu_memory; do
-		# triming values
-		timestamp=$(echo "$timestamp" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-		gpu_uuid=$(echo "$gpu_uuid" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-		pid=$(echo "$pid" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-		process_name=$(echo "$process_name" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-		gpu_memory=$(echo "$gpu_memory" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-		
-		# check if pid is a number
-		if ! echo "$pid" | grep -q '^[0-9]\+$'; then
-			continue
-		fi
-		
-		# get process detailed information from ps command (ignore errors)
-		if ps_info=$(ps --noheader -o 'user,%mem,%cpu,command' -p "$pid" 2>/dev/null); then
-			# Parse ps output into 4 fields: user %mem %cpu command
-			# Use awk to properly split the ps output
-			user=$(echo "$ps_info" | awk '{print $1}')
-			mem_percent=$(echo "$ps_info" | awk '{print $2}')
-			cpu_percent=$(echo "$ps_info" | awk '{print $3}')
-			# Command is everything from field 4 onwards, joined with spaces
-			command=$(echo "$ps_info" | awk '{for(i=4;i<=NF;i++) printf "%s%s", $i, (i<NF?" ":""); print ""}')
-			
-			# CSV escape: replace commas with dots in command to avoid CSV issues
-			command_escaped=$(echo "$command" | sed 's/,/./g')
-			
-			echo "$timestamp,$gpu_uuid,$pid,$process_name,$gpu_memory,$user,$mem_percent,$cpu_percent,$command_escaped"
-		else
-			# if process not found, use default value
-			echo "$timestamp,$gpu_uuid,$pid,$process_name,$gpu_memory,unknown,0.0,0.0,$process_name"
-		fi
-	done`
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", script)
-
-	output, err := cmd.Output()
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			return []types.GPUProcess{}, fmt.Errorf("process collection script failed with exit code %d: %s", exitError.ExitCode(), string(exitError.Stderr))
-		}
-		return []types.GPUProcess{}, fmt.Errorf("failed to execute process collection script: %w", err)
+	for i := range vgpus {
+		vgpus[i].Hostname = c.hostname
 	}
 
-	return c.parseProcessesWithMapping(string(output), gpuMapping)
+	return vgpus, err
 }
 
-// getGPUMapping gets the mapping from GPU UUID to GPU index.
-func (c *Collector) getGPUMapping(ctx context.Context) (map[string]int, error) {
-	cmd := exec.CommandContext(ctx, c.config.NvidiaSmiPath,
-		"--query-gpu=index,gpu_uuid",
-		"--format=csv,noheader,nounits")
+// CollectAccountingStats adds the processes that finished since the last
+// call, according to the driver's accounting buffers, to the statistics of
+// their GPUs and returns the statistics of every GPU that has had any.
+// Processes stay in the buffers after they finish, so each is recognized
+// and counted only once; the first call counts every finished process
+// already in the buffers, including those that finished before the exporter
+// started. The processes counted within finishedProcessRetention are also
+// returned individually. GPUs are named after the GPU metrics collected so
+// far. It returns nil if the source cannot read accounting statistics.
+// As with CollectGPUMetrics, statistics may be returned together with an
+// error describing processes that could not be read.
+func (c *Collector) CollectAccountingStats() ([]types.AccountingStats, error) {
+	source, ok := c.source.(AccountingSource)
+	if !ok {
+		return nil, nil
+	}
 
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get GPU mapping: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	apps, err := source.AccountedApps(ctx)
+	if apps == nil && err != nil {
+		return nil, fmt.Errorf("failed to get accounted apps: %w", err)
 	}
 
-	mapping := make(map[string]int)
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	for _, line := range lines {
-		if line == "" {
+	now := time.Now()
+	seen := make(map[accountedKey]bool, len(apps))
+	for _, app := range apps {
+		if app.Running {
 			continue
 		}
 
-		parts := strings.Split(line, ",")
-		if len(parts) != 2 {
+		key := accountedKey{gpuUUID: app.GPUUUID, pid: app.PID, time: app.Time, maxMemory: app.MaxMemoryUsage}
+		seen[key] = true
+		if c.accountedSeen[key] {
 			continue
 		}
 
-		indexStr := strings.TrimSpace(parts[0])
-		uuid := strings.TrimSpace(parts[1])
+		stats, ok := c.accounting[app.GPUUUID]
+		if !ok {
+			stats = &types.AccountingStats{GPUUUID: app.GPUUUID, MaxMemoryBuckets: make(map[uint64]uint64, len(accountingMemoryBuckets))}
+			for _, bound := range accountingMemoryBuckets {
+				stats.MaxMemoryBuckets[bound] = 0
+			}
+			c.accounting[app.GPUUUID] = stats
+		}
+		seconds := app.Time.Seconds()
+		stats.Processes++
+		stats.Seconds += seconds
+		stats.GPUBusySeconds += seconds * app.GPUUtilization / 100
+		stats.MemoryBusySeconds += seconds * app.MemoryUtilization / 100
+		stats.MaxMemoryBytes += app.MaxMemoryUsage
+		for _, bound := range accountingMemoryBuckets {
+			if app.MaxMemoryUsage <= bound {
+				stats.MaxMemoryBuckets[bound]++
+			}
+		}
 
-		index, err := strconv.Atoi(indexStr)
-		if err != nil {
-			continue
+		c.finished = append(c.finished, finishedProcess{
+			gpuUUID: app.GPUUUID,
+			process: types.AccountedProcess{
+				PID:               app.PID,
+				Seconds:           seconds,
+				GPUUtilization:    app.GPUUtilization,
+				MemoryUtilization: app.MemoryUtilization,
+				MaxMemoryBytes:    app.MaxMemoryUsage,
+			},
+			counted: now,
+		})
+	}
+
+	if err == nil {
+		// a buffer only drops its oldest processes, which cannot come back
+		c.accountedSeen = seen
+	} else {
+		// processes whose rows could not be read may still be in the buffer
+		for key := range seen {
+			c.accountedSeen[key] = true
 		}
+	}
 
-		mapping[uuid] = index
+	c.finished = slices.DeleteFunc(c.finished, func(f finishedProcess) bool {
+		return now.Sub(f.counted) >= finishedProcessRetention
+	})
+	finished := make(map[string][]types.AccountedProcess)
+	for _, f := range c.finished {
+		finished[f.gpuUUID] = append(finished[f.gpuUUID], f.process)
+	}
+
+	result := make([]types.AccountingStats, 0, len(c.accounting))
+	for _, stats := range c.accounting {
+		gpu := *stats
+		gpu.MaxMemoryBuckets = maps.Clone(stats.MaxMemoryBuckets)
+		gpu.FinishedProcesses = finished[gpu.GPUUUID]
+		gpu.Hostname = c.hostname
+		gpu.GPUID = -1
+		for _, device := range c.devices {
+			if device.uuid == gpu.GPUUUID {
+				gpu.GPUID = device.id
+				gpu.GPUName = device.name
+			}
+		}
+		result = append(result, gpu)
 	}
 
-	return mapping, nil
+	sort.Slice(result, func(i, j int) bool { return result[i].GPUUUID < result[j].GPUUUID })
+	return result, err
 }
 
-// parseProcessesWithMapping parses process output with GPU UUID to ID mapping.
-func (c *Collector) parseProcessesWithMapping(output string, gpuMapping map[string]int) ([]types.GPUProcess, error) {
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if len(lines) == 0 || (len(lines) == 1 && lines[0] == "") {
-		return []types.GPUProcess{}, nil
+// CollectTopology collects how the GPUs connect to each other, to NICs and
+// to CPUs. GPUs are named after the GPU metrics collected so far. It returns
+// nil if the source cannot read the topology.
+func (c *Collector) CollectTopology() (*types.Topology, error) {
+	source, ok := c.source.(TopologySource)
+	if !ok {
+		return nil, nil
 	}
 
-	processes := make([]types.GPUProcess, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
 
-	for lineNum, line := range lines {
-		if line == "" {
-			continue
-		}
+	topology, err := source.Topology(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GPU topology: %w", err)
+	}
+	if topology == nil {
+		return nil, nil
+	}
 
-		fields := strings.Split(line, ",")
-		if len(fields) != 9 {
-			return nil, fmt.Errorf("line %d: invalid field count (%d), expected exactly 9 fields", lineNum+1, len(fields))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	topology.Hostname = c.hostname
+	for i := range topology.GPUs {
+		gpu := &topology.GPUs[i]
+		for _, device := range c.devices {
+			if device.id == gpu.GPUID && gpu.GPUUUID == "" {
+				gpu.GPUUUID = device.uuid
+				gpu.GPUName = device.name
+			}
 		}
+	}
+	c.topology = topology
 
-		timestampStr := strings.TrimSpace(fields[0])
-		timestamp, err := time.Parse("2006/01/02 15:04:05.000", timestampStr)
-		if err != nil {
-			return nil, fmt.Errorf("line %d: failed to parse timestamp '%s': %w", lineNum+1, timestampStr, err)
-		}
+	return topology, nil
+}
 
-		gpuUUID := strings.TrimSpace(fields[1])
-		gpuID, exists := gpuMapping[gpuUUID]
-		if !exists {
-			// フォールバック：UUIDが見つからない場合は0を使用
-			gpuID = 0
-		}
+// Topology returns the topology as last collected, or nil if it has not
+// been collected yet.
+func (c *Collector) Topology() *types.Topology {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.topology
+}
 
-		pidStr := strings.TrimSpace(fields[2])
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			return nil, fmt.Errorf("line %d: failed to parse PID '%s': %w", lineNum+1, pidStr, err)
-		}
+// migDevice finds the MIG device an app runs on among the devices last
+// collected, by its MIG device UUID or by its parent GPU and instance IDs.
+func (c *Collector) migDevice(app ComputeApp) (types.MIGDevice, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		processName := strings.TrimSpace(fields[3])
-		if processName == "" {
-			return nil, fmt.Errorf("line %d: empty process name", lineNum+1)
+	for _, device := range c.migDevices {
+		if device.UUID != "" && device.UUID == app.GPUUUID {
+			return device, true
 		}
+		if device.GPUUUID == app.GPUUUID &&
+			device.GPUInstanceID == app.GPUInstanceID &&
+			device.ComputeInstanceID == app.ComputeInstanceID {
+			return device, true
+		}
+	}
+	return types.MIGDevice{}, false
+}
+
+// CollectProcesses collects GPU process information, including the engine
+// utilization of each process if the source can sample it. Processes on MIG
+// devices are attributed to the devices found by the last CollectMIGDevices.
+// If only part of the data could be collected, the processes are returned
+// together with an error describing what is missing.
+func (c *Collector) CollectProcesses() ([]types.GPUProcess, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout*2)
+	defer cancel()
 
-		usedGPUMemory, err := c.parseUint64(fields[4])
+	// GPU UUIDからGPU IDへのマッピングを取得
+	gpuMapping, err := c.source.GPUMapping(ctx)
+	if err != nil {
+		return []types.GPUProcess{}, fmt.Errorf("failed to get GPU mapping: %w", err)
+	}
+
+	apps, appsErr := c.source.ComputeApps(ctx)
+	if apps == nil && appsErr != nil {
+		return []types.GPUProcess{}, fmt.Errorf("failed to get compute apps: %w", appsErr)
+	}
+	errs := []error{appsErr}
+
+	// sampling takes a while, so it is skipped when nothing runs
+	var utilization map[[2]int]ProcessUtilization
+	if len(apps) > 0 {
+		utilization, err = c.processUtilization(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: failed to parse GPU memory '%s': %w", lineNum+1, fields[4], err)
+			errs = append(errs, fmt.Errorf("failed to get process utilization: %w", err))
 		}
+	}
 
-		uid := strings.TrimSpace(fields[5])
-		if uid == "" {
-			return nil, fmt.Errorf("line %d: empty user field", lineNum+1)
+	processes := make([]types.GPUProcess, 0, len(apps))
+
+	for _, app := range apps {
+		gpuUUID := app.GPUUUID
+		gpuInstanceID, computeInstanceID, migProfile := -1, -1, ""
+		if device, ok := c.migDevice(app); ok {
+			gpuUUID = device.GPUUUID
+			gpuInstanceID, computeInstanceID = device.GPUInstanceID, device.ComputeInstanceID
+			migProfile = device.Profile
 		}
 
-		usedMemory, err := c.parseFloat(fields[6])
-		if err != nil {
-			return nil, fmt.Errorf("line %d: failed to parse memory usage '%s': %w", lineNum+1, fields[6], err)
+		gpuID, exists := gpuMapping[gpuUUID]
+		if !exists {
+			// e.g. a MIG device UUID while MIG devices could not be read
+			gpuID = -1
 		}
 
-		usedCPU, err := c.parseFloat(fields[7])
+		info, err := c.proc.lookup(app.PID)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: failed to parse CPU usage '%s': %w", lineNum+1, fields[7], err)
+			// the process may have exited or be outside our PID namespace
+			info = processInfo{user: "unknown"}
 		}
 
-		// 9番目のフィールドが完全なコマンド（スペース含む）
-		command := strings.TrimSpace(fields[8])
+		command := info.command
 		if command == "" {
-			command = processName // フォールバック
+			command = app.ProcessName // フォールバック
 		}
 
 		// コマンドが異常に長い場合は切り詰め（セキュリティ考慮）
@@ -382,17 +552,46 @@ func (c *Collector) parseProcessesWithMapping(output string, gpuMapping map[stri
 		process := types.GPUProcess{
 			Hostname:      c.hostname,
 			GPUID:         gpuID,
-			Timestamp:     timestamp,
-			User:          uid,
-			PID:           pid,
-			ProcessName:   processName,
-			UsedGPUMemory: usedGPUMemory,
-			UsedCPU:       usedCPU,
-			UsedMemory:    usedMemory,
+			GPUUUID:       gpuUUID,
+			Timestamp:     app.Timestamp,
+			User:          info.user,
+			PID:           app.PID,
+			ProcessName:   app.ProcessName,
+			Type:          app.Type,
+			UsedGPUMemory: app.UsedGPUMemory,
+			UsedCPU:       info.cpuPercent,
+			UsedMemory:    info.memoryPercent,
 			Command:       command,
+
+			GPUInstanceID:     gpuInstanceID,
+			ComputeInstanceID: computeInstanceID,
+			MIGProfile:        migProfile,
+		}
+		if sample, ok := utilization[[2]int{gpuID, app.PID}]; ok {
+			process.SMUtilization = sample.SM
+			process.MemoryUtilization = sample.Memory
+			process.EncoderUtilization = sample.Encoder
+			process.DecoderUtilization = sample.Decoder
+			process.HasUtilization = true
 		}
 		processes = append(processes, process)
 	}
 
-	return processes, nil
+	return processes, errors.Join(errs...)
+}
+
+// processUtilization samples per-process engine utilization, keyed by GPU
+// index and PID. It returns nil if the source cannot sample it.
+func (c *Collector) processUtilization(ctx context.Context) (map[[2]int]ProcessUtilization, error) {
+	source, ok := c.source.(ProcessUtilizationSource)
+	if !ok {
+		return nil, nil
+	}
+
+	samples, err := source.ProcessUtilization(ctx)
+	byProcess := make(map[[2]int]ProcessUtilization, len(samples))
+	for _, sample := range samples {
+		byProcess[[2]int{sample.GPUID, sample.PID}] = sample
+	}
+	return byProcess, err
 }
@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+func TestCollectAccountingStats(t *testing.T) {
+	source := NewFakeSource()
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, source)
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.CollectGPUMetrics(); err != nil {
+		t.Fatalf("CollectGPUMetrics: %v", err)
+	}
+
+	collect := func() types.AccountingStats {
+		t.Helper()
+		stats, err := c.CollectAccountingStats()
+		if err != nil {
+			t.Fatalf("CollectAccountingStats: %v", err)
+		}
+		if len(stats) != 1 {
+			t.Fatalf("CollectAccountingStats returned %d GPUs, want 1", len(stats))
+		}
+		return stats[0]
+	}
+
+	// The first read counts the finished process already in the buffer,
+	// but not the running one; later reads do not count it again.
+	for i := 0; i < 2; i++ {
+		stats := collect()
+		if stats.GPUID != 0 || stats.Processes != 1 || stats.Seconds != 90 || stats.GPUBusySeconds != 72 || stats.MemoryBusySeconds != 36 || stats.MaxMemoryBytes != 2048*mib {
+			t.Errorf("read %d: stats = %+v", i+1, stats)
+		}
+	}
+
+	source.Accounted = append(source.Accounted, AccountedApp{
+		GPUUUID:        "GPU-00000000-0000-0000-0000-000000000000",
+		PID:            1001,
+		GPUUtilization: 100,
+		MaxMemoryUsage: 40 << 30,
+		Time:           10 * time.Second,
+	})
+	stats := collect()
+	if stats.Processes != 2 || stats.Seconds != 100 || stats.MaxMemoryBytes != 2048*mib+40<<30 {
+		t.Errorf("stats after a second process finished = %+v", stats)
+	}
+
+	for bound, want := range map[uint64]uint64{
+		1 << 30:   0,
+		2 << 30:   1,
+		32 << 30:  1,
+		64 << 30:  2,
+		128 << 30: 2,
+	} {
+		if got := stats.MaxMemoryBuckets[bound]; got != want {
+			t.Errorf("processes with at most %d bytes peak memory = %d, want %d", bound, got, want)
+		}
+	}
+	if len(stats.MaxMemoryBuckets) != len(accountingMemoryBuckets) {
+		t.Errorf("got %d buckets, want %d", len(stats.MaxMemoryBuckets), len(accountingMemoryBuckets))
+	}
+
+	wantFinished := []types.AccountedProcess{
+		{PID: 1000, Seconds: 90, GPUUtilization: 80, MemoryUtilization: 40, MaxMemoryBytes: 2048 * mib},
+		{PID: 1001, Seconds: 10, GPUUtilization: 100, MaxMemoryBytes: 40 << 30},
+	}
+	if !reflect.DeepEqual(stats.FinishedProcesses, wantFinished) {
+		t.Errorf("finished processes = %+v, want %+v", stats.FinishedProcesses, wantFinished)
+	}
+
+	// The first process is no longer reported on its own once it was
+	// counted finishedProcessRetention ago, but still adds to the totals.
+	c.mu.Lock()
+	c.finished[0].counted = c.finished[0].counted.Add(-finishedProcessRetention)
+	c.mu.Unlock()
+	stats = collect()
+	if !reflect.DeepEqual(stats.FinishedProcesses, wantFinished[1:]) {
+		t.Errorf("finished processes after the first expired = %+v, want %+v", stats.FinishedProcesses, wantFinished[1:])
+	}
+	if stats.Processes != 2 {
+		t.Errorf("processes after the first expired = %d, want 2", stats.Processes)
+	}
+}
+
+func TestCollectAccountingStatsUnreadableRow(t *testing.T) {
+	// The second read cannot parse the run time of PID 1001.
+	s, _ := fakeNvidiaSmi(t, `header="gpu_uuid, pid, gpu_utilization [%], mem_utilization [%], max_memory_usage [MiB], time [ms], is_running"
+first="GPU-00000000-0000-0000-0000-000000000000, 1000, 80, 40, 2048, 90000, No"
+if [ "$(wc -l < "$(dirname "$0")/calls")" -eq 2 ]; then
+	second="GPU-00000000-0000-0000-0000-000000000000, 1001, 100, 0, 1024, soon, No"
+else
+	second="GPU-00000000-0000-0000-0000-000000000000, 1001, 100, 0, 1024, 10000, No"
+fi
+printf '%s\n%s\n%s\n' "$header" "$first" "$second"`)
+	s.accountingEnabled = true
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, s)
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	for i, wantErr := range []bool{false, true, false} {
+		stats, err := c.CollectAccountingStats()
+		if (err != nil) != wantErr {
+			t.Errorf("read %d: error = %v, want error %v", i+1, err, wantErr)
+		}
+		// PID 1001 was counted on the first read and is still in the
+		// buffer on the third, after the read that could not parse it.
+		if len(stats) != 1 || stats[0].Processes != 2 || stats[0].Seconds != 100 {
+			t.Errorf("read %d: stats = %+v", i+1, stats)
+		}
+	}
+}
+
+func TestCollectProcessesUnknownGPU(t *testing.T) {
+	source := NewFakeSource()
+	source.Apps = append(source.Apps, ComputeApp{
+		GPUUUID:     "MIG-00000000-0000-0000-0000-0000000000ff",
+		PID:         4242,
+		ProcessName: "python",
+		Type:        ProcessTypeCompute,
+	})
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, source)
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	// MIG devices were never collected, so the MIG UUID maps to no GPU.
+	processes, err := c.CollectProcesses()
+	if err != nil {
+		t.Fatalf("CollectProcesses: %v", err)
+	}
+	for _, process := range processes {
+		if process.PID != 4242 {
+			continue
+		}
+		if process.GPUID != -1 || process.GPUUUID != "MIG-00000000-0000-0000-0000-0000000000ff" {
+			t.Errorf("process on an unknown MIG device has GPU %d %s, want -1", process.GPUID, process.GPUUUID)
+		}
+		return
+	}
+	t.Errorf("CollectProcesses = %+v, want PID 4242 among them", processes)
+}
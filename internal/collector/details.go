@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// detailLinePattern matches a "Key    : Value" line of nvidia-smi -q output.
+// Section headings such as "FB Memory Usage" or "GPU 00000000:01:00.0" do
+// not match because they have no whitespace before a colon.
+var detailLinePattern = regexp.MustCompile(`^(\S.*?)\s+:(?:\s(.*))?$`)
+
+// detailNode is one line of nvidia-smi -q output together with the lines
+// indented beneath it. The root node has neither key nor value.
+type detailNode struct {
+	key      string
+	value    string
+	children []*detailNode
+}
+
+// parseDetails parses the indented text printed by nvidia-smi -q into a tree.
+func parseDetails(output string) *detailNode {
+	root := &detailNode{}
+
+	type level struct {
+		indent int
+		node   *detailNode
+	}
+	stack := []level{{indent: -1, node: root}}
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "==") {
+			continue
+		}
+
+		node := &detailNode{key: trimmed}
+		if match := detailLinePattern.FindStringSubmatch(trimmed); match != nil {
+			node.key = match[1]
+			node.value = strings.TrimSpace(match[2])
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		parent := stack[len(stack)-1].node
+		parent.children = append(parent.children, node)
+		stack = append(stack, level{indent: indent, node: node})
+	}
+
+	return root
+}
+
+// child returns the first descendant reached by following path, or nil.
+func (n *detailNode) child(path ...string) *detailNode {
+	current := n
+	for _, key := range path {
+		if current == nil {
+			return nil
+		}
+
+		var next *detailNode
+		for _, c := range current.children {
+			if c.key == key {
+				next = c
+				break
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// get returns the value at path, or "" if it is missing or not available.
+func (n *detailNode) get(path ...string) string {
+	node := n.child(path...)
+	if node == nil || notAvailable(node.value) {
+		return ""
+	}
+	return node.value
+}
+
+// bytes returns the memory size at path, such as "1024 MiB", in bytes,
+// or 0 if it is missing or not available.
+func (n *detailNode) bytes(path ...string) (uint64, error) {
+	value := n.get(path...)
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := parseBytes(value, "")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", strings.Join(path, "/"), err)
+	}
+	return size, nil
+}
+
+// float returns the number at path without its unit, such as 85 for
+// "85 C", or 0 if it is missing or not available.
+func (n *detailNode) float(path ...string) (float64, error) {
+	value := n.get(path...)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, _ := splitUnit(value)
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", strings.Join(path, "/"), err)
+	}
+	return f, nil
+}
+
+// all returns every direct child with key.
+func (n *detailNode) all(key string) []*detailNode {
+	var nodes []*detailNode
+	for _, c := range n.children {
+		if c.key == key {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// gpus returns the per-GPU sections, headed "GPU <bus id>", keyed by
+// normalized PCI bus ID.
+func (n *detailNode) gpus() map[string]*detailNode {
+	sections := make(map[string]*detailNode)
+	for _, c := range n.children {
+		if busID, ok := strings.CutPrefix(c.key, "GPU "); ok && c.value == "" {
+			sections[normalizeBusID(busID)] = c
+		}
+	}
+	return sections
+}
+
+// detailProcess is an entry of the Processes section of nvidia-smi -q.
+type detailProcess struct {
+	pid               int
+	processType       string // "C" compute, "G" graphics, "C+G" both, "M" MPS server
+	name              string
+	usedGPUMemory     uint64 // bytes
+	gpuInstanceID     int    // -1 if not on a MIG device
+	computeInstanceID int    // -1 if not on a MIG device
+}
+
+// parseDetailProcesses reads the Processes section of a GPU section.
+// Each "Process ID" entry follows the instance IDs it runs on; its other
+// fields are nested beneath it or, with older drivers, follow it.
+func parseDetailProcesses(gpu *detailNode) []detailProcess {
+	section := gpu.child("Processes")
+	if section == nil {
+		return nil
+	}
+
+	var processes []detailProcess
+	gpuInstanceID, computeInstanceID := -1, -1
+	var current *detailProcess
+
+	for _, node := range section.children {
+		switch node.key {
+		case "GPU instance ID":
+			gpuInstanceID = detailID(node.value)
+		case "Compute instance ID":
+			computeInstanceID = detailID(node.value)
+		case "Process ID":
+			pid, err := strconv.Atoi(node.value)
+			if err != nil {
+				current = nil
+				continue
+			}
+			processes = append(processes, detailProcess{
+				pid:               pid,
+				gpuInstanceID:     gpuInstanceID,
+				computeInstanceID: computeInstanceID,
+			})
+			current = &processes[len(processes)-1]
+			for _, field := range node.children {
+				current.set(field)
+			}
+		default:
+			if current != nil {
+				current.set(node)
+			}
+		}
+	}
+
+	return processes
+}
+
+// set assigns a field of a process entry.
+func (p *detailProcess) set(field *detailNode) {
+	switch field.key {
+	case "Type":
+		p.processType = field.value
+	case "Name":
+		p.name = field.value
+	case "Used GPU Memory":
+		if !notAvailable(field.value) {
+			p.usedGPUMemory, _ = parseBytes(field.value, "")
+		}
+	}
+}
+
+// detailID parses an instance ID, returning -1 if it is not available.
+func detailID(value string) int {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+// normalizeBusID returns a PCI bus ID in nvidia-smi's query format,
+// e.g. "00000000:3B:00.0", so that IDs from different outputs compare equal.
+func normalizeBusID(busID string) string {
+	return strings.ToUpper(strings.TrimSpace(busID))
+}
@@ -0,0 +1,337 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// FakeSource is an in-memory Source for running the exporter on machines without GPUs.
+// Its fields must not be modified while a Collector is reading from it.
+type FakeSource struct {
+	GPUList     []types.GPUMetrics
+	MIGs        []types.MIGDevice
+	Links       []types.NVLink
+	VGPUList    []types.VGPU
+	Topo        types.Topology
+	Apps        []ComputeApp
+	Utilization []ProcessUtilization
+	Accounted   []AccountedApp
+}
+
+const mib = 1 << 20
+
+// NewFakeSource creates a FakeSource populated with two sample GPUs joined
+// by two NVLinks and sharing a NIC, the first hosting a vGPU and the second
+// in MIG mode with two MIG devices, and one compute app that points at the
+// exporter's own process, which accounting mode also lists next to a
+// finished one, and one graphics app.
+func NewFakeSource() *FakeSource {
+	return &FakeSource{
+		GPUList: []types.GPUMetrics{
+			{
+				GPUID:                         0,
+				GPUName:                       "NVIDIA Fake GPU",
+				UUID:                          "GPU-00000000-0000-0000-0000-000000000000",
+				Serial:                        "0000000000000",
+				PCIBusID:                      "00000000:01:00.0",
+				VBIOSVersion:                  "00.00.00.00.00",
+				DriverVersion:                 "550.54.15",
+				CUDAVersion:                   "12.4",
+				BoardPartNumber:               "000-00000-0000-000",
+				Temperature:                   45,
+				MemoryTemperature:             52,
+				ShutdownTemperature:           92,
+				SlowdownTemperature:           89,
+				MaxOperatingTemperature:       85,
+				MemoryMaxOperatingTemperature: 95,
+				FreeMemory:                    20480 * mib,
+				UsedMemory:                    4096 * mib,
+				TotalMemory:                   24576 * mib,
+				ReservedMemory:                338 * mib,
+				BAR1TotalMemory:               32768 * mib,
+				BAR1UsedMemory:                2 * mib,
+				GPUUtilization:                30,
+				MemoryUtilization:             15,
+				EncoderUtilization:            12,
+				DecoderUtilization:            20,
+				EncoderSessions:               2,
+				EncoderAverageFPS:             60,
+				EncoderAverageLatency:         0.002,
+				PowerDraw:                     180,
+				PowerLimit:                    350,
+				EnforcedPowerLimit:            350,
+				PowerMinLimit:                 100,
+				PowerMaxLimit:                 350,
+				PowerDefaultLimit:             350,
+				Clocks:                        types.GPUClocks{Graphics: 1410, SM: 1410, Memory: 1215, Video: 1275},
+				MaxClocks:                     types.GPUClocks{Graphics: 1410, SM: 1410, Memory: 1215},
+				ApplicationClocks:             types.GPUClocks{Graphics: 1410, Memory: 1215},
+				DefaultApplicationClocks:      types.GPUClocks{Graphics: 1410, Memory: 1215},
+				ClockEventReasons:             types.ClockEventReasons{SWThermalSlowdown: true},
+				ECCMode:                       true,
+				ECCCorrectedAggregate:         types.ECCErrors{DRAM: 3, Total: 3},
+				RemappedRowsCorrectable:       1,
+				PCIeLinkGen:                   4,
+				PCIeLinkGenMax:                4,
+				PCIeLinkWidth:                 8,
+				PCIeLinkWidthMax:              16,
+				PCIeRxThroughput:              512 * mib,
+				PCIeTxThroughput:              128 * mib,
+				FanSpeed:                      45,
+				PerformanceState:              0,
+				ComputeMode:                   "Default",
+				PersistenceMode:               true,
+				AccountingMode:                true,
+				VirtualizationMode:            "Host VGPU",
+				Fabric:                        types.GPUFabric{State: "Completed", Status: "Success", CliqueID: "32766", ClusterUUID: "00000000-0000-0000-0000-000000000000"},
+			},
+			{
+				GPUID:                         1,
+				GPUName:                       "NVIDIA Fake GPU",
+				UUID:                          "GPU-00000000-0000-0000-0000-000000000001",
+				Serial:                        "0000000000001",
+				PCIBusID:                      "00000000:02:00.0",
+				VBIOSVersion:                  "00.00.00.00.00",
+				DriverVersion:                 "550.54.15",
+				CUDAVersion:                   "12.4",
+				BoardPartNumber:               "000-00000-0000-000",
+				Temperature:                   38,
+				MemoryTemperature:             40,
+				ShutdownTemperature:           92,
+				SlowdownTemperature:           89,
+				MaxOperatingTemperature:       85,
+				MemoryMaxOperatingTemperature: 95,
+				FreeMemory:                    24576 * mib,
+				UsedMemory:                    0,
+				TotalMemory:                   24576 * mib,
+				ReservedMemory:                338 * mib,
+				BAR1TotalMemory:               32768 * mib,
+				BAR1UsedMemory:                1 * mib,
+				GPUUtilization:                0,
+				MemoryUtilization:             0,
+				PowerDraw:                     25,
+				PowerLimit:                    350,
+				EnforcedPowerLimit:            350,
+				PowerMinLimit:                 100,
+				PowerMaxLimit:                 350,
+				PowerDefaultLimit:             350,
+				Clocks:                        types.GPUClocks{Graphics: 210, SM: 210, Memory: 1215, Video: 1275},
+				MaxClocks:                     types.GPUClocks{Graphics: 1410, SM: 1410, Memory: 1215},
+				ApplicationClocks:             types.GPUClocks{Graphics: 1410, Memory: 1215},
+				DefaultApplicationClocks:      types.GPUClocks{Graphics: 1410, Memory: 1215},
+				ClockEventReasons:             types.ClockEventReasons{GPUIdle: true},
+				ECCMode:                       true,
+				PCIeLinkGen:                   4,
+				PCIeLinkGenMax:                4,
+				PCIeLinkWidth:                 16,
+				PCIeLinkWidthMax:              16,
+				FanSpeed:                      30,
+				PerformanceState:              8,
+				ComputeMode:                   "Exclusive_Process",
+				PersistenceMode:               false,
+				MIGMode:                       true,
+				VirtualizationMode:            "None",
+				Fabric:                        types.GPUFabric{State: "In Progress", CliqueID: "32766", ClusterUUID: "00000000-0000-0000-0000-000000000000"},
+			},
+		},
+		MIGs: []types.MIGDevice{
+			{
+				GPUID:                1,
+				GPUUUID:              "GPU-00000000-0000-0000-0000-000000000001",
+				GPUName:              "NVIDIA Fake GPU",
+				UUID:                 "MIG-00000000-0000-0000-0000-000000000010",
+				Index:                0,
+				Profile:              "3g.12gb",
+				GPUInstanceID:        1,
+				ComputeInstanceID:    0,
+				GPUInstanceProfileID: 9,
+				PlacementStart:       0,
+				PlacementSize:        4,
+				TotalMemory:          12032 * mib,
+				UsedMemory:           12 * mib,
+				FreeMemory:           12020 * mib,
+			},
+			{
+				GPUID:                1,
+				GPUUUID:              "GPU-00000000-0000-0000-0000-000000000001",
+				GPUName:              "NVIDIA Fake GPU",
+				UUID:                 "MIG-00000000-0000-0000-0000-000000000011",
+				Index:                1,
+				Profile:              "3g.12gb",
+				GPUInstanceID:        2,
+				ComputeInstanceID:    0,
+				GPUInstanceProfileID: 9,
+				PlacementStart:       4,
+				PlacementSize:        4,
+				TotalMemory:          12032 * mib,
+				UsedMemory:           12 * mib,
+				FreeMemory:           12020 * mib,
+			},
+		},
+		Links: []types.NVLink{
+			{GPUID: 0, GPUUUID: "GPU-00000000-0000-0000-0000-000000000000", GPUName: "NVIDIA Fake GPU", Link: 0, Active: true, Speed: 25e9, TxBytes: 4096 * mib, RxBytes: 2048 * mib, HasDataCounters: true},
+			{GPUID: 0, GPUUUID: "GPU-00000000-0000-0000-0000-000000000000", GPUName: "NVIDIA Fake GPU", Link: 1, Active: true, Speed: 25e9, TxBytes: 4096 * mib, RxBytes: 2048 * mib, HasDataCounters: true, Errors: map[string]uint64{"replay": 2}},
+			{GPUID: 1, GPUUUID: "GPU-00000000-0000-0000-0000-000000000001", GPUName: "NVIDIA Fake GPU", Link: 0, Active: true, Speed: 25e9, TxBytes: 2048 * mib, RxBytes: 4096 * mib, HasDataCounters: true},
+			{GPUID: 1, GPUUUID: "GPU-00000000-0000-0000-0000-000000000001", GPUName: "NVIDIA Fake GPU", Link: 1, Active: false},
+		},
+		VGPUList: []types.VGPU{
+			{
+				GPUID:              0,
+				GPUUUID:            "GPU-00000000-0000-0000-0000-000000000000",
+				GPUName:            "NVIDIA Fake GPU",
+				ID:                 "3251634178",
+				UUID:               "00000000-0000-0000-0000-000000000100",
+				TypeName:           "NVIDIA Fake-4Q",
+				VMName:             "fake-vm",
+				VMUUID:             "00000000-0000-0000-0000-000000000200",
+				GuestDriverVersion: "550.54.15",
+				LicenseStatus:      "Licensed",
+				GPUInstanceID:      -1,
+				TotalMemory:        4096 * mib,
+				UsedMemory:         1024 * mib,
+				FreeMemory:         3072 * mib,
+				GPUUtilization:     25,
+				MemoryUtilization:  10,
+				EncoderUtilization: 5,
+				EncoderSessions:    1,
+				EncoderAverageFPS:  30,
+			},
+		},
+		Topo: types.Topology{
+			GPUs: []types.TopologyGPU{
+				{
+					GPUID:        0,
+					GPUUUID:      "GPU-00000000-0000-0000-0000-000000000000",
+					GPUName:      "NVIDIA Fake GPU",
+					CPUAffinity:  "0-15",
+					NUMAAffinity: "0",
+					GPUNUMAID:    -1,
+					GPULinks:     map[int]string{1: "NV2"},
+					NICLinks:     map[string]string{"NIC0": "PXB"},
+				},
+				{
+					GPUID:        1,
+					GPUUUID:      "GPU-00000000-0000-0000-0000-000000000001",
+					GPUName:      "NVIDIA Fake GPU",
+					CPUAffinity:  "0-15",
+					NUMAAffinity: "0",
+					GPUNUMAID:    -1,
+					GPULinks:     map[int]string{0: "NV2"},
+					NICLinks:     map[string]string{"NIC0": "PHB"},
+				},
+			},
+			NICs: []types.TopologyNIC{{Name: "NIC0", Device: "mlx5_0"}},
+		},
+		Apps: []ComputeApp{
+			{
+				GPUUUID:       "GPU-00000000-0000-0000-0000-000000000000",
+				PID:           os.Getpid(),
+				ProcessName:   "fake-app",
+				UsedGPUMemory: 4096 * mib,
+				Type:          ProcessTypeCompute,
+
+				GPUInstanceID:     -1,
+				ComputeInstanceID: -1,
+			},
+			{
+				GPUUUID:       "GPU-00000000-0000-0000-0000-000000000000",
+				PID:           1,
+				ProcessName:   "/usr/lib/xorg/Xorg",
+				UsedGPUMemory: 64 * mib,
+				Type:          ProcessTypeGraphics,
+
+				GPUInstanceID:     -1,
+				ComputeInstanceID: -1,
+			},
+		},
+		Utilization: []ProcessUtilization{
+			{GPUID: 0, PID: os.Getpid(), SM: 25, Memory: 10, Encoder: 12, Decoder: 20},
+		},
+		Accounted: []AccountedApp{
+			{
+				GPUUUID:           "GPU-00000000-0000-0000-0000-000000000000",
+				PID:               os.Getpid(),
+				GPUUtilization:    30,
+				MemoryUtilization: 15,
+				MaxMemoryUsage:    4096 * mib,
+				Time:              time.Hour,
+				Running:           true,
+			},
+			{
+				GPUUUID:           "GPU-00000000-0000-0000-0000-000000000000",
+				PID:               1000,
+				GPUUtilization:    80,
+				MemoryUtilization: 40,
+				MaxMemoryUsage:    2048 * mib,
+				Time:              90 * time.Second,
+			},
+		},
+	}
+}
+
+// GPUs returns a copy of GPUList stamped with the current time.
+func (s *FakeSource) GPUs(ctx context.Context) ([]types.GPUMetrics, error) {
+	now := time.Now()
+	gpus := make([]types.GPUMetrics, len(s.GPUList))
+	for i, gpu := range s.GPUList {
+		gpu.Timestamp = now
+		gpus[i] = gpu
+	}
+	return gpus, nil
+}
+
+// GPUMapping returns the UUID to index mapping of GPUList.
+func (s *FakeSource) GPUMapping(ctx context.Context) (map[string]int, error) {
+	mapping := make(map[string]int, len(s.GPUList))
+	for _, gpu := range s.GPUList {
+		mapping[gpu.UUID] = gpu.GPUID
+	}
+	return mapping, nil
+}
+
+// MIGDevices returns a copy of MIGs.
+func (s *FakeSource) MIGDevices(ctx context.Context) ([]types.MIGDevice, error) {
+	return append([]types.MIGDevice(nil), s.MIGs...), nil
+}
+
+// VGPUs returns a copy of VGPUList.
+func (s *FakeSource) VGPUs(ctx context.Context) ([]types.VGPU, error) {
+	return append([]types.VGPU(nil), s.VGPUList...), nil
+}
+
+// NVLinks returns a copy of Links.
+func (s *FakeSource) NVLinks(ctx context.Context) ([]types.NVLink, error) {
+	return append([]types.NVLink(nil), s.Links...), nil
+}
+
+// Topology returns a copy of Topo.
+func (s *FakeSource) Topology(ctx context.Context) (*types.Topology, error) {
+	topology := s.Topo
+	topology.GPUs = append([]types.TopologyGPU(nil), s.Topo.GPUs...)
+	topology.NICs = append([]types.TopologyNIC(nil), s.Topo.NICs...)
+	return &topology, nil
+}
+
+// ProcessUtilization returns a copy of Utilization.
+func (s *FakeSource) ProcessUtilization(ctx context.Context) ([]ProcessUtilization, error) {
+	return append([]ProcessUtilization(nil), s.Utilization...), nil
+}
+
+// AccountedApps returns a copy of Accounted.
+func (s *FakeSource) AccountedApps(ctx context.Context) ([]AccountedApp, error) {
+	return append([]AccountedApp(nil), s.Accounted...), nil
+}
+
+// ComputeApps returns a copy of Apps stamped with the current time.
+func (s *FakeSource) ComputeApps(ctx context.Context) ([]ComputeApp, error) {
+	now := time.Now()
+	apps := make([]ComputeApp, len(s.Apps))
+	for i, app := range s.Apps {
+		app.Timestamp = now
+		apps[i] = app
+	}
+	return apps, nil
+}
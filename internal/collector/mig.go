@@ -0,0 +1,226 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+var (
+	// listGPUPattern matches a GPU line of nvidia-smi -L, e.g.
+	// "GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-5d5ba0d6-...)".
+	listGPUPattern = regexp.MustCompile(`^GPU (\d+): .* \(UUID: ([^)]+)\)`)
+
+	// listMIGPattern matches a MIG device line of nvidia-smi -L, e.g.
+	// "  MIG 1g.5gb      Device  0: (UUID: MIG-c6d4f1ef-...)".
+	listMIGPattern = regexp.MustCompile(`^\s+MIG (\S+)\s+Device\s+(\d+): \(UUID: ([^)]+)\)`)
+
+	// gpuInstancePattern matches a row of nvidia-smi mig -lgi, e.g.
+	// "|   0  MIG 3g.40gb          9        1          4:4     |".
+	gpuInstancePattern = regexp.MustCompile(`^\|\s*(\d+)\s+MIG\s+(\S+)\s+(\d+)\s+(\d+)\s+(\d+):(\d+)\s*\|`)
+
+	// permissionPattern matches nvidia-smi's error for a command that needs root.
+	permissionPattern = regexp.MustCompile(`(?i)insufficient permissions|no permission`)
+)
+
+// migListing is a MIG device line of nvidia-smi -L.
+type migListing struct {
+	profile string
+	uuid    string
+}
+
+// gpuInstance is a row of nvidia-smi mig -lgi.
+type gpuInstance struct {
+	profileID      int
+	placementStart int
+	placementSize  int
+}
+
+// MIGDevices enumerates the MIG devices of the GPUs that were in MIG mode
+// when GPUs last ran, and returns nothing without running nvidia-smi if none
+// were. Memory usage and instance IDs come from the nvidia-smi -q output
+// that GPUs read in the same collection, or from nvidia-smi -q -d MEMORY if
+// it read none. Profiles and UUIDs come from nvidia-smi -L and placements
+// from nvidia-smi mig -lgi, which needs root; if it fails, placements are
+// left unknown and the failure is returned with the devices. A permission
+// failure is returned once, after which mig -lgi is not run again. While
+// streaming, -L and mig -lgi are read only every streamRefreshInterval.
+func (s *nvidiaSmiSource) MIGDevices(ctx context.Context) ([]types.MIGDevice, error) {
+	s.mu.Lock()
+	migEnabled, parents, denied, details := s.migEnabled, s.migGPUs, s.gpuInstancesDenied, s.details
+	s.details = nil
+	s.mu.Unlock()
+
+	if !migEnabled {
+		return nil, nil
+	}
+
+	output, err := s.refreshOutput(ctx, "-L")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MIG devices: %w", err)
+	}
+	listings := parseMIGListing(string(output))
+
+	if details == nil {
+		if details, err = exec.CommandContext(ctx, s.path, "-q", "-d", "MEMORY").Output(); err != nil {
+			return nil, fmt.Errorf("failed to get MIG device memory: %w", err)
+		}
+	}
+	sections := parseDetails(string(details)).gpus()
+
+	var errs []error
+	instances := make(map[[2]int]gpuInstance)
+	if !denied {
+		if output, err := s.refreshOutput(ctx, "mig", "-lgi"); err != nil {
+			errs = append(errs, fmt.Errorf("failed to list GPU instances: %w", err))
+			if permissionDenied(output, err) {
+				s.mu.Lock()
+				s.gpuInstancesDenied = true
+				s.mu.Unlock()
+			}
+		} else {
+			instances = parseGPUInstances(string(output))
+		}
+	}
+
+	var devices []types.MIGDevice
+	for _, parent := range parents {
+		section, ok := sections[normalizeBusID(parent.pciBusID)]
+		if !ok {
+			continue
+		}
+
+		for _, node := range section.child("MIG Devices").all("MIG Device") {
+			device, err := parseMIGDevice(node)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("GPU %d: %w", parent.id, err))
+				continue
+			}
+
+			device.GPUID = parent.id
+			device.GPUUUID = parent.uuid
+			device.GPUName = parent.name
+
+			listing := listings[[2]int{parent.id, device.Index}]
+			device.Profile = listing.profile
+			device.UUID = listing.uuid
+
+			device.GPUInstanceProfileID, device.PlacementStart, device.PlacementSize = -1, -1, -1
+			if instance, ok := instances[[2]int{parent.id, device.GPUInstanceID}]; ok {
+				device.GPUInstanceProfileID = instance.profileID
+				device.PlacementStart = instance.placementStart
+				device.PlacementSize = instance.placementSize
+			}
+
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, errors.Join(errs...)
+}
+
+// noPermissionExitCode is the nvidia-smi exit code for an operation the
+// current user is not allowed to perform.
+const noPermissionExitCode = 4
+
+// permissionDenied reports whether a failed nvidia-smi run was refused for
+// lack of permissions.
+func permissionDenied(output []byte, err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return exitErr.ExitCode() == noPermissionExitCode ||
+		permissionPattern.Match(append(output, exitErr.Stderr...))
+}
+
+// parseMIGDevice reads a "MIG Device" section of nvidia-smi -q.
+func parseMIGDevice(node *detailNode) (types.MIGDevice, error) {
+	var device types.MIGDevice
+	var errs []error
+
+	for _, id := range []struct {
+		value *int
+		key   string
+	}{
+		{&device.Index, "Index"},
+		{&device.GPUInstanceID, "GPU Instance ID"},
+		{&device.ComputeInstanceID, "Compute Instance ID"},
+	} {
+		value, err := strconv.Atoi(node.get(id.key))
+		if err != nil {
+			return device, fmt.Errorf("MIG device %s: %w", id.key, err)
+		}
+		*id.value = value
+	}
+
+	for _, size := range []struct {
+		value *uint64
+		key   string
+	}{
+		{&device.TotalMemory, "Total"},
+		{&device.UsedMemory, "Used"},
+		{&device.FreeMemory, "Free"},
+	} {
+		var err error
+		if *size.value, err = node.bytes("FB Memory Usage", size.key); err != nil {
+			errs = append(errs, fmt.Errorf("MIG device %d: %w", device.Index, err))
+		}
+	}
+
+	return device, errors.Join(errs...)
+}
+
+// parseMIGListing parses nvidia-smi -L into MIG devices keyed by GPU index
+// and MIG device index.
+func parseMIGListing(output string) map[[2]int]migListing {
+	listings := make(map[[2]int]migListing)
+
+	gpu := -1
+	for _, line := range strings.Split(output, "\n") {
+		if match := listGPUPattern.FindStringSubmatch(line); match != nil {
+			gpu, _ = strconv.Atoi(match[1])
+			continue
+		}
+
+		match := listMIGPattern.FindStringSubmatch(line)
+		if match == nil || gpu < 0 {
+			continue
+		}
+		index, _ := strconv.Atoi(match[2])
+		listings[[2]int{gpu, index}] = migListing{profile: match[1], uuid: match[3]}
+	}
+
+	return listings
+}
+
+// parseGPUInstances parses nvidia-smi mig -lgi into GPU instances keyed by
+// GPU index and GPU instance ID.
+func parseGPUInstances(output string) map[[2]int]gpuInstance {
+	instances := make(map[[2]int]gpuInstance)
+
+	for _, line := range strings.Split(output, "\n") {
+		match := gpuInstancePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		var values [5]int
+		for i, text := range []string{match[1], match[3], match[4], match[5], match[6]} {
+			values[i], _ = strconv.Atoi(text)
+		}
+		instances[[2]int{values[0], values[2]}] = gpuInstance{
+			profileID:      values[1],
+			placementStart: values[3],
+			placementSize:  values[4],
+		}
+	}
+
+	return instances
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// migScript answers the nvidia-smi commands GPUs and MIGDevices run for one
+// A100 in MIG mode with one MIG device, refusing mig -lgi as it does for
+// non-root users.
+const migScript = `case "$*" in
+"-L")
+	cat <<'OUT'
+GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-5d5ba0d6-0000-0000-0000-000000000000)
+  MIG 3g.20gb     Device  0: (UUID: MIG-c6d4f1ef-0000-0000-0000-000000000000)
+OUT
+	;;
+"-q -d MEMORY"|"-q -d MEMORY,TEMPERATURE")
+	cat <<'OUT'
+==============NVSMI LOG==============
+
+Attached GPUs                             : 1
+GPU 00000000:3B:00.0
+    MIG Devices
+        MIG Device
+            Index                         : 0
+            GPU Instance ID               : 2
+            Compute Instance ID           : 0
+            FB Memory Usage
+                Total                     : 19968 MiB
+                Used                      : 12 MiB
+                Free                      : 19956 MiB
+OUT
+	;;
+"mig -lgi")
+	echo "Insufficient Permissions" >&2
+	exit 4
+	;;
+*)
+	exit 2
+	;;
+esac`
+
+func TestMIGDevicesNotInMIGMode(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, migScript)
+	s.setState([]types.GPUMetrics{{GPUID: 0, UUID: "GPU-5d5ba0d6-0000-0000-0000-000000000000", PCIBusID: "00000000:3B:00.0"}})
+
+	devices, err := s.MIGDevices(context.Background())
+	if devices != nil || err != nil {
+		t.Errorf("MIGDevices = %v, %v, want nil, nil", devices, err)
+	}
+	if got := calls(); got != nil {
+		t.Errorf("nvidia-smi ran without a GPU in MIG mode: %q", got)
+	}
+}
+
+func TestMIGDevicesPermissionDenied(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, migScript)
+	s.setState([]types.GPUMetrics{{
+		GPUID:    0,
+		UUID:     "GPU-5d5ba0d6-0000-0000-0000-000000000000",
+		GPUName:  "NVIDIA A100-SXM4-40GB",
+		PCIBusID: "00000000:3B:00.0",
+		MIGMode:  true,
+	}})
+
+	want := []types.MIGDevice{{
+		GPUID:                0,
+		GPUUUID:              "GPU-5d5ba0d6-0000-0000-0000-000000000000",
+		GPUName:              "NVIDIA A100-SXM4-40GB",
+		UUID:                 "MIG-c6d4f1ef-0000-0000-0000-000000000000",
+		Index:                0,
+		Profile:              "3g.20gb",
+		GPUInstanceID:        2,
+		ComputeInstanceID:    0,
+		GPUInstanceProfileID: -1,
+		PlacementStart:       -1,
+		PlacementSize:        -1,
+		TotalMemory:          19968 * mib,
+		UsedMemory:           12 * mib,
+		FreeMemory:           19956 * mib,
+	}}
+
+	devices, err := s.MIGDevices(context.Background())
+	if err == nil {
+		t.Error("MIGDevices did not report the permission failure")
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("MIGDevices = %+v, want %+v", devices, want)
+	}
+
+	devices, err = s.MIGDevices(context.Background())
+	if err != nil {
+		t.Errorf("MIGDevices reported the permission failure again: %v", err)
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("MIGDevices = %+v, want %+v", devices, want)
+	}
+
+	lgi := 0
+	for _, call := range calls() {
+		if call == "mig -lgi" {
+			lgi++
+		}
+	}
+	if lgi != 1 {
+		t.Errorf("mig -lgi ran %d times, want once", lgi)
+	}
+}
+
+func TestMIGDevicesReuseDetails(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, migScript)
+	metrics := []types.GPUMetrics{{
+		GPUID:    0,
+		UUID:     "GPU-5d5ba0d6-0000-0000-0000-000000000000",
+		PCIBusID: "00000000:3B:00.0",
+		MIGMode:  true,
+	}}
+	s.setState(metrics)
+
+	// GPUs reads -q -d MEMORY,TEMPERATURE, which also has the MIG devices
+	s.addDetails(context.Background(), metrics)
+	devices, _ := s.MIGDevices(context.Background())
+	if len(devices) != 1 || devices[0].UsedMemory != 12*mib {
+		t.Errorf("MIGDevices = %+v, want one device using 12 MiB", devices)
+	}
+
+	// without a new read, MIGDevices reads MIG device memory itself
+	if devices, _ := s.MIGDevices(context.Background()); len(devices) != 1 {
+		t.Errorf("second MIGDevices = %+v, want one device", devices)
+	}
+
+	var memory []string
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "-q") {
+			memory = append(memory, call)
+		}
+	}
+	if want := []string{"-q -d MEMORY,TEMPERATURE", "-q -d MEMORY"}; !reflect.DeepEqual(memory, want) {
+		t.Errorf("nvidia-smi -q ran as %q, want %q", memory, want)
+	}
+}
+
+func TestParseGPUInstances(t *testing.T) {
+	output := `+-------------------------------------------------------+
+| GPU instances:                                        |
+| GPU   Name             Profile  Instance   Placement  |
+|                          ID       ID       Start:Size |
+|=======================================================|
+|   0  MIG 3g.20gb          9        2          4:4     |
++-------------------------------------------------------+
+|   1  MIG 1g.5gb          19        7          6:1     |
++-------------------------------------------------------+`
+
+	want := map[[2]int]gpuInstance{
+		{0, 2}: {profileID: 9, placementStart: 4, placementSize: 4},
+		{1, 7}: {profileID: 19, placementStart: 6, placementSize: 1},
+	}
+	if got := parseGPUInstances(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGPUInstances = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// monitorTable is the parsed output of nvidia-smi dmon or pmon. Both print
+// two comment lines, one with column names and one with units, followed by
+// whitespace-separated rows where "-" marks an unavailable value.
+type monitorTable struct {
+	columns map[string]queryColumn
+	rows    [][]string
+}
+
+// parseMonitorTable parses dmon or pmon output. Header lines repeated by
+// long-running monitors are skipped.
+func parseMonitorTable(output string) (*monitorTable, error) {
+	table := &monitorTable{}
+
+	var names, units []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(strings.TrimPrefix(line, "#"))
+			switch {
+			case names == nil:
+				names = fields
+			case units == nil:
+				units = fields
+			}
+			continue
+		}
+
+		if names == nil {
+			return nil, fmt.Errorf("missing header before %q", line)
+		}
+
+		cells := strings.Fields(line)
+		if len(cells) < len(names) {
+			return nil, fmt.Errorf("row %q has %d columns, expected %d", line, len(cells), len(names))
+		}
+		// the last column may be a free-text name containing spaces
+		if len(cells) > len(names) {
+			last := len(names) - 1
+			cells = append(cells[:last:last], strings.Join(cells[last:], " "))
+		}
+
+		table.rows = append(table.rows, cells)
+	}
+
+	table.columns = make(map[string]queryColumn, len(names))
+	for i, name := range names {
+		column := queryColumn{index: i}
+		if i < len(units) {
+			column.unit = units[i]
+		}
+		table.columns[name] = column
+	}
+
+	return table, nil
+}
+
+// has reports whether the table has a column named name.
+func (t *monitorTable) has(name string) bool {
+	_, ok := t.columns[name]
+	return ok
+}
+
+// text returns the cell of row i in column name, or "" if it is unavailable.
+func (t *monitorTable) text(i int, name string) string {
+	column, ok := t.columns[name]
+	if !ok {
+		return ""
+	}
+
+	value := t.rows[i][column.index]
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// intValue returns the cell of row i in column name as an integer.
+func (t *monitorTable) intValue(i int, name string) (int, error) {
+	value := t.text(i, name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// floatValue returns the cell of row i in column name as a number.
+func (t *monitorTable) floatValue(i int, name string) (float64, error) {
+	value := t.text(i, name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// rate returns the cell of row i in column name, a throughput such as
+// "MB/s", converted to bytes per second.
+func (t *monitorTable) rate(i int, name string) (float64, error) {
+	value, err := t.floatValue(i, name)
+	if err != nil {
+		return 0, err
+	}
+
+	unit := strings.TrimSuffix(t.columns[name].unit, "/s")
+	multiplier, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", t.columns[name].unit)
+	}
+	return value * float64(multiplier), nil
+}
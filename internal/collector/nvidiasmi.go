@@ -0,0 +1,946 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// gpuQueryFields are the --query-gpu fields read by GPUs.
+var gpuQueryFields = append([]string{
+	"timestamp",
+	"index",
+	"gpu_name",
+	"uuid",
+	"serial",
+	"pci.bus_id",
+	"vbios_version",
+	"driver_version",
+	"memory.free",
+	"memory.used",
+	"memory.total",
+	"memory.reserved",
+	"utilization.gpu",
+	"utilization.memory",
+	"utilization.encoder",
+	"utilization.decoder",
+	"encoder.stats.sessionCount",
+	"encoder.stats.averageFps",
+	"encoder.stats.averageLatency",
+	"temperature.gpu",
+	"temperature.memory",
+	"power.draw",
+	"power.limit",
+	"enforced.power.limit",
+	"power.min_limit",
+	"power.max_limit",
+	"power.default_limit",
+	"clocks.gr",
+	"clocks.sm",
+	"clocks.mem",
+	"clocks.video",
+	"clocks.max.gr",
+	"clocks.max.sm",
+	"clocks.max.mem",
+	"clocks.applications.gr",
+	"clocks.applications.mem",
+	"clocks.default_applications.gr",
+	"clocks.default_applications.mem",
+	"clocks_event_reasons.gpu_idle",
+	"clocks_event_reasons.applications_clocks_setting",
+	"clocks_event_reasons.sw_power_cap",
+	"clocks_event_reasons.hw_slowdown",
+	"clocks_event_reasons.hw_thermal_slowdown",
+	"clocks_event_reasons.hw_power_brake_slowdown",
+	"clocks_event_reasons.sw_thermal_slowdown",
+	"clocks_event_reasons.sync_boost",
+	"ecc.mode.current",
+	"retired_pages.single_bit_ecc.count",
+	"retired_pages.double_bit.count",
+	"retired_pages.pending",
+	"remapped_rows.correctable",
+	"remapped_rows.uncorrectable",
+	"remapped_rows.pending",
+	"remapped_rows.failure",
+	"pcie.link.gen.current",
+	"pcie.link.gen.max",
+	"pcie.link.width.current",
+	"pcie.link.width.max",
+	"fan.speed",
+	"pstate",
+	"compute_mode",
+	"persistence_mode",
+	"display_active",
+	"mig.mode.current",
+	"virtualization_mode",
+	"accounting.mode",
+}, eccQueryFields()...)
+
+// eccLocations are the memory locations of the ecc.errors.* query fields.
+var eccLocations = []string{
+	"device_memory",
+	"dram",
+	"sram",
+	"register_file",
+	"l1_cache",
+	"l2_cache",
+	"texture_memory",
+	"cbu",
+	"total",
+}
+
+// eccQueryFields returns every ecc.errors.<type>.<counter>.<location> field.
+func eccQueryFields() []string {
+	var fields []string
+	for _, errorType := range []string{"corrected", "uncorrected"} {
+		for _, counter := range []string{"volatile", "aggregate"} {
+			for _, location := range eccLocations {
+				fields = append(fields, "ecc.errors."+errorType+"."+counter+"."+location)
+			}
+		}
+	}
+	return fields
+}
+
+// computeAppQueryFields are the --query-compute-apps fields read by ComputeApps.
+var computeAppQueryFields = []string{
+	"timestamp",
+	"gpu_uuid",
+	"pid",
+	"process_name",
+	"used_gpu_memory",
+}
+
+// fieldAliases maps query fields to the older names accepted by drivers
+// that predate them.
+var fieldAliases = map[string]string{
+	"clocks_event_reasons.gpu_idle":                    "clocks_throttle_reasons.gpu_idle",
+	"clocks_event_reasons.applications_clocks_setting": "clocks_throttle_reasons.applications_clocks_setting",
+	"clocks_event_reasons.sw_power_cap":                "clocks_throttle_reasons.sw_power_cap",
+	"clocks_event_reasons.hw_slowdown":                 "clocks_throttle_reasons.hw_slowdown",
+	"clocks_event_reasons.hw_thermal_slowdown":         "clocks_throttle_reasons.hw_thermal_slowdown",
+	"clocks_event_reasons.hw_power_brake_slowdown":     "clocks_throttle_reasons.hw_power_brake_slowdown",
+	"clocks_event_reasons.sw_thermal_slowdown":         "clocks_throttle_reasons.sw_thermal_slowdown",
+	"clocks_event_reasons.sync_boost":                  "clocks_throttle_reasons.sync_boost",
+}
+
+// invalidFieldPattern matches nvidia-smi's error for a field the driver does not know.
+var invalidFieldPattern = regexp.MustCompile(`Field "([^"]+)" is not a valid field to query`)
+
+// nvidiaSmiSource reads GPU data by executing nvidia-smi.
+type nvidiaSmiSource struct {
+	path string
+
+	mu         sync.Mutex
+	invalid    map[string]bool   // fields rejected by this driver
+	inventory  *inventory        // nil until nvidia-smi -q has been read
+	topology   *types.Topology   // nil until nvidia-smi topo -m has been read
+	migEnabled bool              // whether a GPU was in MIG mode when last queried
+	gpus       []gpuDevice       // GPUs as last queried
+	migGPUs    []gpuDevice       // GPUs in MIG mode when last queried
+	gpuUUIDs   map[string]string // GPU UUID by PCI bus ID, as last queried
+	vgpuHost   bool              // whether a GPU hosted vGPUs when last queried
+
+	accountingEnabled bool // whether a GPU had accounting mode enabled when last queried
+
+	unsupported        map[string]bool // monitor commands, such as dmon, that this driver does not support
+	gpuInstancesDenied bool            // whether nvidia-smi mig -lgi lacked the permissions it needs
+	noPCIeThroughput   bool            // whether to leave PCIe throughput unset rather than run dmon
+	details            []byte          // nvidia-smi -q output read by the last GPUs, until MIGDevices takes it
+
+	stream *gpuStream // nil unless streaming
+}
+
+// inventory holds values from nvidia-smi -q that --query-gpu cannot report
+// and that do not change while the driver is loaded, except for the fabric
+// state, for which nvidia-smi -q -d FABRIC is read on every collection once
+// a GPU has reported one. An inventory is not modified once stored.
+type inventory struct {
+	cudaVersion string
+	partNumbers map[string]string          // board part number by PCI bus ID
+	fabrics     map[string]types.GPUFabric // by PCI bus ID
+}
+
+func newNvidiaSmiSource(config types.CollectorConfig) (*nvidiaSmiSource, error) {
+	s := &nvidiaSmiSource{
+		path:             config.NvidiaSmiPath,
+		invalid:          make(map[string]bool),
+		unsupported:      make(map[string]bool),
+		noPCIeThroughput: config.DisablePCIeThroughput,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	if err := s.checkAvailability(ctx); err != nil {
+		return nil, fmt.Errorf("nvidia-smi availability check failed: %w", err)
+	}
+
+	return s, nil
+}
+
+// Close stops streaming, if started.
+func (s *nvidiaSmiSource) Close() error {
+	if s.stream != nil {
+		return s.stream.Close()
+	}
+	return nil
+}
+
+func (s *nvidiaSmiSource) checkAvailability(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, s.path, "--version")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nvidia-smi not found or cannot be executed: %w", err)
+	}
+	return nil
+}
+
+// query runs nvidia-smi with a --query-* option for fields and parses the
+// CSV output, including its header row. Fields the driver rejects are
+// replaced by their older alias, or dropped so that they read as not
+// available; the result is remembered for later queries.
+func (s *nvidiaSmiSource) query(ctx context.Context, option string, fields []string) (*queryTable, error) {
+	for {
+		names, keys := s.resolveFields(fields)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no supported fields in %s", strings.Join(fields, ","))
+		}
+
+		cmd := exec.CommandContext(ctx, s.path,
+			"--"+option+"="+strings.Join(names, ","),
+			"--format=csv,nounits")
+
+		output, err := cmd.Output()
+		if err != nil {
+			if invalid := invalidField(output, err); invalid != "" && s.markInvalid(invalid) {
+				continue
+			}
+			return nil, err
+		}
+
+		table, err := parseQueryTable(string(output), names)
+		if err != nil {
+			return nil, err
+		}
+		table.rename(names, keys)
+
+		return table, nil
+	}
+}
+
+// resolveFields returns the names to query for fields, skipping or aliasing
+// invalid ones, and the requested field each name stands for.
+func (s *nvidiaSmiSource) resolveFields(fields []string) ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(fields))
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		name := field
+		if s.invalid[name] {
+			alias, ok := fieldAliases[name]
+			if !ok || s.invalid[alias] {
+				continue
+			}
+			name = alias
+		}
+		names = append(names, name)
+		keys = append(keys, field)
+	}
+	return names, keys
+}
+
+// markInvalid records that the driver rejected field and reports whether
+// it was not already known, i.e. whether retrying can make progress.
+func (s *nvidiaSmiSource) markInvalid(field string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.invalid[field] {
+		return false
+	}
+	s.invalid[field] = true
+	log.Printf("nvidia-smi does not support query field %s", field)
+	return true
+}
+
+// invalidField extracts the rejected field name from a failed nvidia-smi run.
+func invalidField(output []byte, err error) string {
+	text := string(output)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		text += string(exitErr.Stderr)
+	}
+
+	match := invalidFieldPattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// unsupportedPattern matches nvidia-smi's error for a command or option the
+// GPU or driver does not support.
+var unsupportedPattern = regexp.MustCompile(`(?i)not supported`)
+
+// monitor takes one sample with an nvidia-smi monitor command such as dmon
+// or pmon and parses it. Each run blocks for the monitor's sampling period,
+// about a second, so a command that nvidia-smi reports as not supported is
+// remembered and not run again; monitor returns nil for it without an error.
+func (s *nvidiaSmiSource) monitor(ctx context.Context, args ...string) (*monitorTable, error) {
+	command := args[0]
+
+	s.mu.Lock()
+	unsupported := s.unsupported[command]
+	s.mu.Unlock()
+
+	if unsupported {
+		return nil, nil
+	}
+
+	output, err := exec.CommandContext(ctx, s.path, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && unsupportedPattern.Match(append(output, exitErr.Stderr...)) {
+			s.markUnsupported(command)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return parseMonitorTable(string(output))
+}
+
+// markUnsupported remembers that the driver does not support command, a
+// monitor such as dmon or pmon, so that it is not run again.
+func (s *nvidiaSmiSource) markUnsupported(command string) {
+	s.mu.Lock()
+	s.unsupported[command] = true
+	s.mu.Unlock()
+	log.Printf("nvidia-smi %s is not supported, not running it again", command)
+}
+
+// GPUs queries current GPU metrics, or takes them from the latest samples
+// when streaming. Metrics that come from additional
+// nvidia-smi commands are left zero if those commands fail, and the
+// failure is included in the returned error.
+func (s *nvidiaSmiSource) GPUs(ctx context.Context) ([]types.GPUMetrics, error) {
+	table := s.stream.queryTable()
+	if table == nil {
+		var err error
+		if table, err = s.query(ctx, "query-gpu", gpuQueryFields); err != nil {
+			return nil, err
+		}
+	}
+
+	metrics, err := parseGPUMetrics(table)
+	errs := []error{err}
+
+	s.setState(metrics)
+
+	if err := s.addPCIeThroughput(ctx, metrics); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get PCIe throughput: %w", err))
+	}
+	if err := s.addDetails(ctx, metrics); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get GPU details: %w", err))
+	}
+	if err := s.addInventory(ctx, metrics); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get GPU inventory: %w", err))
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// setState records what later calls need to know about the GPUs as last
+// queried, so that they do not query them again: which modes are enabled,
+// the GPUs and those in MIG mode, and the UUID at each PCI bus ID.
+func (s *nvidiaSmiSource) setState(metrics []types.GPUMetrics) {
+	migEnabled, vgpuHost, accountingEnabled := false, false, false
+	var gpus, migGPUs []gpuDevice
+	gpuUUIDs := make(map[string]string, len(metrics))
+	for _, metric := range metrics {
+		gpu := gpuDevice{id: metric.GPUID, uuid: metric.UUID, name: metric.GPUName, pciBusID: metric.PCIBusID}
+		gpus = append(gpus, gpu)
+		gpuUUIDs[normalizeBusID(metric.PCIBusID)] = metric.UUID
+		if metric.MIGMode {
+			migEnabled = true
+			migGPUs = append(migGPUs, gpu)
+		}
+		vgpuHost = vgpuHost || metric.VirtualizationMode == vgpuHostMode
+		accountingEnabled = accountingEnabled || metric.AccountingMode
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.migEnabled = migEnabled
+	s.gpus = gpus
+	s.migGPUs = migGPUs
+	s.gpuUUIDs = gpuUUIDs
+	s.vgpuHost = vgpuHost
+	s.accountingEnabled = accountingEnabled
+}
+
+// addPCIeThroughput sets PCIe RX/TX throughput from the latest samples when
+// streaming, or else from one dmon sample, which adds about a second to
+// every collection unless disabled.
+func (s *nvidiaSmiSource) addPCIeThroughput(ctx context.Context, metrics []types.GPUMetrics) error {
+	table := s.stream.monitorTable()
+	if table == nil {
+		if s.noPCIeThroughput {
+			return nil
+		}
+		var err error
+		if table, err = s.monitor(ctx, "dmon", "-s", "t", "-c", "1"); err != nil || table == nil {
+			return err
+		}
+	}
+
+	byIndex := make(map[int]*types.GPUMetrics, len(metrics))
+	for i := range metrics {
+		byIndex[metrics[i].GPUID] = &metrics[i]
+	}
+
+	for i := range table.rows {
+		index, err := table.intValue(i, "gpu")
+		if err != nil {
+			return err
+		}
+
+		metric, ok := byIndex[index]
+		if !ok {
+			continue
+		}
+
+		if metric.PCIeRxThroughput, err = table.rate(i, "rxpci"); err != nil {
+			return err
+		}
+		if metric.PCIeTxThroughput, err = table.rate(i, "txpci"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detailDisplays are the nvidia-smi -q sections read by addDetails.
+var detailDisplays = []string{"MEMORY", "TEMPERATURE"}
+
+// addDetails sets metrics that --query-gpu cannot report from the
+// detailDisplays sections of nvidia-smi -q. They are read on every
+// collection, also while streaming, as BAR1 and protected memory usage
+// change as often as the streamed samples.
+func (s *nvidiaSmiSource) addDetails(ctx context.Context, metrics []types.GPUMetrics) error {
+	output, err := exec.CommandContext(ctx, s.path, "-q", "-d", strings.Join(detailDisplays, ",")).Output()
+
+	// MIG device memory is in the MEMORY section too
+	s.mu.Lock()
+	s.details = nil
+	if err == nil {
+		s.details = output
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	sections := parseDetails(string(output)).gpus()
+
+	var errs []error
+	for i := range metrics {
+		busID := normalizeBusID(metrics[i].PCIBusID)
+		gpu, ok := sections[busID]
+		if !ok {
+			continue
+		}
+
+		if err := parseMemoryDetails(gpu, &metrics[i]); err != nil {
+			errs = append(errs, fmt.Errorf("GPU %s: %w", busID, err))
+		}
+		if err := parseTemperatureDetails(gpu, &metrics[i]); err != nil {
+			errs = append(errs, fmt.Errorf("GPU %s: %w", busID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseMemoryDetails reads the BAR1 and confidential computing protected
+// memory sections of nvidia-smi -q -d MEMORY.
+func parseMemoryDetails(gpu *detailNode, metric *types.GPUMetrics) error {
+	var errs []error
+	for _, size := range []struct {
+		value *uint64
+		path  []string
+	}{
+		{&metric.BAR1TotalMemory, []string{"BAR1 Memory Usage", "Total"}},
+		{&metric.BAR1UsedMemory, []string{"BAR1 Memory Usage", "Used"}},
+		{&metric.ProtectedTotalMemory, []string{"Conf Compute Protected Memory Usage", "Total"}},
+		{&metric.ProtectedUsedMemory, []string{"Conf Compute Protected Memory Usage", "Used"}},
+	} {
+		var err error
+		if *size.value, err = gpu.bytes(size.path...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseTemperatureDetails reads the temperature thresholds of
+// nvidia-smi -q -d TEMPERATURE.
+func parseTemperatureDetails(gpu *detailNode, metric *types.GPUMetrics) error {
+	var errs []error
+	for _, threshold := range []struct {
+		value *float64
+		key   string
+	}{
+		{&metric.ShutdownTemperature, "GPU Shutdown Temp"},
+		{&metric.SlowdownTemperature, "GPU Slowdown Temp"},
+		{&metric.MaxOperatingTemperature, "GPU Max Operating Temp"},
+		{&metric.MemoryMaxOperatingTemperature, "Memory Max Operating Temp"},
+	} {
+		var err error
+		if *threshold.value, err = gpu.float("Temperature", threshold.key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addInventory sets the CUDA version, board part numbers and fabric state.
+// They are read from nvidia-smi -q once and read again only when a GPU is
+// not known yet. To keep the fabric state current while a GPU is attached
+// to an NVLink fabric, only the fabric section is read on later collections,
+// or every streamRefreshInterval while streaming.
+func (s *nvidiaSmiSource) addInventory(ctx context.Context, metrics []types.GPUMetrics) error {
+	s.mu.Lock()
+	inv := s.inventory
+	s.mu.Unlock()
+
+	stale := inv == nil
+	for i := 0; !stale && i < len(metrics); i++ {
+		_, known := inv.partNumbers[normalizeBusID(metrics[i].PCIBusID)]
+		stale = !known
+	}
+
+	switch {
+	case stale:
+		cmd := exec.CommandContext(ctx, s.path, "-q")
+		output, err := cmd.Output()
+		if err != nil {
+			return err
+		}
+
+		inv = parseInventory(parseDetails(string(output)))
+
+	case inv.hasFabric():
+		output, err := s.refreshOutput(ctx, "-q", "-d", "FABRIC")
+		if err != nil {
+			return err
+		}
+
+		fabrics := make(map[string]types.GPUFabric, len(inv.fabrics))
+		for busID, gpu := range parseDetails(string(output)).gpus() {
+			fabrics[busID] = parseFabric(gpu)
+		}
+		inv = &inventory{cudaVersion: inv.cudaVersion, partNumbers: inv.partNumbers, fabrics: fabrics}
+	}
+
+	s.mu.Lock()
+	s.inventory = inv
+	s.mu.Unlock()
+
+	for i := range metrics {
+		metrics[i].CUDAVersion = inv.cudaVersion
+		metrics[i].BoardPartNumber = inv.partNumbers[normalizeBusID(metrics[i].PCIBusID)]
+		metrics[i].Fabric = inv.fabrics[normalizeBusID(metrics[i].PCIBusID)]
+	}
+
+	return nil
+}
+
+func parseInventory(details *detailNode) *inventory {
+	inv := &inventory{
+		cudaVersion: details.get("CUDA Version"),
+		partNumbers: make(map[string]string),
+		fabrics:     make(map[string]types.GPUFabric),
+	}
+	for busID, gpu := range details.gpus() {
+		inv.partNumbers[busID] = gpu.get("Board Part Number")
+		inv.fabrics[busID] = parseFabric(gpu)
+	}
+	return inv
+}
+
+// hasFabric reports whether any GPU is attached to an NVLink fabric.
+func (inv *inventory) hasFabric() bool {
+	for _, fabric := range inv.fabrics {
+		if fabric.State != "" && fabric.State != "Not Supported" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFabric reads the Fabric section of a GPU section of nvidia-smi -q.
+// GPUs that are not attached to an NVLink fabric report its state as N/A.
+func parseFabric(gpu *detailNode) types.GPUFabric {
+	fabric := gpu.child("Fabric")
+	if fabric == nil {
+		return types.GPUFabric{}
+	}
+
+	// the keys have been spelled both ways by different drivers
+	firstOf := func(keys ...string) string {
+		for _, key := range keys {
+			if value := fabric.get(key); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	return types.GPUFabric{
+		State:       fabric.get("State"),
+		Status:      fabric.get("Status"),
+		CliqueID:    firstOf("CliqueId", "Clique ID"),
+		ClusterUUID: firstOf("ClusterUUID", "Cluster UUID"),
+	}
+}
+
+// parseGPUMetrics builds GPU metrics from a --query-gpu table. Fields that
+// cannot be parsed are left zero and reported in the returned error; a GPU is
+// dropped only if its index cannot be parsed.
+func parseGPUMetrics(table *queryTable) ([]types.GPUMetrics, error) {
+	metrics := make([]types.GPUMetrics, 0, table.len())
+	var errs []error
+
+	for i := 0; i < table.len(); i++ {
+		row := table.row(i)
+
+		gpuIndex := row.Int("index")
+		if err := row.Err(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		gpuName := row.Text("gpu_name")
+		if gpuName == "" {
+			gpuName = "unknown"
+		}
+
+		// nvidia-smi reports encode latency in microseconds
+		encoderLatency := row.Float("encoder.stats.averageLatency") / 1e6
+
+		metric := types.GPUMetrics{
+			GPUID:                 gpuIndex,
+			Timestamp:             row.Time("timestamp"),
+			GPUName:               gpuName,
+			UUID:                  row.Text("uuid"),
+			Serial:                row.Text("serial"),
+			PCIBusID:              row.Text("pci.bus_id"),
+			VBIOSVersion:          row.Text("vbios_version"),
+			DriverVersion:         row.Text("driver_version"),
+			Temperature:           row.Float("temperature.gpu"),
+			MemoryTemperature:     row.Float("temperature.memory"),
+			FreeMemory:            row.Bytes("memory.free"),
+			UsedMemory:            row.Bytes("memory.used"),
+			TotalMemory:           row.Bytes("memory.total"),
+			ReservedMemory:        row.Bytes("memory.reserved"),
+			GPUUtilization:        row.Float("utilization.gpu"),
+			MemoryUtilization:     row.Float("utilization.memory"),
+			EncoderUtilization:    row.Float("utilization.encoder"),
+			DecoderUtilization:    row.Float("utilization.decoder"),
+			EncoderSessions:       row.Int("encoder.stats.sessionCount"),
+			EncoderAverageFPS:     row.Float("encoder.stats.averageFps"),
+			EncoderAverageLatency: encoderLatency,
+			PowerDraw:             row.Float("power.draw"),
+			PowerLimit:            row.Float("power.limit"),
+			EnforcedPowerLimit:    row.Float("enforced.power.limit"),
+			PowerMinLimit:         row.Float("power.min_limit"),
+			PowerMaxLimit:         row.Float("power.max_limit"),
+			PowerDefaultLimit:     row.Float("power.default_limit"),
+			Clocks: types.GPUClocks{
+				Graphics: row.Float("clocks.gr"),
+				SM:       row.Float("clocks.sm"),
+				Memory:   row.Float("clocks.mem"),
+				Video:    row.Float("clocks.video"),
+			},
+			MaxClocks: types.GPUClocks{
+				Graphics: row.Float("clocks.max.gr"),
+				SM:       row.Float("clocks.max.sm"),
+				Memory:   row.Float("clocks.max.mem"),
+			},
+			ApplicationClocks: types.GPUClocks{
+				Graphics: row.Float("clocks.applications.gr"),
+				Memory:   row.Float("clocks.applications.mem"),
+			},
+			DefaultApplicationClocks: types.GPUClocks{
+				Graphics: row.Float("clocks.default_applications.gr"),
+				Memory:   row.Float("clocks.default_applications.mem"),
+			},
+			ClockEventReasons: types.ClockEventReasons{
+				GPUIdle:                   row.Bool("clocks_event_reasons.gpu_idle"),
+				ApplicationsClocksSetting: row.Bool("clocks_event_reasons.applications_clocks_setting"),
+				SWPowerCap:                row.Bool("clocks_event_reasons.sw_power_cap"),
+				HWSlowdown:                row.Bool("clocks_event_reasons.hw_slowdown"),
+				HWThermalSlowdown:         row.Bool("clocks_event_reasons.hw_thermal_slowdown"),
+				HWPowerBrakeSlowdown:      row.Bool("clocks_event_reasons.hw_power_brake_slowdown"),
+				SWThermalSlowdown:         row.Bool("clocks_event_reasons.sw_thermal_slowdown"),
+				SyncBoost:                 row.Bool("clocks_event_reasons.sync_boost"),
+			},
+			ECCMode:                   row.Bool("ecc.mode.current"),
+			ECCCorrectedVolatile:      parseECCErrors(row, "corrected", "volatile"),
+			ECCUncorrectedVolatile:    parseECCErrors(row, "uncorrected", "volatile"),
+			ECCCorrectedAggregate:     parseECCErrors(row, "corrected", "aggregate"),
+			ECCUncorrectedAggregate:   parseECCErrors(row, "uncorrected", "aggregate"),
+			RetiredPagesSingleBit:     row.Uint("retired_pages.single_bit_ecc.count"),
+			RetiredPagesDoubleBit:     row.Uint("retired_pages.double_bit.count"),
+			RetiredPagesPending:       row.Bool("retired_pages.pending"),
+			RemappedRowsCorrectable:   row.Uint("remapped_rows.correctable"),
+			RemappedRowsUncorrectable: row.Uint("remapped_rows.uncorrectable"),
+			RemappedRowsPending:       row.Bool("remapped_rows.pending"),
+			RemappedRowsFailure:       row.Bool("remapped_rows.failure"),
+			PCIeLinkGen:               row.Int("pcie.link.gen.current"),
+			PCIeLinkGenMax:            row.Int("pcie.link.gen.max"),
+			PCIeLinkWidth:             row.Int("pcie.link.width.current"),
+			PCIeLinkWidthMax:          row.Int("pcie.link.width.max"),
+			FanSpeed:                  row.Float("fan.speed"),
+			PerformanceState:          parsePerformanceState(row, "pstate"),
+			ComputeMode:               row.Text("compute_mode"),
+			PersistenceMode:           row.Bool("persistence_mode"),
+			DisplayActive:             row.Bool("display_active"),
+			MIGMode:                   row.Bool("mig.mode.current"),
+			VirtualizationMode:        row.Text("virtualization_mode"),
+			AccountingMode:            row.Bool("accounting.mode"),
+		}
+		metrics = append(metrics, metric)
+
+		if err := row.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// parsePerformanceState converts a P-state such as "P2" to its number,
+// or -1 if it is not available.
+func parsePerformanceState(row *queryRow, field string) int {
+	value := row.Text(field)
+	if value == "" {
+		return -1
+	}
+
+	state, err := parsePState(value)
+	if err != nil {
+		row.fail(field, value, err)
+		return -1
+	}
+	return state
+}
+
+// parsePState parses a P-state such as "P2".
+func parsePState(value string) (int, error) {
+	state, err := strconv.Atoi(strings.TrimPrefix(value, "P"))
+	if err != nil || state < 0 || state > 15 {
+		return 0, fmt.Errorf("not a P-state")
+	}
+	return state, nil
+}
+
+// parseECCErrors reads the ecc.errors.<errorType>.<counter>.* fields of row.
+func parseECCErrors(row *queryRow, errorType, counter string) types.ECCErrors {
+	prefix := "ecc.errors." + errorType + "." + counter + "."
+	return types.ECCErrors{
+		DeviceMemory:  row.Uint(prefix + "device_memory"),
+		DRAM:          row.Uint(prefix + "dram"),
+		SRAM:          row.Uint(prefix + "sram"),
+		RegisterFile:  row.Uint(prefix + "register_file"),
+		L1Cache:       row.Uint(prefix + "l1_cache"),
+		L2Cache:       row.Uint(prefix + "l2_cache"),
+		TextureMemory: row.Uint(prefix + "texture_memory"),
+		CBU:           row.Uint(prefix + "cbu"),
+		Total:         row.Uint(prefix + "total"),
+	}
+}
+
+// GPUMapping gets the mapping from GPU UUID to GPU index, from the latest
+// samples when streaming.
+func (s *nvidiaSmiSource) GPUMapping(ctx context.Context) (map[string]int, error) {
+	table := s.stream.queryTable()
+	if table == nil {
+		var err error
+		if table, err = s.query(ctx, "query-gpu", []string{"index", "uuid"}); err != nil {
+			return nil, err
+		}
+	}
+
+	mapping := make(map[string]int, table.len())
+	for i := 0; i < table.len(); i++ {
+		row := table.row(i)
+
+		index := row.Int("index")
+		uuid := row.Text("uuid")
+		if row.Err() != nil || uuid == "" {
+			continue
+		}
+
+		mapping[uuid] = index
+	}
+
+	return mapping, nil
+}
+
+// ComputeApps queries the processes currently using the GPUs. Compute
+// processes come from --query-compute-apps; their types and MIG instances,
+// and the graphics and MPS client processes it omits, come from nvidia-smi
+// -q -d PIDS. If that fails, the compute processes are returned without
+// them, together with the error.
+func (s *nvidiaSmiSource) ComputeApps(ctx context.Context) ([]ComputeApp, error) {
+	table, err := s.query(ctx, "query-compute-apps", computeAppQueryFields)
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := parseComputeApps(table)
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err = s.addDetailProcesses(ctx, apps)
+	if err != nil {
+		return apps, fmt.Errorf("failed to get process details: %w", err)
+	}
+
+	return apps, nil
+}
+
+// addDetailProcesses sets the type and MIG instance IDs of apps from the
+// process lists of nvidia-smi -q -d PIDS and appends the processes listed
+// there but not in apps. A CUDA process sees a single MIG device, whose UUID
+// it is listed with in apps, so processes on MIG devices are matched by PID
+// alone. Processes on a GPU that GPUs has not reported yet are skipped.
+func (s *nvidiaSmiSource) addDetailProcesses(ctx context.Context, apps []ComputeApp) ([]ComputeApp, error) {
+	output, err := exec.CommandContext(ctx, s.path, "-q", "-d", "PIDS").Output()
+	if err != nil {
+		return apps, err
+	}
+
+	s.mu.Lock()
+	gpuUUIDs := s.gpuUUIDs
+	s.mu.Unlock()
+
+	type appKey struct {
+		gpuUUID string
+		pid     int
+	}
+	byKey := make(map[appKey]int, len(apps))
+	byPID := make(map[int]int, len(apps))
+	for i, app := range apps {
+		byKey[appKey{app.GPUUUID, app.PID}] = i
+		byPID[app.PID] = i
+	}
+
+	now := time.Now()
+	for busID, gpu := range parseDetails(string(output)).gpus() {
+		gpuUUID := gpuUUIDs[busID]
+
+		for _, process := range parseDetailProcesses(gpu) {
+			i, ok := byKey[appKey{gpuUUID, process.pid}]
+			if !ok && process.gpuInstanceID >= 0 {
+				i, ok = byPID[process.pid]
+			}
+
+			if ok {
+				apps[i].Type = processType(process)
+				if process.gpuInstanceID >= 0 {
+					apps[i].GPUInstanceID = process.gpuInstanceID
+					apps[i].ComputeInstanceID = process.computeInstanceID
+				}
+				continue
+			}
+
+			if gpuUUID == "" {
+				continue
+			}
+			apps = append(apps, ComputeApp{
+				Timestamp:     now,
+				GPUUUID:       gpuUUID,
+				PID:           process.pid,
+				ProcessName:   process.name,
+				UsedGPUMemory: process.usedGPUMemory,
+				Type:          processType(process),
+
+				GPUInstanceID:     process.gpuInstanceID,
+				ComputeInstanceID: process.computeInstanceID,
+			})
+		}
+	}
+
+	return apps, nil
+}
+
+// processType classifies a process listed by nvidia-smi -q by its type,
+// "C", "G", "C+G", "M" or "M+C", and its name, since the MPS server is
+// listed as a compute process. Processes using both compute and graphics
+// count as compute.
+func processType(process detailProcess) string {
+	switch {
+	case path.Base(process.name) == "nvidia-cuda-mps-server":
+		return ProcessTypeMPSServer
+	case strings.HasPrefix(process.processType, "M"):
+		return ProcessTypeMPSClient
+	case process.processType == "G":
+		return ProcessTypeGraphics
+	default:
+		return ProcessTypeCompute
+	}
+}
+
+func parseComputeApps(table *queryTable) ([]ComputeApp, error) {
+	apps := make([]ComputeApp, 0, table.len())
+
+	for i := 0; i < table.len(); i++ {
+		row := table.row(i)
+
+		// nvidia-smi reports N/A for processes in other containers it cannot see
+		if row.Text("pid") == "" {
+			continue
+		}
+
+		app := ComputeApp{
+			Timestamp:     row.Time("timestamp"),
+			GPUUUID:       row.Text("gpu_uuid"),
+			PID:           row.Int("pid"),
+			ProcessName:   row.Text("process_name"),
+			UsedGPUMemory: row.Bytes("used_gpu_memory"),
+			Type:          ProcessTypeCompute,
+
+			GPUInstanceID:     -1,
+			ComputeInstanceID: -1,
+		}
+		if err := row.Err(); err != nil {
+			return nil, err
+		}
+		if app.ProcessName == "" {
+			return nil, fmt.Errorf("row %d: empty process name", i+1)
+		}
+
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
@@ -0,0 +1,324 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// fakeNvidiaSmi writes a shell script standing in for nvidia-smi that runs
+// script and appends its arguments to a log, and returns a source using it
+// and a function returning the logged invocations.
+func fakeNvidiaSmi(t *testing.T, script string) (*nvidiaSmiSource, func() []string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	path := filepath.Join(dir, "nvidia-smi")
+	content := "#!/bin/sh\necho \"$*\" >> " + log + "\n" + script + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &nvidiaSmiSource{
+		path:        path,
+		invalid:     make(map[string]bool),
+		unsupported: make(map[string]bool),
+	}
+	calls := func() []string {
+		data, err := os.ReadFile(log)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	return s, calls
+}
+
+func TestMonitorUnsupported(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, `echo "Failed to process command line: dmon is Not Supported" >&2; exit 1`)
+
+	for i := 0; i < 3; i++ {
+		table, err := s.monitor(context.Background(), "dmon", "-s", "t", "-c", "1")
+		if err != nil || table != nil {
+			t.Fatalf("monitor = %v, %v, want nil, nil", table, err)
+		}
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %d times, want once: %q", len(got), got)
+	}
+}
+
+func TestMonitorFailure(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, `echo "Unable to determine the device handle" >&2; exit 15`)
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.monitor(context.Background(), "dmon", "-s", "t", "-c", "1"); err == nil {
+			t.Fatal("monitor succeeded, want error")
+		}
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("nvidia-smi ran %d times, want it retried: %q", len(got), got)
+	}
+}
+
+func TestAddPCIeThroughput(t *testing.T) {
+	s, _ := fakeNvidiaSmi(t, `cat <<'OUT'
+# gpu  rxpci  txpci
+# Idx   MB/s   MB/s
+    0     12     34
+    1      -      -
+OUT`)
+
+	metrics := []types.GPUMetrics{{GPUID: 0}, {GPUID: 1}}
+	if err := s.addPCIeThroughput(context.Background(), metrics); err != nil {
+		t.Fatalf("addPCIeThroughput: %v", err)
+	}
+	if metrics[0].PCIeRxThroughput != 12e6 || metrics[0].PCIeTxThroughput != 34e6 {
+		t.Errorf("GPU 0 throughput = %v rx, %v tx, want 12e6, 34e6", metrics[0].PCIeRxThroughput, metrics[0].PCIeTxThroughput)
+	}
+	if metrics[1].PCIeRxThroughput != 0 || metrics[1].PCIeTxThroughput != 0 {
+		t.Errorf("GPU 1 throughput = %v rx, %v tx, want 0", metrics[1].PCIeRxThroughput, metrics[1].PCIeTxThroughput)
+	}
+}
+
+func TestAddPCIeThroughputDisabled(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, `echo "# gpu  rxpci  txpci"`)
+	s.noPCIeThroughput = true
+
+	metrics := []types.GPUMetrics{{GPUID: 0}}
+	if err := s.addPCIeThroughput(context.Background(), metrics); err != nil {
+		t.Fatalf("addPCIeThroughput: %v", err)
+	}
+	if got := calls(); len(got) != 0 {
+		t.Errorf("nvidia-smi ran %q, want no dmon", got)
+	}
+}
+
+// inventoryScript answers nvidia-smi -q for one GPU attached to an NVLink
+// fabric, and -q -d FABRIC with the registration completed since.
+const inventoryScript = `case "$*" in
+"-q")
+	cat <<'OUT'
+==============NVSMI LOG==============
+
+CUDA Version                              : 12.4
+
+Attached GPUs                             : 1
+GPU 00000000:18:00.0
+    Board Part Number                     : 692-2G520-0200-000
+    Fabric
+        State                             : In Progress
+        Status                            : N/A
+        CliqueId                          : N/A
+        ClusterUUID                       : N/A
+OUT
+	;;
+"-q -d FABRIC")
+	cat <<'OUT'
+==============NVSMI LOG==============
+
+Attached GPUs                             : 1
+GPU 00000000:18:00.0
+    Fabric
+        State                             : Completed
+        Status                            : Success
+        CliqueId                          : 32766
+        ClusterUUID                       : 3a4b5c6d-0000-0000-0000-000000000000
+OUT
+	;;
+*)
+	exit 2
+	;;
+esac`
+
+func TestAddInventoryFabricRefresh(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, inventoryScript)
+
+	metrics := []types.GPUMetrics{{GPUID: 0, PCIBusID: "00000000:18:00.0"}}
+	if err := s.addInventory(context.Background(), metrics); err != nil {
+		t.Fatalf("addInventory: %v", err)
+	}
+	if got, want := metrics[0].Fabric, (types.GPUFabric{State: "In Progress"}); got != want {
+		t.Errorf("first fabric = %+v, want %+v", got, want)
+	}
+
+	metrics = []types.GPUMetrics{{GPUID: 0, PCIBusID: "00000000:18:00.0"}}
+	if err := s.addInventory(context.Background(), metrics); err != nil {
+		t.Fatalf("addInventory: %v", err)
+	}
+	want := types.GPUMetrics{
+		GPUID:           0,
+		PCIBusID:        "00000000:18:00.0",
+		CUDAVersion:     "12.4",
+		BoardPartNumber: "692-2G520-0200-000",
+		Fabric:          types.GPUFabric{State: "Completed", Status: "Success", CliqueID: "32766", ClusterUUID: "3a4b5c6d-0000-0000-0000-000000000000"},
+	}
+	if !reflect.DeepEqual(metrics[0], want) {
+		t.Errorf("refreshed metrics = %+v, want %+v", metrics[0], want)
+	}
+
+	if got, want := calls(), []string{"-q", "-q -d FABRIC"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nvidia-smi calls = %q, want %q", got, want)
+	}
+}
+
+// detailsScript answers nvidia-smi -q -d MEMORY,TEMPERATURE for one GPU,
+// with BAR1 usage growing by 1 MiB on each run.
+const detailsScript = `used=$(( $(wc -l < "$(dirname "$0")/calls") ))
+cat <<OUT
+==============NVSMI LOG==============
+
+Attached GPUs                             : 1
+GPU 00000000:18:00.0
+    BAR1 Memory Usage
+        Total                             : 256 MiB
+        Used                              : $used MiB
+        Free                              : 250 MiB
+    Conf Compute Protected Memory Usage
+        Total                             : 0 MiB
+        Used                              : 0 MiB
+        Free                              : 0 MiB
+    Temperature
+        GPU Shutdown Temp                 : 92 C
+        GPU Slowdown Temp                 : 89 C
+OUT`
+
+func TestAddDetailsWhileStreaming(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, detailsScript)
+	s.stream = &gpuStream{source: s, interval: time.Second, outputs: make(map[string]cachedOutput)}
+
+	for want := uint64(1); want <= 2; want++ {
+		metrics := []types.GPUMetrics{{PCIBusID: "00000000:18:00.0"}}
+		if err := s.addDetails(context.Background(), metrics); err != nil {
+			t.Fatalf("addDetails: %v", err)
+		}
+		if got := metrics[0].BAR1UsedMemory; got != want*mib {
+			t.Errorf("collection %d: BAR1 used = %d, want %d", want, got, want*mib)
+		}
+		if got := metrics[0].ShutdownTemperature; got != 92 {
+			t.Errorf("collection %d: shutdown temperature = %v, want 92", want, got)
+		}
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("nvidia-smi ran %q, want -q -d MEMORY,TEMPERATURE per collection", got)
+	}
+}
+
+// pidsScript answers --query-compute-apps, which lists the CUDA processes
+// with a MIG device's UUID for those on MIG devices, and -q -d PIDS, which
+// lists every process by the GPU and the instances it runs on.
+const pidsScript = `case "$*" in
+--query-compute-apps=*)
+	cat <<'OUT'
+timestamp, gpu_uuid, pid, process_name, used_gpu_memory [MiB]
+2024/05/01 12:00:00.000, GPU-00000000-0000-0000-0000-000000000000, 2300, python, 1024
+2024/05/01 12:00:00.000, GPU-00000000-0000-0000-0000-000000000000, 2400, python, 512
+2024/05/01 12:00:00.000, GPU-00000000-0000-0000-0000-000000000000, 2500, nvidia-cuda-mps-server, 32
+2024/05/01 12:00:00.000, MIG-00000000-0000-0000-0000-000000000010, 3100, python, 2048
+OUT
+	;;
+"-q -d PIDS")
+	cat <<'OUT'
+==============NVSMI LOG==============
+
+Attached GPUs                             : 3
+GPU 00000000:3B:00.0
+    Processes
+        GPU instance ID                   : N/A
+        Compute instance ID               : N/A
+        Process ID                        : 1200
+            Type                          : G
+            Name                          : /usr/lib/xorg/Xorg
+            Used GPU Memory               : 64 MiB
+        GPU instance ID                   : N/A
+        Compute instance ID               : N/A
+        Process ID                        : 2300
+            Type                          : C+G
+            Name                          : python
+            Used GPU Memory               : 1024 MiB
+        GPU instance ID                   : N/A
+        Compute instance ID               : N/A
+        Process ID                        : 2400
+            Type                          : M+C
+            Name                          : python
+            Used GPU Memory               : 512 MiB
+        GPU instance ID                   : N/A
+        Compute instance ID               : N/A
+        Process ID                        : 2500
+            Type                          : C
+            Name                          : /usr/bin/nvidia-cuda-mps-server
+            Used GPU Memory               : 32 MiB
+
+GPU 00000000:86:00.0
+    Processes
+        GPU instance ID                   : 1
+        Compute instance ID               : 0
+        Process ID                        : 3100
+            Type                          : C
+            Name                          : python
+            Used GPU Memory               : 2048 MiB
+
+GPU 00000000:AF:00.0
+    Processes
+        GPU instance ID                   : N/A
+        Compute instance ID               : N/A
+        Process ID                        : 4100
+            Type                          : G
+            Name                          : /usr/lib/xorg/Xorg
+            Used GPU Memory               : 64 MiB
+OUT
+	;;
+*)
+	exit 2
+	;;
+esac`
+
+func TestComputeAppsDetailProcesses(t *testing.T) {
+	s, _ := fakeNvidiaSmi(t, pidsScript)
+	// the GPU at 00000000:AF:00.0 has not been reported by GPUs
+	s.setState([]types.GPUMetrics{
+		{GPUID: 0, UUID: "GPU-00000000-0000-0000-0000-000000000000", PCIBusID: "00000000:3B:00.0"},
+		{GPUID: 1, UUID: "GPU-00000000-0000-0000-0000-000000000001", PCIBusID: "00000000:86:00.0", MIGMode: true},
+	})
+
+	apps, err := s.ComputeApps(context.Background())
+	if err != nil {
+		t.Fatalf("ComputeApps: %v", err)
+	}
+
+	type app struct {
+		gpuUUID, name, processType       string
+		gpuInstanceID, computeInstanceID int
+		usedGPUMemory                    uint64
+	}
+	got := make(map[int]app, len(apps))
+	for _, a := range apps {
+		if _, ok := got[a.PID]; ok {
+			t.Errorf("PID %d is listed twice", a.PID)
+		}
+		got[a.PID] = app{a.GPUUUID, a.ProcessName, a.Type, a.GPUInstanceID, a.ComputeInstanceID, a.UsedGPUMemory}
+	}
+
+	want := map[int]app{
+		// listed only by -q, so appended
+		1200: {"GPU-00000000-0000-0000-0000-000000000000", "/usr/lib/xorg/Xorg", ProcessTypeGraphics, -1, -1, 64 * mib},
+		// processes using both compute and graphics count as compute
+		2300: {"GPU-00000000-0000-0000-0000-000000000000", "python", ProcessTypeCompute, -1, -1, 1024 * mib},
+		2400: {"GPU-00000000-0000-0000-0000-000000000000", "python", ProcessTypeMPSClient, -1, -1, 512 * mib},
+		2500: {"GPU-00000000-0000-0000-0000-000000000000", "nvidia-cuda-mps-server", ProcessTypeMPSServer, -1, -1, 32 * mib},
+		// matched by PID, so it keeps its MIG device UUID and gains the instance IDs
+		3100: {"MIG-00000000-0000-0000-0000-000000000010", "python", ProcessTypeCompute, 1, 0, 2048 * mib},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputeApps by PID =\n%+v\nwant\n%+v", got, want)
+	}
+}
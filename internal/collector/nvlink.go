@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// nvlinkLinePattern matches a per-link line of nvidia-smi nvlink output,
+// e.g. "	 Link 0: 25 GB/s" or "	 Link 0: Replay Errors: 0".
+var nvlinkLinePattern = regexp.MustCompile(`^\s*Link (\d+): (.*)$`)
+
+// nvlinkGPU is the per-link output of an nvidia-smi nvlink command for one GPU.
+type nvlinkGPU struct {
+	device gpuDevice
+	links  map[int][]string // link text after "Link N: ", in output order
+}
+
+// NVLinks reads the state and speed of each NVLink from nvidia-smi nvlink
+// --status, its error counters from nvlink -e and its data counters from
+// nvlink -gt d. GPUs without NVLink are omitted. Counters that cannot be
+// read, for example because the driver does not support them, are left
+// out and the failure is returned with the links. While streaming, the
+// status is read only every streamRefreshInterval; the counters are read
+// on every call.
+func (s *nvidiaSmiSource) NVLinks(ctx context.Context) ([]types.NVLink, error) {
+	output, err := s.refreshOutput(ctx, "nvlink", "--status")
+	if err != nil {
+		return nil, err
+	}
+
+	var links []types.NVLink
+	for _, gpu := range parseNVLinkOutput(string(output)) {
+		for link, lines := range gpu.links {
+			nvlink := types.NVLink{
+				GPUID:   gpu.device.id,
+				GPUUUID: gpu.device.uuid,
+				GPUName: gpu.device.name,
+				Link:    link,
+			}
+			// the status is a single speed, or "<inactive>"
+			if speed, err := parseRate(lines[0]); err == nil {
+				nvlink.Active = true
+				nvlink.Speed = speed
+			}
+			links = append(links, nvlink)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].GPUID != links[j].GPUID {
+			return links[i].GPUID < links[j].GPUID
+		}
+		return links[i].Link < links[j].Link
+	})
+
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	byKey := make(map[[2]int]*types.NVLink, len(links))
+	for i := range links {
+		byKey[[2]int{links[i].GPUID, links[i].Link}] = &links[i]
+	}
+
+	var errs []error
+	if err := s.addNVLinkCounters(ctx, byKey, []string{"nvlink", "-e"}, setNVLinkErrors); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get NVLink error counters: %w", err))
+	}
+	if err := s.addNVLinkCounters(ctx, byKey, []string{"nvlink", "-gt", "d"}, setNVLinkData); err != nil {
+		errs = append(errs, fmt.Errorf("failed to get NVLink data counters: %w", err))
+	}
+
+	return links, errors.Join(errs...)
+}
+
+// addNVLinkCounters runs nvidia-smi with args and passes each counter line
+// of a known link to set.
+func (s *nvidiaSmiSource) addNVLinkCounters(ctx context.Context, links map[[2]int]*types.NVLink, args []string, set func(*types.NVLink, string, string) error) error {
+	output, err := exec.CommandContext(ctx, s.path, args...).Output()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, gpu := range parseNVLinkOutput(string(output)) {
+		for link, lines := range gpu.links {
+			nvlink, ok := links[[2]int{gpu.device.id, link}]
+			if !ok {
+				continue
+			}
+
+			for _, line := range lines {
+				name, value, ok := strings.Cut(line, ":")
+				if !ok {
+					continue
+				}
+				if err := set(nvlink, strings.TrimSpace(name), strings.TrimSpace(value)); err != nil {
+					errs = append(errs, fmt.Errorf("GPU %d link %d: %s: %w", gpu.device.id, link, name, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setNVLinkErrors records an nvlink -e counter such as "Replay Errors: 0"
+// under its name without the "Errors" suffix, e.g. "replay" or "crc_flit".
+func setNVLinkErrors(link *types.NVLink, name, value string) error {
+	if notAvailable(value) {
+		return nil
+	}
+
+	count, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	errorType := strings.TrimSpace(strings.TrimSuffix(strings.ToLower(name), "errors"))
+	if link.Errors == nil {
+		link.Errors = make(map[string]uint64)
+	}
+	link.Errors[strings.ReplaceAll(errorType, " ", "_")] = count
+	return nil
+}
+
+// setNVLinkData records an nvlink -gt d counter such as "Data Tx: 1024 KiB".
+func setNVLinkData(link *types.NVLink, name, value string) error {
+	var counter *uint64
+	switch name {
+	case "Data Tx":
+		counter = &link.TxBytes
+	case "Data Rx":
+		counter = &link.RxBytes
+	default:
+		return nil
+	}
+
+	if notAvailable(value) {
+		return nil
+	}
+
+	bytes, err := parseBytes(value, "KiB")
+	if err != nil {
+		return err
+	}
+	*counter = bytes
+	link.HasDataCounters = true
+	return nil
+}
+
+// parseNVLinkOutput splits nvidia-smi nvlink output into GPUs, each headed
+// by a line as printed by nvidia-smi -L, and their links.
+func parseNVLinkOutput(output string) []nvlinkGPU {
+	var gpus []nvlinkGPU
+
+	for _, line := range strings.Split(output, "\n") {
+		if match := listGPUPattern.FindStringSubmatch(line); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			name := strings.TrimPrefix(line, "GPU "+match[1]+": ")
+			name, _, _ = strings.Cut(name, " (UUID: ")
+			gpus = append(gpus, nvlinkGPU{
+				device: gpuDevice{id: index, uuid: match[2], name: name},
+				links:  make(map[int][]string),
+			})
+			continue
+		}
+
+		match := nvlinkLinePattern.FindStringSubmatch(line)
+		if match == nil || len(gpus) == 0 {
+			continue
+		}
+		link, _ := strconv.Atoi(match[1])
+		gpu := &gpus[len(gpus)-1]
+		gpu.links[link] = append(gpu.links[link], strings.TrimSpace(match[2]))
+	}
+
+	return gpus
+}
+
+// parseRate converts a rate such as "25 GB/s" to bytes per second.
+func parseRate(value string) (float64, error) {
+	number, unit := splitUnit(value)
+	multiplier, ok := byteUnits[strings.TrimSuffix(unit, "/s")]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	return f * float64(multiplier), nil
+}
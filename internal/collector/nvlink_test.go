@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// nvlinkScript answers nvidia-smi nvlink --status, -e and -gt d for two GPUs
+// with two links each, one of them inactive, and a GPU without NVLink.
+const nvlinkScript = `case "$*" in
+"nvlink --status")
+	cat <<'OUT'
+GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000000)
+	 Link 0: 25 GB/s
+	 Link 1: 25 GB/s
+GPU 1: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000001)
+	 Link 0: 25 GB/s
+	 Link 1: <inactive>
+GPU 2: NVIDIA T4 (UUID: GPU-00000000-0000-0000-0000-000000000002)
+OUT
+	;;
+"nvlink -e")
+	cat <<'OUT'
+GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000000)
+	 Link 0: Replay Errors: 1
+	 Link 0: Recovery Errors: 0
+	 Link 0: CRC Errors: 2
+	 Link 0: Effective Errors: 3
+	 Link 1: Replay Errors: 0
+	 Link 1: Recovery Errors: 0
+	 Link 1: CRC Errors: 0
+	 Link 1: Effective Errors: N/A
+GPU 1: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000001)
+	 Link 0: Replay Errors: 0
+	 Link 0: Recovery Errors: 0
+	 Link 0: CRC Errors: 0
+	 Link 0: Effective Errors: 0
+OUT
+	;;
+"nvlink -gt d")
+	cat <<'OUT'
+GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000000)
+	 Link 0: Data Tx: 1024 KiB
+	 Link 0: Data Rx: 2048 KiB
+	 Link 1: Data Tx: 0 KiB
+	 Link 1: Data Rx: 0 KiB
+GPU 1: NVIDIA A100-SXM4-40GB (UUID: GPU-00000000-0000-0000-0000-000000000001)
+	 Link 0: Data Tx: 1 GiB
+	 Link 0: Data Rx: N/A
+OUT
+	;;
+*)
+	exit 2
+	;;
+esac`
+
+func TestNVLinks(t *testing.T) {
+	s, _ := fakeNvidiaSmi(t, nvlinkScript)
+
+	links, err := s.NVLinks(context.Background())
+	if err != nil {
+		t.Fatalf("NVLinks: %v", err)
+	}
+
+	const a100 = "NVIDIA A100-SXM4-40GB"
+	want := []types.NVLink{
+		{
+			GPUID: 0, GPUUUID: "GPU-00000000-0000-0000-0000-000000000000", GPUName: a100, Link: 0,
+			Active: true, Speed: 25e9,
+			Errors:  map[string]uint64{"replay": 1, "recovery": 0, "crc": 2, "effective": 3},
+			TxBytes: 1024 << 10, RxBytes: 2048 << 10, HasDataCounters: true,
+		},
+		{
+			GPUID: 0, GPUUUID: "GPU-00000000-0000-0000-0000-000000000000", GPUName: a100, Link: 1,
+			Active: true, Speed: 25e9,
+			Errors:          map[string]uint64{"replay": 0, "recovery": 0, "crc": 0},
+			HasDataCounters: true,
+		},
+		{
+			GPUID: 1, GPUUUID: "GPU-00000000-0000-0000-0000-000000000001", GPUName: a100, Link: 0,
+			Active: true, Speed: 25e9,
+			Errors:  map[string]uint64{"replay": 0, "recovery": 0, "crc": 0, "effective": 0},
+			TxBytes: 1 << 30, HasDataCounters: true,
+		},
+		{
+			GPUID: 1, GPUUUID: "GPU-00000000-0000-0000-0000-000000000001", GPUName: a100, Link: 1,
+		},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("NVLinks =\n%+v\nwant\n%+v", links, want)
+	}
+}
+
+func TestNVLinksWithoutNVLink(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, `echo "GPU 0: NVIDIA T4 (UUID: GPU-00000000-0000-0000-0000-000000000002)"`)
+
+	links, err := s.NVLinks(context.Background())
+	if links != nil || err != nil {
+		t.Errorf("NVLinks = %v, %v, want nil, nil", links, err)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %q, want only nvlink --status", got)
+	}
+}
+
+func TestSetNVLinkErrors(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        map[string]uint64
+		wantErr     bool
+	}{
+		{name: "Replay Errors", value: "3", want: map[string]uint64{"replay": 3}},
+		{name: "CRC Errors", value: "0", want: map[string]uint64{"crc": 0}},
+		{name: "CRC Flit Errors", value: "7", want: map[string]uint64{"crc_flit": 7}},
+		// names the exporter does not know are kept as nvidia-smi prints them
+		{name: "Some Future Errors", value: "1", want: map[string]uint64{"some_future": 1}},
+		{name: "Replay Errors", value: "N/A"},
+		{name: "Replay Errors", value: "many", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var link types.NVLink
+		err := setNVLinkErrors(&link, tt.name, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setNVLinkErrors(%q, %q) error = %v, wantErr %v", tt.name, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(link.Errors, tt.want) {
+			t.Errorf("setNVLinkErrors(%q, %q) = %v, want %v", tt.name, tt.value, link.Errors, tt.want)
+		}
+	}
+}
+
+func TestSetNVLinkData(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        types.NVLink
+		wantErr     bool
+	}{
+		{name: "Data Tx", value: "1024 KiB", want: types.NVLink{TxBytes: 1024 << 10, HasDataCounters: true}},
+		{name: "Data Rx", value: "12", want: types.NVLink{RxBytes: 12 << 10, HasDataCounters: true}},
+		{name: "Data Rx", value: "2 GiB", want: types.NVLink{RxBytes: 2 << 30, HasDataCounters: true}},
+		{name: "Data Tx", value: "N/A"},
+		{name: "Raw Tx", value: "1024 KiB"},
+		{name: "Data Tx", value: "1024 furlongs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var link types.NVLink
+		err := setNVLinkData(&link, tt.name, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setNVLinkData(%q, %q) error = %v, wantErr %v", tt.name, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(link, tt.want) {
+			t.Errorf("setNVLinkData(%q, %q) = %+v, want %+v", tt.name, tt.value, link, tt.want)
+		}
+	}
+}
+
+func TestParseNVLinkOutput(t *testing.T) {
+	output := "GPU 0: NVIDIA H100 80GB HBM3 (UUID: GPU-00000000-0000-0000-0000-000000000000)\n" +
+		"\t Link 0: 26.562 GB/s\n" +
+		"\t Link 17: <inactive>\n" +
+		"unrelated line\n"
+
+	want := []nvlinkGPU{{
+		device: gpuDevice{id: 0, uuid: "GPU-00000000-0000-0000-0000-000000000000", name: "NVIDIA H100 80GB HBM3"},
+		links:  map[int][]string{0: {"26.562 GB/s"}, 17: {"<inactive>"}},
+	}}
+	if got := parseNVLinkOutput(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNVLinkOutput = %+v, want %+v", got, want)
+	}
+}
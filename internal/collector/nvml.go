@@ -0,0 +1,902 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// nvmlLibraryName is the NVML library shipped with the NVIDIA driver.
+const nvmlLibraryName = "libnvidia-ml.so.1"
+
+// nvmlReturn is an NVML result code, nvmlReturn_t.
+type nvmlReturn int32
+
+const (
+	nvmlSuccess                      nvmlReturn = 0
+	nvmlErrorUninitialized           nvmlReturn = 1
+	nvmlErrorInvalidArgument         nvmlReturn = 2
+	nvmlErrorNotSupported            nvmlReturn = 3
+	nvmlErrorNoPermission            nvmlReturn = 4
+	nvmlErrorNotFound                nvmlReturn = 6
+	nvmlErrorInsufficientSize        nvmlReturn = 7
+	nvmlErrorDriverNotLoaded         nvmlReturn = 9
+	nvmlErrorTimeout                 nvmlReturn = 10
+	nvmlErrorLibraryNotFound         nvmlReturn = 12
+	nvmlErrorFunctionNotFound        nvmlReturn = 13
+	nvmlErrorGPUIsLost               nvmlReturn = 15
+	nvmlErrorArgumentVersionMismatch nvmlReturn = 25
+	nvmlErrorUnknown                 nvmlReturn = 999
+)
+
+// nvmlReturnNames are the messages of nvmlErrorString for common codes.
+var nvmlReturnNames = map[nvmlReturn]string{
+	nvmlSuccess:                      "Success",
+	nvmlErrorUninitialized:           "Uninitialized",
+	nvmlErrorInvalidArgument:         "Invalid Argument",
+	nvmlErrorNotSupported:            "Not Supported",
+	nvmlErrorNoPermission:            "Insufficient Permissions",
+	nvmlErrorNotFound:                "Not Found",
+	nvmlErrorInsufficientSize:        "Insufficient Size",
+	nvmlErrorDriverNotLoaded:         "Driver Not Loaded",
+	nvmlErrorTimeout:                 "Timeout",
+	nvmlErrorLibraryNotFound:         "NVML Shared Library Not Found",
+	nvmlErrorFunctionNotFound:        "Function Not Found",
+	nvmlErrorGPUIsLost:               "GPU is lost",
+	nvmlErrorArgumentVersionMismatch: "Argument Version Mismatch",
+	nvmlErrorUnknown:                 "Unknown Error",
+}
+
+func (r nvmlReturn) Error() string {
+	if name, ok := nvmlReturnNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("NVML error %d", int32(r))
+}
+
+// unavailable reports whether r means that a value cannot be read from
+// this GPU or driver, which nvidia-smi shows as N/A, rather than a failure.
+func (r nvmlReturn) unavailable() bool {
+	switch r {
+	case nvmlErrorNotSupported, nvmlErrorNoPermission, nvmlErrorNotFound, nvmlErrorFunctionNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// nvmlDevice is an NVML device handle, nvmlDevice_t.
+type nvmlDevice uintptr
+
+// NVML enumerations, with the values of nvml.h.
+type (
+	nvmlEnableState          uint32
+	nvmlClockType            uint32
+	nvmlTemperatureThreshold uint32
+	nvmlMemoryErrorType      uint32
+	nvmlEccCounterType       uint32
+	nvmlMemoryLocation       uint32
+	nvmlPageRetirementCause  uint32
+	nvmlPcieUtilCounter      uint32
+)
+
+const (
+	nvmlFeatureEnabled nvmlEnableState = 1
+
+	nvmlClockGraphics nvmlClockType = 0
+	nvmlClockSM       nvmlClockType = 1
+	nvmlClockMem      nvmlClockType = 2
+	nvmlClockVideo    nvmlClockType = 3
+
+	nvmlTemperatureThresholdShutdown nvmlTemperatureThreshold = 0
+	nvmlTemperatureThresholdSlowdown nvmlTemperatureThreshold = 1
+	nvmlTemperatureThresholdMemMax   nvmlTemperatureThreshold = 2
+	nvmlTemperatureThresholdGPUMax   nvmlTemperatureThreshold = 3
+
+	nvmlMemoryErrorTypeCorrected   nvmlMemoryErrorType = 0
+	nvmlMemoryErrorTypeUncorrected nvmlMemoryErrorType = 1
+
+	nvmlVolatileECC  nvmlEccCounterType = 0
+	nvmlAggregateECC nvmlEccCounterType = 1
+
+	nvmlMemoryLocationL1Cache       nvmlMemoryLocation = 0
+	nvmlMemoryLocationL2Cache       nvmlMemoryLocation = 1
+	nvmlMemoryLocationDRAM          nvmlMemoryLocation = 2 // device memory before Turing
+	nvmlMemoryLocationRegisterFile  nvmlMemoryLocation = 3
+	nvmlMemoryLocationTextureMemory nvmlMemoryLocation = 4
+	nvmlMemoryLocationCBU           nvmlMemoryLocation = 6
+	nvmlMemoryLocationSRAM          nvmlMemoryLocation = 7
+
+	nvmlPageRetirementMultipleSingleBit nvmlPageRetirementCause = 0
+	nvmlPageRetirementDoubleBit         nvmlPageRetirementCause = 1
+
+	nvmlPcieUtilTxBytes nvmlPcieUtilCounter = 0
+	nvmlPcieUtilRxBytes nvmlPcieUtilCounter = 1
+)
+
+// nvmlClocksEventReason* are the bits of nvmlDeviceGetCurrentClocksEventReasons.
+const (
+	nvmlClocksEventReasonGPUIdle                   uint64 = 0x1
+	nvmlClocksEventReasonApplicationsClocksSetting uint64 = 0x2
+	nvmlClocksEventReasonSWPowerCap                uint64 = 0x4
+	nvmlClocksEventReasonHWSlowdown                uint64 = 0x8
+	nvmlClocksEventReasonSyncBoost                 uint64 = 0x10
+	nvmlClocksEventReasonSWThermalSlowdown         uint64 = 0x20
+	nvmlClocksEventReasonHWThermalSlowdown         uint64 = 0x40
+	nvmlClocksEventReasonHWPowerBrakeSlowdown      uint64 = 0x80
+)
+
+// nvmlValueNotAvailable is reported for the memory of a process that
+// cannot be attributed, and nvmlInstanceIDNone for the instance IDs of a
+// process that is not on a MIG device.
+const (
+	nvmlValueNotAvailable uint64 = 0xFFFFFFFFFFFFFFFF
+	nvmlInstanceIDNone    uint32 = 0xFFFFFFFF
+)
+
+// nvmlComputeModes are the names nvidia-smi uses for nvmlComputeMode_t values.
+var nvmlComputeModes = []string{"Default", "Exclusive_Thread", "Prohibited", "Exclusive_Process"}
+
+// nvmlVirtualizationModes are the names nvidia-smi uses for
+// nvmlGpuVirtualizationMode_t values.
+var nvmlVirtualizationModes = []string{"None", "Pass-Through", "VGPU", vgpuHostMode, "Host VSGA"}
+
+// nvmlFabricStates are the names nvidia-smi uses for nvmlGpuFabricState_t values.
+var nvmlFabricStates = []string{"Not Supported", "Not Started", "In Progress", "Completed"}
+
+// nvmlFabricStateCompleted is the nvmlGpuFabricState_t of a registered GPU.
+const nvmlFabricStateCompleted = 3
+
+// nvmlPciInfo is nvmlPciInfo_t.
+type nvmlPciInfo struct {
+	BusIDLegacy    [16]byte
+	Domain         uint32
+	Bus            uint32
+	Device         uint32
+	PCIDeviceID    uint32
+	PCISubSystemID uint32
+	BusID          [32]byte // e.g. "00000000:3B:00.0"
+}
+
+// nvmlMemory is nvmlMemory_v2_t, in bytes. Reserved is zero for drivers
+// that only implement nvmlMemory_t.
+type nvmlMemory struct {
+	Version  uint32
+	Total    uint64
+	Reserved uint64
+	Free     uint64
+	Used     uint64
+}
+
+// nvmlBAR1Memory is nvmlBAR1Memory_t, in bytes.
+type nvmlBAR1Memory struct {
+	Total uint64
+	Free  uint64
+	Used  uint64
+}
+
+// nvmlUtilization is nvmlUtilization_t, in percent.
+type nvmlUtilization struct {
+	GPU    uint32
+	Memory uint32
+}
+
+// nvmlGpuFabricInfo is nvmlGpuFabricInfo_t.
+type nvmlGpuFabricInfo struct {
+	ClusterUUID [16]byte
+	Status      nvmlReturn
+	CliqueID    uint32
+	State       uint8
+}
+
+// nvmlProcessInfo is nvmlProcessInfo_t.
+type nvmlProcessInfo struct {
+	PID               uint32
+	UsedGPUMemory     uint64 // bytes, or nvmlValueNotAvailable
+	GPUInstanceID     uint32 // or nvmlInstanceIDNone
+	ComputeInstanceID uint32 // or nvmlInstanceIDNone
+}
+
+// nvmlProcessUtilizationSample is nvmlProcessUtilizationSample_t.
+type nvmlProcessUtilizationSample struct {
+	PID       uint32
+	TimeStamp uint64 // microseconds since the epoch
+	SMUtil    uint32 // percent, as are the other utilizations
+	MemUtil   uint32
+	EncUtil   uint32
+	DecUtil   uint32
+}
+
+// nvmlLibrary is the part of the NVML API the NVML source uses. Methods
+// mirror the NVML functions of the same name, with output parameters
+// returned before the result code; the values are zero unless it is
+// nvmlSuccess.
+type nvmlLibrary interface {
+	Init() nvmlReturn
+	Shutdown() nvmlReturn
+	Close() error // unloads the library, which must not be used afterwards
+
+	SystemGetDriverVersion() (string, nvmlReturn)
+	SystemGetCudaDriverVersion() (int, nvmlReturn)
+	SystemGetProcessName(pid int) (string, nvmlReturn)
+
+	DeviceGetCount() (int, nvmlReturn)
+	DeviceGetHandleByIndex(index int) (nvmlDevice, nvmlReturn)
+
+	DeviceGetName(device nvmlDevice) (string, nvmlReturn)
+	DeviceGetUUID(device nvmlDevice) (string, nvmlReturn)
+	DeviceGetSerial(device nvmlDevice) (string, nvmlReturn)
+	DeviceGetPciInfo(device nvmlDevice) (nvmlPciInfo, nvmlReturn)
+	DeviceGetVbiosVersion(device nvmlDevice) (string, nvmlReturn)
+	DeviceGetBoardPartNumber(device nvmlDevice) (string, nvmlReturn)
+
+	DeviceGetMemoryInfo(device nvmlDevice) (nvmlMemory, nvmlReturn)
+	DeviceGetBAR1MemoryInfo(device nvmlDevice) (nvmlBAR1Memory, nvmlReturn)
+	DeviceGetConfComputeProtectedMemoryUsage(device nvmlDevice) (nvmlMemory, nvmlReturn)
+	DeviceGetUtilizationRates(device nvmlDevice) (nvmlUtilization, nvmlReturn)
+	DeviceGetEncoderUtilization(device nvmlDevice) (uint32, nvmlReturn)
+	DeviceGetDecoderUtilization(device nvmlDevice) (uint32, nvmlReturn)
+	DeviceGetEncoderStats(device nvmlDevice) (sessions, averageFPS, averageLatency uint32, ret nvmlReturn)
+
+	DeviceGetTemperature(device nvmlDevice) (uint32, nvmlReturn) // of the GPU die
+	DeviceGetTemperatureThreshold(device nvmlDevice, threshold nvmlTemperatureThreshold) (uint32, nvmlReturn)
+
+	DeviceGetPowerUsage(device nvmlDevice) (uint32, nvmlReturn) // milliwatts, as are the limits
+	DeviceGetPowerManagementLimit(device nvmlDevice) (uint32, nvmlReturn)
+	DeviceGetEnforcedPowerLimit(device nvmlDevice) (uint32, nvmlReturn)
+	DeviceGetPowerManagementLimitConstraints(device nvmlDevice) (minLimit, maxLimit uint32, ret nvmlReturn)
+	DeviceGetPowerManagementDefaultLimit(device nvmlDevice) (uint32, nvmlReturn)
+
+	DeviceGetClockInfo(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn) // MHz, as are the other clocks
+	DeviceGetMaxClockInfo(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn)
+	DeviceGetApplicationsClock(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn)
+	DeviceGetDefaultApplicationsClock(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn)
+	DeviceGetCurrentClocksEventReasons(device nvmlDevice) (uint64, nvmlReturn)
+
+	DeviceGetEccMode(device nvmlDevice) (current, pending nvmlEnableState, ret nvmlReturn)
+	DeviceGetMemoryErrorCounter(device nvmlDevice, errorType nvmlMemoryErrorType, counter nvmlEccCounterType, location nvmlMemoryLocation) (uint64, nvmlReturn)
+	DeviceGetTotalEccErrors(device nvmlDevice, errorType nvmlMemoryErrorType, counter nvmlEccCounterType) (uint64, nvmlReturn)
+	DeviceGetRetiredPages(device nvmlDevice, cause nvmlPageRetirementCause) (int, nvmlReturn) // number of pages
+	DeviceGetRetiredPagesPendingStatus(device nvmlDevice) (nvmlEnableState, nvmlReturn)
+	DeviceGetRemappedRows(device nvmlDevice) (correctable, uncorrectable int, pending, failure bool, ret nvmlReturn)
+
+	DeviceGetCurrPcieLinkGeneration(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetMaxPcieLinkGeneration(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetCurrPcieLinkWidth(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetMaxPcieLinkWidth(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetPcieThroughput(device nvmlDevice, counter nvmlPcieUtilCounter) (uint32, nvmlReturn) // KB/s
+
+	DeviceGetFanSpeed(device nvmlDevice) (uint32, nvmlReturn)
+	DeviceGetPerformanceState(device nvmlDevice) (int, nvmlReturn) // 0 to 15, 32 if unknown
+	DeviceGetComputeMode(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetPersistenceMode(device nvmlDevice) (nvmlEnableState, nvmlReturn)
+	DeviceGetDisplayActive(device nvmlDevice) (nvmlEnableState, nvmlReturn)
+	DeviceGetMigMode(device nvmlDevice) (current, pending int, ret nvmlReturn)
+	DeviceGetVirtualizationMode(device nvmlDevice) (int, nvmlReturn)
+	DeviceGetAccountingMode(device nvmlDevice) (nvmlEnableState, nvmlReturn)
+	DeviceGetGpuFabricInfo(device nvmlDevice) (nvmlGpuFabricInfo, nvmlReturn)
+
+	DeviceGetComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn)
+	DeviceGetGraphicsRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn)
+	DeviceGetMPSComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn)
+	DeviceGetProcessUtilization(device nvmlDevice, lastSeenTimeStamp uint64) ([]nvmlProcessUtilizationSample, nvmlReturn)
+}
+
+// nvmlSource reads GPU metrics, processes and their utilization through
+// NVML, without starting a process. MIG devices, NVLinks, vGPUs, topology
+// and accounting are read with nvidia-smi if it is available.
+type nvmlSource struct {
+	lib nvmlLibrary
+	smi *nvidiaSmiSource // nil if nvidia-smi is not available
+
+	mu       sync.Mutex
+	lastSeen map[int]uint64 // by GPU index, the time stamp of the latest process utilization sample read
+}
+
+// newNVMLSource loads and initializes NVML.
+func newNVMLSource(config types.CollectorConfig) (*nvmlSource, error) {
+	lib, err := openNVML()
+	if err != nil {
+		return nil, err
+	}
+	if ret := lib.Init(); ret != nvmlSuccess {
+		lib.Close()
+		return nil, fmt.Errorf("failed to initialize NVML: %w", ret)
+	}
+
+	s := &nvmlSource{lib: lib}
+
+	smi, err := newNvidiaSmiSource(config)
+	if err != nil {
+		log.Printf("MIG, NVLink, vGPU, topology and accounting metrics disabled: %v", err)
+	} else {
+		s.smi = smi
+	}
+
+	return s, nil
+}
+
+// Close shuts NVML down and unloads it.
+func (s *nvmlSource) Close() error {
+	var errs []error
+	if ret := s.lib.Shutdown(); ret != nvmlSuccess {
+		errs = append(errs, fmt.Errorf("failed to shut down NVML: %w", ret))
+	}
+	if err := s.lib.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to unload NVML: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// nvmlCalls collects the failures of the NVML calls made for one GPU.
+// Values a GPU or driver does not support are left zero without a failure,
+// as nvidia-smi reports them as N/A.
+type nvmlCalls struct {
+	gpu  int
+	errs []error
+}
+
+// check records ret, the result of function, if it is a failure.
+func (c *nvmlCalls) check(function string, ret nvmlReturn) bool {
+	if ret == nvmlSuccess {
+		return true
+	}
+	if !ret.unavailable() {
+		c.errs = append(c.errs, fmt.Errorf("GPU %d: %s: %w", c.gpu, function, ret))
+	}
+	return false
+}
+
+// devices returns the handle of every GPU by index.
+func (s *nvmlSource) devices() ([]nvmlDevice, error) {
+	count, ret := s.lib.DeviceGetCount()
+	if ret != nvmlSuccess {
+		return nil, fmt.Errorf("nvmlDeviceGetCount: %w", ret)
+	}
+
+	devices := make([]nvmlDevice, count)
+	for i := range devices {
+		if devices[i], ret = s.lib.DeviceGetHandleByIndex(i); ret != nvmlSuccess {
+			return nil, fmt.Errorf("nvmlDeviceGetHandleByIndex(%d): %w", i, ret)
+		}
+	}
+	return devices, nil
+}
+
+// GPUs reads current GPU metrics. Values that cannot be read are left zero
+// and reported in the returned error.
+func (s *nvmlSource) GPUs(ctx context.Context) ([]types.GPUMetrics, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	driverVersion, ret := s.lib.SystemGetDriverVersion()
+	if ret != nvmlSuccess && !ret.unavailable() {
+		errs = append(errs, fmt.Errorf("nvmlSystemGetDriverVersion: %w", ret))
+	}
+	var cudaVersion string
+	if version, ret := s.lib.SystemGetCudaDriverVersion(); ret == nvmlSuccess {
+		// e.g. 12040 for 12.4
+		cudaVersion = fmt.Sprintf("%d.%d", version/1000, version%1000/10)
+	}
+
+	now := time.Now()
+	metrics := make([]types.GPUMetrics, 0, len(devices))
+	for i, device := range devices {
+		metric, err := s.deviceMetrics(i, device)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		metric.Timestamp = now
+		metric.DriverVersion = driverVersion
+		metric.CUDAVersion = cudaVersion
+		metrics = append(metrics, metric)
+	}
+
+	if s.smi != nil {
+		s.smi.setState(metrics)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// deviceMetrics reads the metrics of the GPU at index.
+func (s *nvmlSource) deviceMetrics(index int, device nvmlDevice) (types.GPUMetrics, error) {
+	lib := s.lib
+	c := &nvmlCalls{gpu: index}
+	metric := types.GPUMetrics{GPUID: index, PerformanceState: -1}
+
+	var ret nvmlReturn
+	metric.GPUName, ret = lib.DeviceGetName(device)
+	c.check("nvmlDeviceGetName", ret)
+	if metric.GPUName == "" {
+		metric.GPUName = "unknown"
+	}
+	metric.UUID, ret = lib.DeviceGetUUID(device)
+	c.check("nvmlDeviceGetUUID", ret)
+	metric.Serial, ret = lib.DeviceGetSerial(device)
+	c.check("nvmlDeviceGetSerial", ret)
+	pci, ret := lib.DeviceGetPciInfo(device)
+	c.check("nvmlDeviceGetPciInfo", ret)
+	metric.PCIBusID = cString(pci.BusID[:])
+	metric.VBIOSVersion, ret = lib.DeviceGetVbiosVersion(device)
+	c.check("nvmlDeviceGetVbiosVersion", ret)
+	metric.BoardPartNumber, ret = lib.DeviceGetBoardPartNumber(device)
+	c.check("nvmlDeviceGetBoardPartNumber", ret)
+
+	temperature, ret := lib.DeviceGetTemperature(device)
+	c.check("nvmlDeviceGetTemperature", ret)
+	metric.Temperature = float64(temperature)
+	for _, threshold := range []struct {
+		value     *float64
+		threshold nvmlTemperatureThreshold
+	}{
+		{&metric.ShutdownTemperature, nvmlTemperatureThresholdShutdown},
+		{&metric.SlowdownTemperature, nvmlTemperatureThresholdSlowdown},
+		{&metric.MaxOperatingTemperature, nvmlTemperatureThresholdGPUMax},
+		{&metric.MemoryMaxOperatingTemperature, nvmlTemperatureThresholdMemMax},
+	} {
+		value, ret := lib.DeviceGetTemperatureThreshold(device, threshold.threshold)
+		c.check("nvmlDeviceGetTemperatureThreshold", ret)
+		*threshold.value = float64(value)
+	}
+
+	memory, ret := lib.DeviceGetMemoryInfo(device)
+	c.check("nvmlDeviceGetMemoryInfo", ret)
+	metric.TotalMemory = memory.Total
+	metric.ReservedMemory = memory.Reserved
+	metric.FreeMemory = memory.Free
+	metric.UsedMemory = memory.Used
+	bar1, ret := lib.DeviceGetBAR1MemoryInfo(device)
+	c.check("nvmlDeviceGetBAR1MemoryInfo", ret)
+	metric.BAR1TotalMemory = bar1.Total
+	metric.BAR1UsedMemory = bar1.Used
+	protected, ret := lib.DeviceGetConfComputeProtectedMemoryUsage(device)
+	c.check("nvmlDeviceGetConfComputeProtectedMemoryUsage", ret)
+	metric.ProtectedTotalMemory = protected.Total
+	metric.ProtectedUsedMemory = protected.Used
+
+	utilization, ret := lib.DeviceGetUtilizationRates(device)
+	c.check("nvmlDeviceGetUtilizationRates", ret)
+	metric.GPUUtilization = float64(utilization.GPU)
+	metric.MemoryUtilization = float64(utilization.Memory)
+	encoder, ret := lib.DeviceGetEncoderUtilization(device)
+	c.check("nvmlDeviceGetEncoderUtilization", ret)
+	metric.EncoderUtilization = float64(encoder)
+	decoder, ret := lib.DeviceGetDecoderUtilization(device)
+	c.check("nvmlDeviceGetDecoderUtilization", ret)
+	metric.DecoderUtilization = float64(decoder)
+	sessions, fps, latency, ret := lib.DeviceGetEncoderStats(device)
+	c.check("nvmlDeviceGetEncoderStats", ret)
+	metric.EncoderSessions = int(sessions)
+	metric.EncoderAverageFPS = float64(fps)
+	// NVML reports encode latency in microseconds
+	metric.EncoderAverageLatency = float64(latency) / 1e6
+
+	// NVML reports power in milliwatts
+	power, ret := lib.DeviceGetPowerUsage(device)
+	c.check("nvmlDeviceGetPowerUsage", ret)
+	metric.PowerDraw = float64(power) / 1000
+	limit, ret := lib.DeviceGetPowerManagementLimit(device)
+	c.check("nvmlDeviceGetPowerManagementLimit", ret)
+	metric.PowerLimit = float64(limit) / 1000
+	enforced, ret := lib.DeviceGetEnforcedPowerLimit(device)
+	c.check("nvmlDeviceGetEnforcedPowerLimit", ret)
+	metric.EnforcedPowerLimit = float64(enforced) / 1000
+	minLimit, maxLimit, ret := lib.DeviceGetPowerManagementLimitConstraints(device)
+	c.check("nvmlDeviceGetPowerManagementLimitConstraints", ret)
+	metric.PowerMinLimit = float64(minLimit) / 1000
+	metric.PowerMaxLimit = float64(maxLimit) / 1000
+	defaultLimit, ret := lib.DeviceGetPowerManagementDefaultLimit(device)
+	c.check("nvmlDeviceGetPowerManagementDefaultLimit", ret)
+	metric.PowerDefaultLimit = float64(defaultLimit) / 1000
+
+	metric.Clocks = nvmlClocks(c, "nvmlDeviceGetClockInfo", func(clock nvmlClockType) (uint32, nvmlReturn) {
+		return lib.DeviceGetClockInfo(device, clock)
+	}, nvmlClockGraphics, nvmlClockSM, nvmlClockMem, nvmlClockVideo)
+	metric.MaxClocks = nvmlClocks(c, "nvmlDeviceGetMaxClockInfo", func(clock nvmlClockType) (uint32, nvmlReturn) {
+		return lib.DeviceGetMaxClockInfo(device, clock)
+	}, nvmlClockGraphics, nvmlClockSM, nvmlClockMem)
+	metric.ApplicationClocks = nvmlClocks(c, "nvmlDeviceGetApplicationsClock", func(clock nvmlClockType) (uint32, nvmlReturn) {
+		return lib.DeviceGetApplicationsClock(device, clock)
+	}, nvmlClockGraphics, nvmlClockMem)
+	metric.DefaultApplicationClocks = nvmlClocks(c, "nvmlDeviceGetDefaultApplicationsClock", func(clock nvmlClockType) (uint32, nvmlReturn) {
+		return lib.DeviceGetDefaultApplicationsClock(device, clock)
+	}, nvmlClockGraphics, nvmlClockMem)
+
+	reasons, ret := lib.DeviceGetCurrentClocksEventReasons(device)
+	c.check("nvmlDeviceGetCurrentClocksEventReasons", ret)
+	metric.ClockEventReasons = types.ClockEventReasons{
+		GPUIdle:                   reasons&nvmlClocksEventReasonGPUIdle != 0,
+		ApplicationsClocksSetting: reasons&nvmlClocksEventReasonApplicationsClocksSetting != 0,
+		SWPowerCap:                reasons&nvmlClocksEventReasonSWPowerCap != 0,
+		HWSlowdown:                reasons&nvmlClocksEventReasonHWSlowdown != 0,
+		HWThermalSlowdown:         reasons&nvmlClocksEventReasonHWThermalSlowdown != 0,
+		HWPowerBrakeSlowdown:      reasons&nvmlClocksEventReasonHWPowerBrakeSlowdown != 0,
+		SWThermalSlowdown:         reasons&nvmlClocksEventReasonSWThermalSlowdown != 0,
+		SyncBoost:                 reasons&nvmlClocksEventReasonSyncBoost != 0,
+	}
+
+	eccMode, _, ret := lib.DeviceGetEccMode(device)
+	c.check("nvmlDeviceGetEccMode", ret)
+	metric.ECCMode = eccMode == nvmlFeatureEnabled
+	// like nvidia-smi, report no counters while ECC is disabled
+	if metric.ECCMode {
+		metric.ECCCorrectedVolatile = nvmlECCErrors(c, lib, device, nvmlMemoryErrorTypeCorrected, nvmlVolatileECC)
+		metric.ECCUncorrectedVolatile = nvmlECCErrors(c, lib, device, nvmlMemoryErrorTypeUncorrected, nvmlVolatileECC)
+		metric.ECCCorrectedAggregate = nvmlECCErrors(c, lib, device, nvmlMemoryErrorTypeCorrected, nvmlAggregateECC)
+		metric.ECCUncorrectedAggregate = nvmlECCErrors(c, lib, device, nvmlMemoryErrorTypeUncorrected, nvmlAggregateECC)
+	}
+
+	singleBit, ret := lib.DeviceGetRetiredPages(device, nvmlPageRetirementMultipleSingleBit)
+	c.check("nvmlDeviceGetRetiredPages", ret)
+	metric.RetiredPagesSingleBit = uint64(singleBit)
+	doubleBit, ret := lib.DeviceGetRetiredPages(device, nvmlPageRetirementDoubleBit)
+	c.check("nvmlDeviceGetRetiredPages", ret)
+	metric.RetiredPagesDoubleBit = uint64(doubleBit)
+	pendingRetirement, ret := lib.DeviceGetRetiredPagesPendingStatus(device)
+	c.check("nvmlDeviceGetRetiredPagesPendingStatus", ret)
+	metric.RetiredPagesPending = pendingRetirement == nvmlFeatureEnabled
+	correctable, uncorrectable, pending, failure, ret := lib.DeviceGetRemappedRows(device)
+	c.check("nvmlDeviceGetRemappedRows", ret)
+	metric.RemappedRowsCorrectable = uint64(correctable)
+	metric.RemappedRowsUncorrectable = uint64(uncorrectable)
+	metric.RemappedRowsPending = pending
+	metric.RemappedRowsFailure = failure
+
+	metric.PCIeLinkGen, ret = lib.DeviceGetCurrPcieLinkGeneration(device)
+	c.check("nvmlDeviceGetCurrPcieLinkGeneration", ret)
+	metric.PCIeLinkGenMax, ret = lib.DeviceGetMaxPcieLinkGeneration(device)
+	c.check("nvmlDeviceGetMaxPcieLinkGeneration", ret)
+	metric.PCIeLinkWidth, ret = lib.DeviceGetCurrPcieLinkWidth(device)
+	c.check("nvmlDeviceGetCurrPcieLinkWidth", ret)
+	metric.PCIeLinkWidthMax, ret = lib.DeviceGetMaxPcieLinkWidth(device)
+	c.check("nvmlDeviceGetMaxPcieLinkWidth", ret)
+	rx, ret := lib.DeviceGetPcieThroughput(device, nvmlPcieUtilRxBytes)
+	c.check("nvmlDeviceGetPcieThroughput", ret)
+	metric.PCIeRxThroughput = float64(rx) * float64(byteUnits["KB"])
+	tx, ret := lib.DeviceGetPcieThroughput(device, nvmlPcieUtilTxBytes)
+	c.check("nvmlDeviceGetPcieThroughput", ret)
+	metric.PCIeTxThroughput = float64(tx) * float64(byteUnits["KB"])
+
+	fan, ret := lib.DeviceGetFanSpeed(device)
+	c.check("nvmlDeviceGetFanSpeed", ret)
+	metric.FanSpeed = float64(fan)
+	if state, ret := lib.DeviceGetPerformanceState(device); c.check("nvmlDeviceGetPerformanceState", ret) && state <= 15 {
+		metric.PerformanceState = state
+	}
+	if mode, ret := lib.DeviceGetComputeMode(device); c.check("nvmlDeviceGetComputeMode", ret) && mode < len(nvmlComputeModes) {
+		metric.ComputeMode = nvmlComputeModes[mode]
+	}
+	persistence, ret := lib.DeviceGetPersistenceMode(device)
+	c.check("nvmlDeviceGetPersistenceMode", ret)
+	metric.PersistenceMode = persistence == nvmlFeatureEnabled
+	display, ret := lib.DeviceGetDisplayActive(device)
+	c.check("nvmlDeviceGetDisplayActive", ret)
+	metric.DisplayActive = display == nvmlFeatureEnabled
+	migMode, _, ret := lib.DeviceGetMigMode(device)
+	c.check("nvmlDeviceGetMigMode", ret)
+	metric.MIGMode = migMode == 1
+	if mode, ret := lib.DeviceGetVirtualizationMode(device); c.check("nvmlDeviceGetVirtualizationMode", ret) && mode < len(nvmlVirtualizationModes) {
+		metric.VirtualizationMode = nvmlVirtualizationModes[mode]
+	}
+	accounting, ret := lib.DeviceGetAccountingMode(device)
+	c.check("nvmlDeviceGetAccountingMode", ret)
+	metric.AccountingMode = accounting == nvmlFeatureEnabled
+
+	if fabric, ret := lib.DeviceGetGpuFabricInfo(device); c.check("nvmlDeviceGetGpuFabricInfo", ret) {
+		metric.Fabric = nvmlFabric(fabric)
+	}
+
+	return metric, errors.Join(c.errs...)
+}
+
+// nvmlClocks reads the given clock domains with get.
+func nvmlClocks(c *nvmlCalls, function string, get func(nvmlClockType) (uint32, nvmlReturn), clocks ...nvmlClockType) types.GPUClocks {
+	var result types.GPUClocks
+	for _, clock := range clocks {
+		value, ret := get(clock)
+		c.check(function, ret)
+
+		switch clock {
+		case nvmlClockGraphics:
+			result.Graphics = float64(value)
+		case nvmlClockSM:
+			result.SM = float64(value)
+		case nvmlClockMem:
+			result.Memory = float64(value)
+		case nvmlClockVideo:
+			result.Video = float64(value)
+		}
+	}
+	return result
+}
+
+// nvmlECCErrors reads the ECC error counts of each memory location. NVML
+// has a single location for DRAM, which older GPUs call device memory; it
+// is reported as DRAM.
+func nvmlECCErrors(c *nvmlCalls, lib nvmlLibrary, device nvmlDevice, errorType nvmlMemoryErrorType, counter nvmlEccCounterType) types.ECCErrors {
+	var ecc types.ECCErrors
+	for _, location := range []struct {
+		value    *uint64
+		location nvmlMemoryLocation
+	}{
+		{&ecc.L1Cache, nvmlMemoryLocationL1Cache},
+		{&ecc.L2Cache, nvmlMemoryLocationL2Cache},
+		{&ecc.DRAM, nvmlMemoryLocationDRAM},
+		{&ecc.RegisterFile, nvmlMemoryLocationRegisterFile},
+		{&ecc.TextureMemory, nvmlMemoryLocationTextureMemory},
+		{&ecc.CBU, nvmlMemoryLocationCBU},
+		{&ecc.SRAM, nvmlMemoryLocationSRAM},
+	} {
+		var ret nvmlReturn
+		*location.value, ret = lib.DeviceGetMemoryErrorCounter(device, errorType, counter, location.location)
+		c.check("nvmlDeviceGetMemoryErrorCounter", ret)
+	}
+
+	var ret nvmlReturn
+	ecc.Total, ret = lib.DeviceGetTotalEccErrors(device, errorType, counter)
+	c.check("nvmlDeviceGetTotalEccErrors", ret)
+
+	return ecc
+}
+
+// nvmlFabric converts the NVLink fabric state of a GPU.
+func nvmlFabric(info nvmlGpuFabricInfo) types.GPUFabric {
+	var fabric types.GPUFabric
+	if int(info.State) < len(nvmlFabricStates) {
+		fabric.State = nvmlFabricStates[info.State]
+	}
+	if info.State != nvmlFabricStateCompleted {
+		return fabric
+	}
+
+	fabric.Status = info.Status.Error()
+	fabric.CliqueID = strconv.FormatUint(uint64(info.CliqueID), 10)
+	u := info.ClusterUUID
+	fabric.ClusterUUID = fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+	return fabric
+}
+
+// GPUMapping gets the mapping from GPU UUID to GPU index.
+func (s *nvmlSource) GPUMapping(ctx context.Context) (map[string]int, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]int, len(devices))
+	for i, device := range devices {
+		uuid, ret := s.lib.DeviceGetUUID(device)
+		if ret != nvmlSuccess {
+			return nil, fmt.Errorf("nvmlDeviceGetUUID: %w", ret)
+		}
+		mapping[uuid] = i
+	}
+	return mapping, nil
+}
+
+// ComputeApps lists the compute, graphics and MPS client processes of every
+// GPU. Processes on MIG devices carry the parent GPU's UUID and their
+// instance IDs. Process names come from NVML and are empty if it cannot
+// read them. GPUs whose processes cannot be listed are skipped and
+// reported in the returned error.
+func (s *nvmlSource) ComputeApps(ctx context.Context) ([]ComputeApp, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var apps []ComputeApp
+	var errs []error
+	for i, device := range devices {
+		uuid, ret := s.lib.DeviceGetUUID(device)
+		if ret != nvmlSuccess {
+			errs = append(errs, fmt.Errorf("GPU %d: nvmlDeviceGetUUID: %w", i, ret))
+			continue
+		}
+
+		processes, err := s.deviceProcesses(i, device)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, process := range processes {
+			apps = append(apps, ComputeApp{
+				Timestamp:     now,
+				GPUUUID:       uuid,
+				PID:           process.pid,
+				ProcessName:   process.name,
+				UsedGPUMemory: process.usedGPUMemory,
+				Type:          processType(process),
+
+				GPUInstanceID:     process.gpuInstanceID,
+				ComputeInstanceID: process.computeInstanceID,
+			})
+		}
+	}
+
+	return apps, errors.Join(errs...)
+}
+
+// deviceProcesses merges the process lists of a GPU into entries shaped like
+// those of nvidia-smi -q, typed "C", "G", "C+G" or "M+C".
+func (s *nvmlSource) deviceProcesses(index int, device nvmlDevice) ([]detailProcess, error) {
+	c := &nvmlCalls{gpu: index}
+
+	type processKey struct {
+		pid, gpuInstanceID, computeInstanceID int
+	}
+	var processes []detailProcess
+	byKey := make(map[processKey]int)
+
+	for _, list := range []struct {
+		function    string
+		get         func(nvmlDevice) ([]nvmlProcessInfo, nvmlReturn)
+		processType string
+	}{
+		{"nvmlDeviceGetComputeRunningProcesses", s.lib.DeviceGetComputeRunningProcesses, "C"},
+		{"nvmlDeviceGetGraphicsRunningProcesses", s.lib.DeviceGetGraphicsRunningProcesses, "G"},
+		{"nvmlDeviceGetMPSComputeRunningProcesses", s.lib.DeviceGetMPSComputeRunningProcesses, "M+C"},
+	} {
+		infos, ret := list.get(device)
+		if !c.check(list.function, ret) {
+			continue
+		}
+
+		for _, info := range infos {
+			process := detailProcess{
+				pid:               int(info.PID),
+				processType:       list.processType,
+				gpuInstanceID:     nvmlInstanceID(info.GPUInstanceID),
+				computeInstanceID: nvmlInstanceID(info.ComputeInstanceID),
+			}
+			if info.UsedGPUMemory != nvmlValueNotAvailable {
+				process.usedGPUMemory = info.UsedGPUMemory
+			}
+
+			key := processKey{process.pid, process.gpuInstanceID, process.computeInstanceID}
+			if i, ok := byKey[key]; ok {
+				// listed as both a compute and a graphics process
+				if processes[i].processType == "C" && list.processType == "G" {
+					processes[i].processType = "C+G"
+				}
+				continue
+			}
+
+			process.name, _ = s.lib.SystemGetProcessName(process.pid)
+			byKey[key] = len(processes)
+			processes = append(processes, process)
+		}
+	}
+
+	return processes, errors.Join(c.errs...)
+}
+
+// ProcessUtilization reads per-process engine utilization from the samples
+// NVML took since the last call, or from all it holds on the first call,
+// using the latest sample of each process. Processes without a sample since
+// then are left out, as are GPUs that do not sample processes, such as GPUs
+// in MIG mode. GPUs whose samples cannot be read are reported in the
+// returned error.
+func (s *nvmlSource) ProcessUtilization(ctx context.Context) ([]ProcessUtilization, error) {
+	devices, err := s.devices()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastSeen == nil {
+		s.lastSeen = make(map[int]uint64, len(devices))
+	}
+
+	var utilization []ProcessUtilization
+	var errs []error
+	for i, device := range devices {
+		c := &nvmlCalls{gpu: i}
+		samples, ret := s.lib.DeviceGetProcessUtilization(device, s.lastSeen[i])
+		if !c.check("nvmlDeviceGetProcessUtilization", ret) {
+			errs = append(errs, c.errs...)
+			continue
+		}
+
+		latest := make(map[uint32]nvmlProcessUtilizationSample, len(samples))
+		var pids []uint32
+		for _, sample := range samples {
+			previous, ok := latest[sample.PID]
+			if !ok {
+				pids = append(pids, sample.PID)
+			}
+			if !ok || sample.TimeStamp > previous.TimeStamp {
+				latest[sample.PID] = sample
+			}
+			s.lastSeen[i] = max(s.lastSeen[i], sample.TimeStamp)
+		}
+
+		for _, pid := range pids {
+			sample := latest[pid]
+			utilization = append(utilization, ProcessUtilization{
+				GPUID:   i,
+				PID:     int(pid),
+				SM:      float64(sample.SMUtil),
+				Memory:  float64(sample.MemUtil),
+				Encoder: float64(sample.EncUtil),
+				Decoder: float64(sample.DecUtil),
+			})
+		}
+	}
+
+	return utilization, errors.Join(errs...)
+}
+
+// nvmlInstanceID converts a MIG instance ID, returning -1 if there is none.
+func nvmlInstanceID(id uint32) int {
+	if id == nvmlInstanceIDNone {
+		return -1
+	}
+	return int(id)
+}
+
+// The capabilities below are read with nvidia-smi, if available. Without
+// it they report nothing.
+
+// MIGDevices enumerates MIG devices with nvidia-smi.
+func (s *nvmlSource) MIGDevices(ctx context.Context) ([]types.MIGDevice, error) {
+	if s.smi == nil {
+		return nil, nil
+	}
+	return s.smi.MIGDevices(ctx)
+}
+
+// NVLinks reads NVLink state and counters with nvidia-smi.
+func (s *nvmlSource) NVLinks(ctx context.Context) ([]types.NVLink, error) {
+	if s.smi == nil {
+		return nil, nil
+	}
+	return s.smi.NVLinks(ctx)
+}
+
+// VGPUs enumerates vGPU instances with nvidia-smi.
+func (s *nvmlSource) VGPUs(ctx context.Context) ([]types.VGPU, error) {
+	if s.smi == nil {
+		return nil, nil
+	}
+	return s.smi.VGPUs(ctx)
+}
+
+// Topology reads the GPU topology with nvidia-smi.
+func (s *nvmlSource) Topology(ctx context.Context) (*types.Topology, error) {
+	if s.smi == nil {
+		return nil, nil
+	}
+	return s.smi.Topology(ctx)
+}
+
+// AccountedApps reads the accounting buffers with nvidia-smi.
+func (s *nvmlSource) AccountedApps(ctx context.Context) ([]AccountedApp, error) {
+	if s.smi == nil {
+		return nil, nil
+	}
+	return s.smi.AccountedApps(ctx)
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,740 @@
+//go:build linux && (amd64 || arm64)
+
+package collector
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// NVML buffer sizes from nvml.h.
+const (
+	nvmlDeviceNameBufferSize          = 96
+	nvmlDeviceUUIDBufferSize          = 96
+	nvmlDeviceSerialBufferSize        = 30
+	nvmlDeviceVbiosVersionBufferSize  = 32
+	nvmlDevicePartNumberBufferSize    = 80
+	nvmlSystemDriverVersionBufferSize = 80
+	nvmlProcessNameBufferSize         = 256
+)
+
+// nvmlMemoryV2 is the version of nvmlMemory_v2_t for nvmlDeviceGetMemoryInfo_v2.
+const nvmlMemoryV2 = uint32(unsafe.Sizeof(nvmlMemory{})) | 2<<24
+
+// nvmlMemoryV1 is nvmlMemory_t.
+type nvmlMemoryV1 struct {
+	Total uint64
+	Free  uint64
+	Used  uint64
+}
+
+// nvmlGpuFabricInfoV is nvmlGpuFabricInfoV_t.
+type nvmlGpuFabricInfoV struct {
+	Version     uint32
+	ClusterUUID [16]byte
+	Status      nvmlReturn
+	CliqueID    uint32
+	State       uint8
+	HealthMask  uint32
+}
+
+// nvmlGpuFabricInfoVersion is the version of nvmlGpuFabricInfoV_t for
+// nvmlDeviceGetGpuFabricInfoV.
+const nvmlGpuFabricInfoVersion = uint32(unsafe.Sizeof(nvmlGpuFabricInfoV{})) | 2<<24
+
+// nvmlProcessInfoV2 is nvmlProcessInfo_v2_t, as filled by the _v2 and _v3
+// process listing functions.
+type nvmlProcessInfoV2 struct {
+	PID               uint32
+	_                 uint32
+	UsedGPUMemory     uint64
+	GPUInstanceID     uint32
+	ComputeInstanceID uint32
+}
+
+// Signatures shared by several NVML functions.
+type (
+	nvmlStringFunc     func(device nvmlDevice, value *byte, length uint32) nvmlReturn
+	nvmlUintFunc       func(device nvmlDevice, value *uint32) nvmlReturn
+	nvmlUintByFunc     func(device nvmlDevice, by uint32, value *uint32) nvmlReturn
+	nvmlIntFunc        func(device nvmlDevice, value *int32) nvmlReturn
+	nvmlStateFunc      func(device nvmlDevice, value *nvmlEnableState) nvmlReturn
+	nvmlProcessesFunc  func(device nvmlDevice, count *uint32, infos *nvmlProcessInfoV2) nvmlReturn
+	nvmlMemoryInfoFunc func(device nvmlDevice, memory *nvmlMemory) nvmlReturn
+)
+
+// dlNVML calls NVML in a library opened at runtime, so that the exporter
+// builds without cgo and runs on hosts without the library. Functions the
+// driver does not export are nil and return nvmlErrorFunctionNotFound.
+type dlNVML struct {
+	handle uintptr
+
+	init                     func() nvmlReturn
+	shutdown                 func() nvmlReturn
+	systemGetDriverVersion   func(version *byte, length uint32) nvmlReturn
+	systemGetCudaVersion     func(version *int32) nvmlReturn
+	systemGetProcessName     func(pid uint32, name *byte, length uint32) nvmlReturn
+	deviceGetCount           func(count *uint32) nvmlReturn
+	deviceGetHandleByIndex   func(index uint32, device *nvmlDevice) nvmlReturn
+	deviceGetName            nvmlStringFunc
+	deviceGetUUID            nvmlStringFunc
+	deviceGetSerial          nvmlStringFunc
+	deviceGetPciInfo         func(device nvmlDevice, pci *nvmlPciInfo) nvmlReturn
+	deviceGetVbiosVersion    nvmlStringFunc
+	deviceGetBoardPartNumber nvmlStringFunc
+
+	deviceGetMemoryInfoV2          nvmlMemoryInfoFunc
+	deviceGetMemoryInfo            func(device nvmlDevice, memory *nvmlMemoryV1) nvmlReturn
+	deviceGetBAR1MemoryInfo        func(device nvmlDevice, memory *nvmlBAR1Memory) nvmlReturn
+	deviceGetConfComputeProtected  func(device nvmlDevice, memory *nvmlMemoryV1) nvmlReturn
+	deviceGetUtilizationRates      func(device nvmlDevice, utilization *nvmlUtilization) nvmlReturn
+	deviceGetEncoderUtilization    func(device nvmlDevice, utilization, samplingPeriod *uint32) nvmlReturn
+	deviceGetDecoderUtilization    func(device nvmlDevice, utilization, samplingPeriod *uint32) nvmlReturn
+	deviceGetEncoderStats          func(device nvmlDevice, sessions, averageFPS, averageLatency *uint32) nvmlReturn
+	deviceGetTemperature           nvmlUintByFunc
+	deviceGetTemperatureThreshold  nvmlUintByFunc
+	deviceGetPowerUsage            nvmlUintFunc
+	deviceGetPowerManagementLimit  nvmlUintFunc
+	deviceGetEnforcedPowerLimit    nvmlUintFunc
+	deviceGetPowerLimitConstraints func(device nvmlDevice, minLimit, maxLimit *uint32) nvmlReturn
+	deviceGetPowerDefaultLimit     nvmlUintFunc
+
+	deviceGetClockInfo                 nvmlUintByFunc
+	deviceGetMaxClockInfo              nvmlUintByFunc
+	deviceGetApplicationsClock         nvmlUintByFunc
+	deviceGetDefaultApplicationsClock  nvmlUintByFunc
+	deviceGetCurrentClocksEventReasons func(device nvmlDevice, reasons *uint64) nvmlReturn
+
+	deviceGetEccMode                   func(device nvmlDevice, current, pending *nvmlEnableState) nvmlReturn
+	deviceGetMemoryErrorCounter        func(device nvmlDevice, errorType, counter, location uint32, count *uint64) nvmlReturn
+	deviceGetTotalEccErrors            func(device nvmlDevice, errorType, counter uint32, count *uint64) nvmlReturn
+	deviceGetRetiredPages              func(device nvmlDevice, cause uint32, count *uint32, addresses *uint64) nvmlReturn
+	deviceGetRetiredPagesPendingStatus nvmlStateFunc
+	deviceGetRemappedRows              func(device nvmlDevice, correctable, uncorrectable, pending, failure *uint32) nvmlReturn
+
+	deviceGetCurrPcieLinkGeneration nvmlUintFunc
+	deviceGetMaxPcieLinkGeneration  nvmlUintFunc
+	deviceGetCurrPcieLinkWidth      nvmlUintFunc
+	deviceGetMaxPcieLinkWidth       nvmlUintFunc
+	deviceGetPcieThroughput         nvmlUintByFunc
+
+	deviceGetFanSpeed           nvmlUintFunc
+	deviceGetPerformanceState   nvmlIntFunc
+	deviceGetComputeMode        nvmlIntFunc
+	deviceGetPersistenceMode    nvmlStateFunc
+	deviceGetDisplayActive      nvmlStateFunc
+	deviceGetMigMode            func(device nvmlDevice, current, pending *uint32) nvmlReturn
+	deviceGetVirtualizationMode nvmlIntFunc
+	deviceGetAccountingMode     nvmlStateFunc
+	deviceGetGpuFabricInfoV     func(device nvmlDevice, info *nvmlGpuFabricInfoV) nvmlReturn
+
+	deviceGetComputeRunningProcesses    nvmlProcessesFunc
+	deviceGetGraphicsRunningProcesses   nvmlProcessesFunc
+	deviceGetMPSComputeRunningProcesses nvmlProcessesFunc
+	deviceGetProcessUtilization         func(device nvmlDevice, samples *nvmlProcessUtilizationSample, count *uint32, lastSeenTimeStamp uint64) nvmlReturn
+}
+
+// openNVML loads the NVML library and binds the functions it exports.
+func openNVML() (nvmlLibrary, error) {
+	handle, err := purego.Dlopen(nvmlLibraryName, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", nvmlLibraryName, err)
+	}
+
+	l := &dlNVML{handle: handle}
+	if !l.bind(&l.init, "nvmlInit_v2", "nvmlInit") {
+		purego.Dlclose(handle)
+		return nil, fmt.Errorf("%s does not export nvmlInit", nvmlLibraryName)
+	}
+
+	// newer versions of a function are preferred, older names are kept by
+	// drivers for compatibility
+	l.bind(&l.shutdown, "nvmlShutdown")
+	l.bind(&l.systemGetDriverVersion, "nvmlSystemGetDriverVersion")
+	l.bind(&l.systemGetCudaVersion, "nvmlSystemGetCudaDriverVersion_v2", "nvmlSystemGetCudaDriverVersion")
+	l.bind(&l.systemGetProcessName, "nvmlSystemGetProcessName")
+	l.bind(&l.deviceGetCount, "nvmlDeviceGetCount_v2", "nvmlDeviceGetCount")
+	l.bind(&l.deviceGetHandleByIndex, "nvmlDeviceGetHandleByIndex_v2", "nvmlDeviceGetHandleByIndex")
+	l.bind(&l.deviceGetName, "nvmlDeviceGetName")
+	l.bind(&l.deviceGetUUID, "nvmlDeviceGetUUID")
+	l.bind(&l.deviceGetSerial, "nvmlDeviceGetSerial")
+	l.bind(&l.deviceGetPciInfo, "nvmlDeviceGetPciInfo_v3")
+	l.bind(&l.deviceGetVbiosVersion, "nvmlDeviceGetVbiosVersion")
+	l.bind(&l.deviceGetBoardPartNumber, "nvmlDeviceGetBoardPartNumber")
+
+	l.bind(&l.deviceGetMemoryInfoV2, "nvmlDeviceGetMemoryInfo_v2")
+	l.bind(&l.deviceGetMemoryInfo, "nvmlDeviceGetMemoryInfo")
+	l.bind(&l.deviceGetBAR1MemoryInfo, "nvmlDeviceGetBAR1MemoryInfo")
+	l.bind(&l.deviceGetConfComputeProtected, "nvmlDeviceGetConfComputeProtectedMemoryUsage")
+	l.bind(&l.deviceGetUtilizationRates, "nvmlDeviceGetUtilizationRates")
+	l.bind(&l.deviceGetEncoderUtilization, "nvmlDeviceGetEncoderUtilization")
+	l.bind(&l.deviceGetDecoderUtilization, "nvmlDeviceGetDecoderUtilization")
+	l.bind(&l.deviceGetEncoderStats, "nvmlDeviceGetEncoderStats")
+	l.bind(&l.deviceGetTemperature, "nvmlDeviceGetTemperature")
+	l.bind(&l.deviceGetTemperatureThreshold, "nvmlDeviceGetTemperatureThreshold")
+	l.bind(&l.deviceGetPowerUsage, "nvmlDeviceGetPowerUsage")
+	l.bind(&l.deviceGetPowerManagementLimit, "nvmlDeviceGetPowerManagementLimit")
+	l.bind(&l.deviceGetEnforcedPowerLimit, "nvmlDeviceGetEnforcedPowerLimit")
+	l.bind(&l.deviceGetPowerLimitConstraints, "nvmlDeviceGetPowerManagementLimitConstraints")
+	l.bind(&l.deviceGetPowerDefaultLimit, "nvmlDeviceGetPowerManagementDefaultLimit")
+
+	l.bind(&l.deviceGetClockInfo, "nvmlDeviceGetClockInfo")
+	l.bind(&l.deviceGetMaxClockInfo, "nvmlDeviceGetMaxClockInfo")
+	l.bind(&l.deviceGetApplicationsClock, "nvmlDeviceGetApplicationsClock")
+	l.bind(&l.deviceGetDefaultApplicationsClock, "nvmlDeviceGetDefaultApplicationsClock")
+	l.bind(&l.deviceGetCurrentClocksEventReasons, "nvmlDeviceGetCurrentClocksEventReasons", "nvmlDeviceGetCurrentClocksThrottleReasons")
+
+	l.bind(&l.deviceGetEccMode, "nvmlDeviceGetEccMode")
+	l.bind(&l.deviceGetMemoryErrorCounter, "nvmlDeviceGetMemoryErrorCounter")
+	l.bind(&l.deviceGetTotalEccErrors, "nvmlDeviceGetTotalEccErrors")
+	l.bind(&l.deviceGetRetiredPages, "nvmlDeviceGetRetiredPages")
+	l.bind(&l.deviceGetRetiredPagesPendingStatus, "nvmlDeviceGetRetiredPagesPendingStatus")
+	l.bind(&l.deviceGetRemappedRows, "nvmlDeviceGetRemappedRows")
+
+	l.bind(&l.deviceGetCurrPcieLinkGeneration, "nvmlDeviceGetCurrPcieLinkGeneration")
+	l.bind(&l.deviceGetMaxPcieLinkGeneration, "nvmlDeviceGetMaxPcieLinkGeneration")
+	l.bind(&l.deviceGetCurrPcieLinkWidth, "nvmlDeviceGetCurrPcieLinkWidth")
+	l.bind(&l.deviceGetMaxPcieLinkWidth, "nvmlDeviceGetMaxPcieLinkWidth")
+	l.bind(&l.deviceGetPcieThroughput, "nvmlDeviceGetPcieThroughput")
+
+	l.bind(&l.deviceGetFanSpeed, "nvmlDeviceGetFanSpeed")
+	l.bind(&l.deviceGetPerformanceState, "nvmlDeviceGetPerformanceState")
+	l.bind(&l.deviceGetComputeMode, "nvmlDeviceGetComputeMode")
+	l.bind(&l.deviceGetPersistenceMode, "nvmlDeviceGetPersistenceMode")
+	l.bind(&l.deviceGetDisplayActive, "nvmlDeviceGetDisplayActive")
+	l.bind(&l.deviceGetMigMode, "nvmlDeviceGetMigMode")
+	l.bind(&l.deviceGetVirtualizationMode, "nvmlDeviceGetVirtualizationMode")
+	l.bind(&l.deviceGetAccountingMode, "nvmlDeviceGetAccountingMode")
+	l.bind(&l.deviceGetGpuFabricInfoV, "nvmlDeviceGetGpuFabricInfoV")
+
+	l.bind(&l.deviceGetComputeRunningProcesses, "nvmlDeviceGetComputeRunningProcesses_v3", "nvmlDeviceGetComputeRunningProcesses_v2")
+	l.bind(&l.deviceGetGraphicsRunningProcesses, "nvmlDeviceGetGraphicsRunningProcesses_v3", "nvmlDeviceGetGraphicsRunningProcesses_v2")
+	l.bind(&l.deviceGetMPSComputeRunningProcesses, "nvmlDeviceGetMPSComputeRunningProcesses_v3", "nvmlDeviceGetMPSComputeRunningProcesses_v2")
+	l.bind(&l.deviceGetProcessUtilization, "nvmlDeviceGetProcessUtilization")
+
+	return l, nil
+}
+
+// bind sets fptr, a pointer to a func field, to the first of names the
+// library exports. It reports whether one was found.
+func (l *dlNVML) bind(fptr any, names ...string) bool {
+	for _, name := range names {
+		if sym, err := purego.Dlsym(l.handle, name); err == nil && sym != 0 {
+			purego.RegisterFunc(fptr, sym)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *dlNVML) Init() nvmlReturn {
+	return l.init()
+}
+
+func (l *dlNVML) Close() error {
+	return purego.Dlclose(l.handle)
+}
+
+func (l *dlNVML) Shutdown() nvmlReturn {
+	if l.shutdown == nil {
+		return nvmlErrorFunctionNotFound
+	}
+	return l.shutdown()
+}
+
+func (l *dlNVML) SystemGetDriverVersion() (string, nvmlReturn) {
+	if l.systemGetDriverVersion == nil {
+		return "", nvmlErrorFunctionNotFound
+	}
+	buf := make([]byte, nvmlSystemDriverVersionBufferSize)
+	if ret := l.systemGetDriverVersion(&buf[0], uint32(len(buf))); ret != nvmlSuccess {
+		return "", ret
+	}
+	return cString(buf), nvmlSuccess
+}
+
+func (l *dlNVML) SystemGetCudaDriverVersion() (int, nvmlReturn) {
+	if l.systemGetCudaVersion == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var version int32
+	if ret := l.systemGetCudaVersion(&version); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return int(version), nvmlSuccess
+}
+
+func (l *dlNVML) SystemGetProcessName(pid int) (string, nvmlReturn) {
+	if l.systemGetProcessName == nil {
+		return "", nvmlErrorFunctionNotFound
+	}
+	buf := make([]byte, nvmlProcessNameBufferSize)
+	if ret := l.systemGetProcessName(uint32(pid), &buf[0], uint32(len(buf))); ret != nvmlSuccess {
+		return "", ret
+	}
+	return cString(buf), nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetCount() (int, nvmlReturn) {
+	if l.deviceGetCount == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var count uint32
+	if ret := l.deviceGetCount(&count); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return int(count), nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetHandleByIndex(index int) (nvmlDevice, nvmlReturn) {
+	if l.deviceGetHandleByIndex == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var device nvmlDevice
+	if ret := l.deviceGetHandleByIndex(uint32(index), &device); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return device, nvmlSuccess
+}
+
+// text calls a function that writes a string of at most size bytes.
+func (l *dlNVML) text(fn nvmlStringFunc, device nvmlDevice, size int) (string, nvmlReturn) {
+	if fn == nil {
+		return "", nvmlErrorFunctionNotFound
+	}
+	buf := make([]byte, size)
+	if ret := fn(device, &buf[0], uint32(size)); ret != nvmlSuccess {
+		return "", ret
+	}
+	return cString(buf), nvmlSuccess
+}
+
+// unsigned calls a function that writes an unsigned int.
+func (l *dlNVML) unsigned(fn nvmlUintFunc, device nvmlDevice) (uint32, nvmlReturn) {
+	if fn == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var value uint32
+	if ret := fn(device, &value); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return value, nvmlSuccess
+}
+
+// unsignedBy calls a function that writes an unsigned int selected by an
+// enumeration such as a clock type.
+func (l *dlNVML) unsignedBy(fn nvmlUintByFunc, device nvmlDevice, by uint32) (uint32, nvmlReturn) {
+	if fn == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var value uint32
+	if ret := fn(device, by, &value); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return value, nvmlSuccess
+}
+
+// enum calls a function that writes an enumeration.
+func (l *dlNVML) enum(fn nvmlIntFunc, device nvmlDevice) (int, nvmlReturn) {
+	if fn == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var value int32
+	if ret := fn(device, &value); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return int(value), nvmlSuccess
+}
+
+// enabled calls a function that writes an nvmlEnableState_t.
+func (l *dlNVML) enabled(fn nvmlStateFunc, device nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	if fn == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var value nvmlEnableState
+	if ret := fn(device, &value); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return value, nvmlSuccess
+}
+
+// processes calls a process listing function, growing the buffer until the
+// processes fit.
+func (l *dlNVML) processes(fn nvmlProcessesFunc, device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	if fn == nil {
+		return nil, nvmlErrorFunctionNotFound
+	}
+
+	var count uint32
+	ret := fn(device, &count, nil)
+	var infos []nvmlProcessInfoV2
+	for ret == nvmlErrorInsufficientSize {
+		// leave room for processes started in between
+		infos = make([]nvmlProcessInfoV2, count+8)
+		count = uint32(len(infos))
+		ret = fn(device, &count, &infos[0])
+	}
+	if ret != nvmlSuccess {
+		return nil, ret
+	}
+
+	processes := make([]nvmlProcessInfo, 0, count)
+	for _, info := range infos[:count] {
+		processes = append(processes, nvmlProcessInfo{
+			PID:               info.PID,
+			UsedGPUMemory:     info.UsedGPUMemory,
+			GPUInstanceID:     info.GPUInstanceID,
+			ComputeInstanceID: info.ComputeInstanceID,
+		})
+	}
+	return processes, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetName(device nvmlDevice) (string, nvmlReturn) {
+	return l.text(l.deviceGetName, device, nvmlDeviceNameBufferSize)
+}
+
+func (l *dlNVML) DeviceGetUUID(device nvmlDevice) (string, nvmlReturn) {
+	return l.text(l.deviceGetUUID, device, nvmlDeviceUUIDBufferSize)
+}
+
+func (l *dlNVML) DeviceGetSerial(device nvmlDevice) (string, nvmlReturn) {
+	return l.text(l.deviceGetSerial, device, nvmlDeviceSerialBufferSize)
+}
+
+func (l *dlNVML) DeviceGetPciInfo(device nvmlDevice) (nvmlPciInfo, nvmlReturn) {
+	var pci nvmlPciInfo
+	if l.deviceGetPciInfo == nil {
+		return pci, nvmlErrorFunctionNotFound
+	}
+	if ret := l.deviceGetPciInfo(device, &pci); ret != nvmlSuccess {
+		return nvmlPciInfo{}, ret
+	}
+	return pci, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetVbiosVersion(device nvmlDevice) (string, nvmlReturn) {
+	return l.text(l.deviceGetVbiosVersion, device, nvmlDeviceVbiosVersionBufferSize)
+}
+
+func (l *dlNVML) DeviceGetBoardPartNumber(device nvmlDevice) (string, nvmlReturn) {
+	return l.text(l.deviceGetBoardPartNumber, device, nvmlDevicePartNumberBufferSize)
+}
+
+// DeviceGetMemoryInfo uses nvmlDeviceGetMemoryInfo_v2, which also reports
+// reserved memory, if the driver has it.
+func (l *dlNVML) DeviceGetMemoryInfo(device nvmlDevice) (nvmlMemory, nvmlReturn) {
+	if l.deviceGetMemoryInfoV2 != nil {
+		memory := nvmlMemory{Version: nvmlMemoryV2}
+		if ret := l.deviceGetMemoryInfoV2(device, &memory); ret == nvmlSuccess {
+			return memory, nvmlSuccess
+		}
+	}
+	return l.memoryV1(l.deviceGetMemoryInfo, device)
+}
+
+func (l *dlNVML) memoryV1(fn func(nvmlDevice, *nvmlMemoryV1) nvmlReturn, device nvmlDevice) (nvmlMemory, nvmlReturn) {
+	if fn == nil {
+		return nvmlMemory{}, nvmlErrorFunctionNotFound
+	}
+	var memory nvmlMemoryV1
+	if ret := fn(device, &memory); ret != nvmlSuccess {
+		return nvmlMemory{}, ret
+	}
+	return nvmlMemory{Total: memory.Total, Free: memory.Free, Used: memory.Used}, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetBAR1MemoryInfo(device nvmlDevice) (nvmlBAR1Memory, nvmlReturn) {
+	var memory nvmlBAR1Memory
+	if l.deviceGetBAR1MemoryInfo == nil {
+		return memory, nvmlErrorFunctionNotFound
+	}
+	if ret := l.deviceGetBAR1MemoryInfo(device, &memory); ret != nvmlSuccess {
+		return nvmlBAR1Memory{}, ret
+	}
+	return memory, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetConfComputeProtectedMemoryUsage(device nvmlDevice) (nvmlMemory, nvmlReturn) {
+	return l.memoryV1(l.deviceGetConfComputeProtected, device)
+}
+
+func (l *dlNVML) DeviceGetUtilizationRates(device nvmlDevice) (nvmlUtilization, nvmlReturn) {
+	var utilization nvmlUtilization
+	if l.deviceGetUtilizationRates == nil {
+		return utilization, nvmlErrorFunctionNotFound
+	}
+	if ret := l.deviceGetUtilizationRates(device, &utilization); ret != nvmlSuccess {
+		return nvmlUtilization{}, ret
+	}
+	return utilization, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetEncoderUtilization(device nvmlDevice) (uint32, nvmlReturn) {
+	if l.deviceGetEncoderUtilization == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var utilization, samplingPeriod uint32
+	if ret := l.deviceGetEncoderUtilization(device, &utilization, &samplingPeriod); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return utilization, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetDecoderUtilization(device nvmlDevice) (uint32, nvmlReturn) {
+	if l.deviceGetDecoderUtilization == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var utilization, samplingPeriod uint32
+	if ret := l.deviceGetDecoderUtilization(device, &utilization, &samplingPeriod); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return utilization, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetEncoderStats(device nvmlDevice) (sessions, averageFPS, averageLatency uint32, ret nvmlReturn) {
+	if l.deviceGetEncoderStats == nil {
+		return 0, 0, 0, nvmlErrorFunctionNotFound
+	}
+	if ret = l.deviceGetEncoderStats(device, &sessions, &averageFPS, &averageLatency); ret != nvmlSuccess {
+		return 0, 0, 0, ret
+	}
+	return sessions, averageFPS, averageLatency, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetTemperature(device nvmlDevice) (uint32, nvmlReturn) {
+	const nvmlTemperatureGPU = 0
+	return l.unsignedBy(l.deviceGetTemperature, device, nvmlTemperatureGPU)
+}
+
+func (l *dlNVML) DeviceGetTemperatureThreshold(device nvmlDevice, threshold nvmlTemperatureThreshold) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetTemperatureThreshold, device, uint32(threshold))
+}
+
+func (l *dlNVML) DeviceGetPowerUsage(device nvmlDevice) (uint32, nvmlReturn) {
+	return l.unsigned(l.deviceGetPowerUsage, device)
+}
+
+func (l *dlNVML) DeviceGetPowerManagementLimit(device nvmlDevice) (uint32, nvmlReturn) {
+	return l.unsigned(l.deviceGetPowerManagementLimit, device)
+}
+
+func (l *dlNVML) DeviceGetEnforcedPowerLimit(device nvmlDevice) (uint32, nvmlReturn) {
+	return l.unsigned(l.deviceGetEnforcedPowerLimit, device)
+}
+
+func (l *dlNVML) DeviceGetPowerManagementLimitConstraints(device nvmlDevice) (minLimit, maxLimit uint32, ret nvmlReturn) {
+	if l.deviceGetPowerLimitConstraints == nil {
+		return 0, 0, nvmlErrorFunctionNotFound
+	}
+	if ret = l.deviceGetPowerLimitConstraints(device, &minLimit, &maxLimit); ret != nvmlSuccess {
+		return 0, 0, ret
+	}
+	return minLimit, maxLimit, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetPowerManagementDefaultLimit(device nvmlDevice) (uint32, nvmlReturn) {
+	return l.unsigned(l.deviceGetPowerDefaultLimit, device)
+}
+
+func (l *dlNVML) DeviceGetClockInfo(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetClockInfo, device, uint32(clock))
+}
+
+func (l *dlNVML) DeviceGetMaxClockInfo(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetMaxClockInfo, device, uint32(clock))
+}
+
+func (l *dlNVML) DeviceGetApplicationsClock(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetApplicationsClock, device, uint32(clock))
+}
+
+func (l *dlNVML) DeviceGetDefaultApplicationsClock(device nvmlDevice, clock nvmlClockType) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetDefaultApplicationsClock, device, uint32(clock))
+}
+
+func (l *dlNVML) DeviceGetCurrentClocksEventReasons(device nvmlDevice) (uint64, nvmlReturn) {
+	if l.deviceGetCurrentClocksEventReasons == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var reasons uint64
+	if ret := l.deviceGetCurrentClocksEventReasons(device, &reasons); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return reasons, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetEccMode(device nvmlDevice) (current, pending nvmlEnableState, ret nvmlReturn) {
+	if l.deviceGetEccMode == nil {
+		return 0, 0, nvmlErrorFunctionNotFound
+	}
+	if ret = l.deviceGetEccMode(device, &current, &pending); ret != nvmlSuccess {
+		return 0, 0, ret
+	}
+	return current, pending, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetMemoryErrorCounter(device nvmlDevice, errorType nvmlMemoryErrorType, counter nvmlEccCounterType, location nvmlMemoryLocation) (uint64, nvmlReturn) {
+	if l.deviceGetMemoryErrorCounter == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var count uint64
+	if ret := l.deviceGetMemoryErrorCounter(device, uint32(errorType), uint32(counter), uint32(location), &count); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return count, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetTotalEccErrors(device nvmlDevice, errorType nvmlMemoryErrorType, counter nvmlEccCounterType) (uint64, nvmlReturn) {
+	if l.deviceGetTotalEccErrors == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var count uint64
+	if ret := l.deviceGetTotalEccErrors(device, uint32(errorType), uint32(counter), &count); ret != nvmlSuccess {
+		return 0, ret
+	}
+	return count, nvmlSuccess
+}
+
+// DeviceGetRetiredPages counts the pages retired for cause without reading
+// their addresses.
+func (l *dlNVML) DeviceGetRetiredPages(device nvmlDevice, cause nvmlPageRetirementCause) (int, nvmlReturn) {
+	if l.deviceGetRetiredPages == nil {
+		return 0, nvmlErrorFunctionNotFound
+	}
+	var count uint32
+	ret := l.deviceGetRetiredPages(device, uint32(cause), &count, nil)
+	if ret != nvmlSuccess && ret != nvmlErrorInsufficientSize {
+		return 0, ret
+	}
+	return int(count), nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetRetiredPagesPendingStatus(device nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return l.enabled(l.deviceGetRetiredPagesPendingStatus, device)
+}
+
+func (l *dlNVML) DeviceGetRemappedRows(device nvmlDevice) (correctable, uncorrectable int, pending, failure bool, ret nvmlReturn) {
+	if l.deviceGetRemappedRows == nil {
+		return 0, 0, false, false, nvmlErrorFunctionNotFound
+	}
+	var corr, unc, isPending, isFailure uint32
+	if ret = l.deviceGetRemappedRows(device, &corr, &unc, &isPending, &isFailure); ret != nvmlSuccess {
+		return 0, 0, false, false, ret
+	}
+	return int(corr), int(unc), isPending != 0, isFailure != 0, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetCurrPcieLinkGeneration(device nvmlDevice) (int, nvmlReturn) {
+	value, ret := l.unsigned(l.deviceGetCurrPcieLinkGeneration, device)
+	return int(value), ret
+}
+
+func (l *dlNVML) DeviceGetMaxPcieLinkGeneration(device nvmlDevice) (int, nvmlReturn) {
+	value, ret := l.unsigned(l.deviceGetMaxPcieLinkGeneration, device)
+	return int(value), ret
+}
+
+func (l *dlNVML) DeviceGetCurrPcieLinkWidth(device nvmlDevice) (int, nvmlReturn) {
+	value, ret := l.unsigned(l.deviceGetCurrPcieLinkWidth, device)
+	return int(value), ret
+}
+
+func (l *dlNVML) DeviceGetMaxPcieLinkWidth(device nvmlDevice) (int, nvmlReturn) {
+	value, ret := l.unsigned(l.deviceGetMaxPcieLinkWidth, device)
+	return int(value), ret
+}
+
+func (l *dlNVML) DeviceGetPcieThroughput(device nvmlDevice, counter nvmlPcieUtilCounter) (uint32, nvmlReturn) {
+	return l.unsignedBy(l.deviceGetPcieThroughput, device, uint32(counter))
+}
+
+func (l *dlNVML) DeviceGetFanSpeed(device nvmlDevice) (uint32, nvmlReturn) {
+	return l.unsigned(l.deviceGetFanSpeed, device)
+}
+
+func (l *dlNVML) DeviceGetPerformanceState(device nvmlDevice) (int, nvmlReturn) {
+	return l.enum(l.deviceGetPerformanceState, device)
+}
+
+func (l *dlNVML) DeviceGetComputeMode(device nvmlDevice) (int, nvmlReturn) {
+	return l.enum(l.deviceGetComputeMode, device)
+}
+
+func (l *dlNVML) DeviceGetPersistenceMode(device nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return l.enabled(l.deviceGetPersistenceMode, device)
+}
+
+func (l *dlNVML) DeviceGetDisplayActive(device nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return l.enabled(l.deviceGetDisplayActive, device)
+}
+
+func (l *dlNVML) DeviceGetMigMode(device nvmlDevice) (current, pending int, ret nvmlReturn) {
+	if l.deviceGetMigMode == nil {
+		return 0, 0, nvmlErrorFunctionNotFound
+	}
+	var currentMode, pendingMode uint32
+	if ret = l.deviceGetMigMode(device, &currentMode, &pendingMode); ret != nvmlSuccess {
+		return 0, 0, ret
+	}
+	return int(currentMode), int(pendingMode), nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetVirtualizationMode(device nvmlDevice) (int, nvmlReturn) {
+	return l.enum(l.deviceGetVirtualizationMode, device)
+}
+
+func (l *dlNVML) DeviceGetAccountingMode(device nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return l.enabled(l.deviceGetAccountingMode, device)
+}
+
+func (l *dlNVML) DeviceGetGpuFabricInfo(device nvmlDevice) (nvmlGpuFabricInfo, nvmlReturn) {
+	if l.deviceGetGpuFabricInfoV == nil {
+		return nvmlGpuFabricInfo{}, nvmlErrorFunctionNotFound
+	}
+	info := nvmlGpuFabricInfoV{Version: nvmlGpuFabricInfoVersion}
+	if ret := l.deviceGetGpuFabricInfoV(device, &info); ret != nvmlSuccess {
+		return nvmlGpuFabricInfo{}, ret
+	}
+	return nvmlGpuFabricInfo{
+		ClusterUUID: info.ClusterUUID,
+		Status:      info.Status,
+		CliqueID:    info.CliqueID,
+		State:       info.State,
+	}, nvmlSuccess
+}
+
+func (l *dlNVML) DeviceGetComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	return l.processes(l.deviceGetComputeRunningProcesses, device)
+}
+
+func (l *dlNVML) DeviceGetGraphicsRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	return l.processes(l.deviceGetGraphicsRunningProcesses, device)
+}
+
+func (l *dlNVML) DeviceGetMPSComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	return l.processes(l.deviceGetMPSComputeRunningProcesses, device)
+}
+
+// DeviceGetProcessUtilization first asks NVML how many samples it may
+// return, then reads them into a buffer of that size.
+func (l *dlNVML) DeviceGetProcessUtilization(device nvmlDevice, lastSeenTimeStamp uint64) ([]nvmlProcessUtilizationSample, nvmlReturn) {
+	if l.deviceGetProcessUtilization == nil {
+		return nil, nvmlErrorFunctionNotFound
+	}
+
+	var count uint32
+	ret := l.deviceGetProcessUtilization(device, nil, &count, lastSeenTimeStamp)
+	var samples []nvmlProcessUtilizationSample
+	for ret == nvmlErrorInsufficientSize {
+		samples = make([]nvmlProcessUtilizationSample, max(count, 1))
+		count = uint32(len(samples))
+		ret = l.deviceGetProcessUtilization(device, &samples[0], &count, lastSeenTimeStamp)
+	}
+	if ret != nvmlSuccess {
+		return nil, ret
+	}
+	return samples[:min(int(count), len(samples))], nvmlSuccess
+}
@@ -0,0 +1,121 @@
+//go:build linux && (amd64 || arm64)
+
+package collector
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+func TestDLNVMLBindFallback(t *testing.T) {
+	handle, err := purego.Dlopen("libc.so.6", purego.RTLD_NOW)
+	if err != nil {
+		t.Skipf("libc not loadable: %v", err)
+	}
+	l := &dlNVML{handle: handle}
+	defer l.Close()
+
+	// The first name the library exports is bound, as for the _v3 and _v2
+	// process listing functions.
+	var getpid func() int32
+	if !l.bind(&getpid, "nvmlDeviceGetComputeRunningProcesses_v3", "getpid") {
+		t.Fatal("bind found none of the names")
+	}
+	if got := int(getpid()); got != os.Getpid() {
+		t.Errorf("bound function returned %d, want the pid %d", got, os.Getpid())
+	}
+
+	var missing nvmlProcessesFunc
+	if l.bind(&missing, "nvmlDeviceGetComputeRunningProcesses_v3", "nvmlDeviceGetComputeRunningProcesses_v2") {
+		t.Error("bind found a function libc does not export")
+	}
+	if _, ret := l.processes(missing, 1); ret != nvmlErrorFunctionNotFound {
+		t.Errorf("processes without a function = %v, want %v", ret, nvmlErrorFunctionNotFound)
+	}
+}
+
+func TestDLNVMLProcesses(t *testing.T) {
+	running := []nvmlProcessInfoV2{
+		{PID: 10, UsedGPUMemory: 512 * mib, GPUInstanceID: nvmlInstanceIDNone, ComputeInstanceID: nvmlInstanceIDNone},
+		{PID: 11, UsedGPUMemory: nvmlValueNotAvailable, GPUInstanceID: 1, ComputeInstanceID: 0},
+	}
+	var calls int
+	list := func(device nvmlDevice, count *uint32, infos *nvmlProcessInfoV2) nvmlReturn {
+		calls++
+		if infos == nil || int(*count) < len(running) {
+			*count = uint32(len(running))
+			return nvmlErrorInsufficientSize
+		}
+		copy(unsafe.Slice(infos, *count), running)
+		*count = uint32(len(running))
+		return nvmlSuccess
+	}
+
+	got, ret := (&dlNVML{}).processes(list, 1)
+	if ret != nvmlSuccess {
+		t.Fatalf("processes: %v", ret)
+	}
+	want := []nvmlProcessInfo{
+		{PID: 10, UsedGPUMemory: 512 * mib, GPUInstanceID: nvmlInstanceIDNone, ComputeInstanceID: nvmlInstanceIDNone},
+		{PID: 11, UsedGPUMemory: nvmlValueNotAvailable, GPUInstanceID: 1, ComputeInstanceID: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processes = %+v, want %+v", got, want)
+	}
+	if calls != 2 {
+		t.Errorf("listed %d times, want 2: to size the buffer, then to fill it", calls)
+	}
+
+	none := func(device nvmlDevice, count *uint32, infos *nvmlProcessInfoV2) nvmlReturn {
+		*count = 0
+		return nvmlSuccess
+	}
+	if got, ret := (&dlNVML{}).processes(none, 1); ret != nvmlSuccess || len(got) != 0 {
+		t.Errorf("processes without any = %+v, %v, want none", got, ret)
+	}
+}
+
+func TestDLNVMLProcessUtilization(t *testing.T) {
+	// nvmlProcessUtilizationSample_t pads the PID to align the time stamp
+	if size := unsafe.Sizeof(nvmlProcessUtilizationSample{}); size != 32 {
+		t.Fatalf("nvmlProcessUtilizationSample is %d bytes, want 32", size)
+	}
+
+	held := []nvmlProcessUtilizationSample{
+		{PID: 10, TimeStamp: 1000, SMUtil: 40, MemUtil: 10},
+		{PID: 10, TimeStamp: 2000, SMUtil: 60, MemUtil: 20},
+	}
+	var lastSeen []uint64
+	l := &dlNVML{deviceGetProcessUtilization: func(device nvmlDevice, samples *nvmlProcessUtilizationSample, count *uint32, lastSeenTimeStamp uint64) nvmlReturn {
+		lastSeen = append(lastSeen, lastSeenTimeStamp)
+		if lastSeenTimeStamp >= 2000 {
+			return nvmlErrorNotFound
+		}
+		if samples == nil {
+			// NVML reports how many samples it may return
+			*count = 100
+			return nvmlErrorInsufficientSize
+		}
+		*count = uint32(copy(unsafe.Slice(samples, *count), held))
+		return nvmlSuccess
+	}}
+
+	got, ret := l.DeviceGetProcessUtilization(1, 500)
+	if ret != nvmlSuccess || !reflect.DeepEqual(got, held) {
+		t.Errorf("DeviceGetProcessUtilization = %+v, %v, want %+v", got, ret, held)
+	}
+	if !reflect.DeepEqual(lastSeen, []uint64{500, 500}) {
+		t.Errorf("called with time stamps %v, want 500 to size the buffer, then to fill it", lastSeen)
+	}
+
+	if got, ret := l.DeviceGetProcessUtilization(1, 2000); ret != nvmlErrorNotFound || got != nil {
+		t.Errorf("DeviceGetProcessUtilization without new samples = %+v, %v, want %v", got, ret, nvmlErrorNotFound)
+	}
+	if _, ret := (&dlNVML{}).DeviceGetProcessUtilization(1, 0); ret != nvmlErrorFunctionNotFound {
+		t.Errorf("DeviceGetProcessUtilization without a function = %v, want %v", ret, nvmlErrorFunctionNotFound)
+	}
+}
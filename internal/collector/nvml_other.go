@@ -0,0 +1,10 @@
+//go:build !(linux && (amd64 || arm64))
+
+package collector
+
+import "errors"
+
+// openNVML fails, as NVML is only loaded on Linux.
+func openNVML() (nvmlLibrary, error) {
+	return nil, errors.New("NVML is not supported on this platform")
+}
@@ -0,0 +1,610 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// fakeNVMLDevice holds what fakeNVML reports for one GPU. Values it does
+// not hold are not supported.
+type fakeNVMLDevice struct {
+	name, uuid         string
+	busID              string
+	memory             nvmlMemory
+	temperature        uint32
+	temperatureRet     nvmlReturn
+	power              uint32 // milliwatts
+	performanceState   int
+	clocksEventReasons uint64
+
+	compute, graphics, mps          []nvmlProcessInfo
+	computeRet, graphicsRet, mpsRet nvmlReturn
+
+	utilization    []nvmlProcessUtilizationSample // every sample NVML holds
+	utilizationRet nvmlReturn
+}
+
+// fakeNVML is an nvmlLibrary over fixed devices, whose handles are their
+// index plus one.
+type fakeNVML struct {
+	devices      []fakeNVMLDevice
+	countRet     nvmlReturn
+	processNames map[int]string
+
+	shutdown, closed bool
+}
+
+func (f *fakeNVML) device(device nvmlDevice) *fakeNVMLDevice {
+	return &f.devices[device-1]
+}
+
+func (f *fakeNVML) Init() nvmlReturn { return nvmlSuccess }
+
+func (f *fakeNVML) Shutdown() nvmlReturn {
+	f.shutdown = true
+	return nvmlSuccess
+}
+
+func (f *fakeNVML) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeNVML) SystemGetDriverVersion() (string, nvmlReturn)  { return "550.54.15", nvmlSuccess }
+func (f *fakeNVML) SystemGetCudaDriverVersion() (int, nvmlReturn) { return 12040, nvmlSuccess }
+
+func (f *fakeNVML) SystemGetProcessName(pid int) (string, nvmlReturn) {
+	if name, ok := f.processNames[pid]; ok {
+		return name, nvmlSuccess
+	}
+	return "", nvmlErrorNotFound
+}
+
+func (f *fakeNVML) DeviceGetCount() (int, nvmlReturn) {
+	if f.countRet != nvmlSuccess {
+		return 0, f.countRet
+	}
+	return len(f.devices), nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetHandleByIndex(index int) (nvmlDevice, nvmlReturn) {
+	return nvmlDevice(index + 1), nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetName(device nvmlDevice) (string, nvmlReturn) {
+	if name := f.device(device).name; name != "" {
+		return name, nvmlSuccess
+	}
+	return "", nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetUUID(device nvmlDevice) (string, nvmlReturn) {
+	return f.device(device).uuid, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetSerial(nvmlDevice) (string, nvmlReturn) {
+	return "", nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPciInfo(device nvmlDevice) (nvmlPciInfo, nvmlReturn) {
+	var pci nvmlPciInfo
+	copy(pci.BusID[:], f.device(device).busID)
+	return pci, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetVbiosVersion(nvmlDevice) (string, nvmlReturn) {
+	return "", nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetBoardPartNumber(nvmlDevice) (string, nvmlReturn) {
+	return "", nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMemoryInfo(device nvmlDevice) (nvmlMemory, nvmlReturn) {
+	return f.device(device).memory, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetBAR1MemoryInfo(nvmlDevice) (nvmlBAR1Memory, nvmlReturn) {
+	return nvmlBAR1Memory{}, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetConfComputeProtectedMemoryUsage(nvmlDevice) (nvmlMemory, nvmlReturn) {
+	return nvmlMemory{}, nvmlErrorFunctionNotFound
+}
+
+func (f *fakeNVML) DeviceGetUtilizationRates(nvmlDevice) (nvmlUtilization, nvmlReturn) {
+	return nvmlUtilization{}, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetEncoderUtilization(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetDecoderUtilization(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetEncoderStats(nvmlDevice) (uint32, uint32, uint32, nvmlReturn) {
+	return 0, 0, 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetTemperature(device nvmlDevice) (uint32, nvmlReturn) {
+	d := f.device(device)
+	return d.temperature, d.temperatureRet
+}
+
+func (f *fakeNVML) DeviceGetTemperatureThreshold(nvmlDevice, nvmlTemperatureThreshold) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPowerUsage(device nvmlDevice) (uint32, nvmlReturn) {
+	return f.device(device).power, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetPowerManagementLimit(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetEnforcedPowerLimit(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPowerManagementLimitConstraints(nvmlDevice) (uint32, uint32, nvmlReturn) {
+	return 0, 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPowerManagementDefaultLimit(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetClockInfo(nvmlDevice, nvmlClockType) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMaxClockInfo(nvmlDevice, nvmlClockType) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetApplicationsClock(nvmlDevice, nvmlClockType) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetDefaultApplicationsClock(nvmlDevice, nvmlClockType) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetCurrentClocksEventReasons(device nvmlDevice) (uint64, nvmlReturn) {
+	return f.device(device).clocksEventReasons, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetEccMode(nvmlDevice) (nvmlEnableState, nvmlEnableState, nvmlReturn) {
+	return 0, 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMemoryErrorCounter(nvmlDevice, nvmlMemoryErrorType, nvmlEccCounterType, nvmlMemoryLocation) (uint64, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetTotalEccErrors(nvmlDevice, nvmlMemoryErrorType, nvmlEccCounterType) (uint64, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetRetiredPages(nvmlDevice, nvmlPageRetirementCause) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetRetiredPagesPendingStatus(nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetRemappedRows(nvmlDevice) (int, int, bool, bool, nvmlReturn) {
+	return 0, 0, false, false, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetCurrPcieLinkGeneration(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMaxPcieLinkGeneration(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetCurrPcieLinkWidth(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMaxPcieLinkWidth(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPcieThroughput(nvmlDevice, nvmlPcieUtilCounter) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetFanSpeed(nvmlDevice) (uint32, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetPerformanceState(device nvmlDevice) (int, nvmlReturn) {
+	return f.device(device).performanceState, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetComputeMode(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetPersistenceMode(nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return nvmlFeatureEnabled, nvmlSuccess
+}
+
+func (f *fakeNVML) DeviceGetDisplayActive(nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetMigMode(nvmlDevice) (int, int, nvmlReturn) {
+	return 0, 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetVirtualizationMode(nvmlDevice) (int, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetAccountingMode(nvmlDevice) (nvmlEnableState, nvmlReturn) {
+	return 0, nvmlErrorNotSupported
+}
+
+func (f *fakeNVML) DeviceGetGpuFabricInfo(nvmlDevice) (nvmlGpuFabricInfo, nvmlReturn) {
+	return nvmlGpuFabricInfo{}, nvmlErrorFunctionNotFound
+}
+
+func (f *fakeNVML) DeviceGetComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	d := f.device(device)
+	return d.compute, d.computeRet
+}
+
+func (f *fakeNVML) DeviceGetGraphicsRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	d := f.device(device)
+	return d.graphics, d.graphicsRet
+}
+
+func (f *fakeNVML) DeviceGetMPSComputeRunningProcesses(device nvmlDevice) ([]nvmlProcessInfo, nvmlReturn) {
+	d := f.device(device)
+	return d.mps, d.mpsRet
+}
+
+// DeviceGetProcessUtilization returns the samples newer than
+// lastSeenTimeStamp, failing with nvmlErrorNotFound if there are none.
+func (f *fakeNVML) DeviceGetProcessUtilization(device nvmlDevice, lastSeenTimeStamp uint64) ([]nvmlProcessUtilizationSample, nvmlReturn) {
+	d := f.device(device)
+	if d.utilizationRet != nvmlSuccess {
+		return nil, d.utilizationRet
+	}
+
+	var samples []nvmlProcessUtilizationSample
+	for _, sample := range d.utilization {
+		if sample.TimeStamp > lastSeenTimeStamp {
+			samples = append(samples, sample)
+		}
+	}
+	if samples == nil {
+		return nil, nvmlErrorNotFound
+	}
+	return samples, nvmlSuccess
+}
+
+func TestNVMLSourceGPUs(t *testing.T) {
+	a100 := fakeNVMLDevice{
+		name:             "NVIDIA A100-SXM4-40GB",
+		uuid:             "GPU-00000000-0000-0000-0000-000000000000",
+		busID:            "00000000:07:00.0",
+		memory:           nvmlMemory{Total: 40 << 30, Reserved: 1 << 30, Free: 35 << 30, Used: 4 << 30},
+		temperature:      45,
+		power:            71500,
+		performanceState: 0,
+	}
+	want := types.GPUMetrics{
+		GPUID:            0,
+		GPUName:          "NVIDIA A100-SXM4-40GB",
+		UUID:             "GPU-00000000-0000-0000-0000-000000000000",
+		PCIBusID:         "00000000:07:00.0",
+		DriverVersion:    "550.54.15",
+		CUDAVersion:      "12.4",
+		TotalMemory:      40 << 30,
+		ReservedMemory:   1 << 30,
+		FreeMemory:       35 << 30,
+		UsedMemory:       4 << 30,
+		Temperature:      45,
+		PowerDraw:        71.5,
+		PerformanceState: 0,
+		ComputeMode:      "Default",
+		PersistenceMode:  true,
+	}
+
+	unnamed := a100
+	unnamed.name = ""
+	unnamed.performanceState = 32
+	wantUnnamed := want
+	wantUnnamed.GPUName = "unknown"
+	wantUnnamed.PerformanceState = -1
+
+	lost := a100
+	lost.temperatureRet = nvmlErrorGPUIsLost
+	lost.temperature = 0
+	wantLost := want
+	wantLost.Temperature = 0
+
+	second := a100
+	second.uuid = "GPU-00000000-0000-0000-0000-000000000001"
+	wantSecond := want
+	wantSecond.GPUID = 1
+	wantSecond.UUID = second.uuid
+
+	tests := []struct {
+		name    string
+		lib     *fakeNVML
+		want    []types.GPUMetrics
+		wantErr string
+	}{
+		{
+			name: "two GPUs",
+			lib:  &fakeNVML{devices: []fakeNVMLDevice{a100, second}},
+			want: []types.GPUMetrics{want, wantSecond},
+		},
+		{
+			name: "unsupported values left unset",
+			lib:  &fakeNVML{devices: []fakeNVMLDevice{unnamed}},
+			want: []types.GPUMetrics{wantUnnamed},
+		},
+		{
+			name:    "failed call reported",
+			lib:     &fakeNVML{devices: []fakeNVMLDevice{lost}},
+			want:    []types.GPUMetrics{wantLost},
+			wantErr: "GPU 0: nvmlDeviceGetTemperature: GPU is lost",
+		},
+		{
+			name:    "no devices",
+			lib:     &fakeNVML{countRet: nvmlErrorDriverNotLoaded},
+			wantErr: "nvmlDeviceGetCount: Driver Not Loaded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &nvmlSource{lib: tt.lib}
+			got, err := s.GPUs(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("GPUs: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("GPUs error = %v, want %q", err, tt.wantErr)
+			}
+			for i := range got {
+				got[i].Timestamp = tt.want[i].Timestamp
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GPUs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNVMLClockEventReasons(t *testing.T) {
+	tests := []struct {
+		reasons uint64
+		want    types.ClockEventReasons
+	}{
+		{reasons: 0},
+		{reasons: 0x1, want: types.ClockEventReasons{GPUIdle: true}},
+		{reasons: 0x2, want: types.ClockEventReasons{ApplicationsClocksSetting: true}},
+		{reasons: 0x4, want: types.ClockEventReasons{SWPowerCap: true}},
+		{reasons: 0x8, want: types.ClockEventReasons{HWSlowdown: true}},
+		{reasons: 0x10, want: types.ClockEventReasons{SyncBoost: true}},
+		{reasons: 0x20, want: types.ClockEventReasons{SWThermalSlowdown: true}},
+		{reasons: 0x40, want: types.ClockEventReasons{HWThermalSlowdown: true}},
+		{reasons: 0x80, want: types.ClockEventReasons{HWPowerBrakeSlowdown: true}},
+		{reasons: 0x4 | 0x40 | 0x8, want: types.ClockEventReasons{SWPowerCap: true, HWSlowdown: true, HWThermalSlowdown: true}},
+		// bits of reasons not reported, such as display clock setting
+		{reasons: 0x100},
+	}
+
+	for _, tt := range tests {
+		lib := &fakeNVML{devices: []fakeNVMLDevice{{uuid: "GPU-0", clocksEventReasons: tt.reasons}}}
+		metrics, err := (&nvmlSource{lib: lib}).GPUs(context.Background())
+		if err != nil {
+			t.Fatalf("GPUs: %v", err)
+		}
+		if got := metrics[0].ClockEventReasons; got != tt.want {
+			t.Errorf("reasons %#x = %+v, want %+v", tt.reasons, got, tt.want)
+		}
+	}
+}
+
+func TestNVMLDeviceProcesses(t *testing.T) {
+	mig := func(pid uint32, memory uint64, gpuInstance, computeInstance uint32) nvmlProcessInfo {
+		return nvmlProcessInfo{PID: pid, UsedGPUMemory: memory, GPUInstanceID: gpuInstance, ComputeInstanceID: computeInstance}
+	}
+	process := func(pid uint32, memory uint64) nvmlProcessInfo {
+		return mig(pid, memory, nvmlInstanceIDNone, nvmlInstanceIDNone)
+	}
+
+	tests := []struct {
+		name    string
+		device  fakeNVMLDevice
+		want    []detailProcess
+		wantErr string
+	}{
+		{
+			name: "compute and graphics merged",
+			device: fakeNVMLDevice{
+				compute:  []nvmlProcessInfo{process(10, 512*mib), process(11, nvmlValueNotAvailable)},
+				graphics: []nvmlProcessInfo{process(10, 512*mib), process(12, 64*mib)},
+			},
+			want: []detailProcess{
+				{pid: 10, processType: "C+G", name: "python", usedGPUMemory: 512 * mib, gpuInstanceID: -1, computeInstanceID: -1},
+				{pid: 11, processType: "C", gpuInstanceID: -1, computeInstanceID: -1},
+				{pid: 12, processType: "G", name: "Xorg", usedGPUMemory: 64 * mib, gpuInstanceID: -1, computeInstanceID: -1},
+			},
+		},
+		{
+			name: "MIG instances kept apart",
+			device: fakeNVMLDevice{
+				compute: []nvmlProcessInfo{mig(10, 256*mib, 1, 0), mig(10, 128*mib, 2, 0)},
+				mps:     []nvmlProcessInfo{mig(13, 32*mib, 2, 0)},
+			},
+			want: []detailProcess{
+				{pid: 10, processType: "C", name: "python", usedGPUMemory: 256 * mib, gpuInstanceID: 1, computeInstanceID: 0},
+				{pid: 10, processType: "C", name: "python", usedGPUMemory: 128 * mib, gpuInstanceID: 2, computeInstanceID: 0},
+				{pid: 13, processType: "M+C", usedGPUMemory: 32 * mib, gpuInstanceID: 2, computeInstanceID: 0},
+			},
+		},
+		{
+			// neither the _v3 nor the _v2 function is exported
+			name: "lists the driver lacks skipped",
+			device: fakeNVMLDevice{
+				compute:  []nvmlProcessInfo{process(10, 512*mib)},
+				graphics: []nvmlProcessInfo{process(12, 64*mib)},
+				mpsRet:   nvmlErrorFunctionNotFound,
+			},
+			want: []detailProcess{
+				{pid: 10, processType: "C", name: "python", usedGPUMemory: 512 * mib, gpuInstanceID: -1, computeInstanceID: -1},
+				{pid: 12, processType: "G", name: "Xorg", usedGPUMemory: 64 * mib, gpuInstanceID: -1, computeInstanceID: -1},
+			},
+		},
+		{
+			name: "failed list reported",
+			device: fakeNVMLDevice{
+				computeRet: nvmlErrorGPUIsLost,
+				graphics:   []nvmlProcessInfo{process(12, 64*mib)},
+			},
+			want: []detailProcess{
+				{pid: 12, processType: "G", name: "Xorg", usedGPUMemory: 64 * mib, gpuInstanceID: -1, computeInstanceID: -1},
+			},
+			wantErr: "GPU 0: nvmlDeviceGetComputeRunningProcesses: GPU is lost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lib := &fakeNVML{
+				devices:      []fakeNVMLDevice{tt.device},
+				processNames: map[int]string{10: "python", 12: "Xorg"},
+			}
+			got, err := (&nvmlSource{lib: lib}).deviceProcesses(0, 1)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("deviceProcesses: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("deviceProcesses error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deviceProcesses = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNVMLSourceWithoutNvidiaSmi(t *testing.T) {
+	lib := &fakeNVML{devices: []fakeNVMLDevice{{uuid: "GPU-0"}}}
+	s := &nvmlSource{lib: lib}
+	ctx := context.Background()
+
+	if devices, err := s.MIGDevices(ctx); devices != nil || err != nil {
+		t.Errorf("MIGDevices = %v, %v, want none", devices, err)
+	}
+	if links, err := s.NVLinks(ctx); links != nil || err != nil {
+		t.Errorf("NVLinks = %v, %v, want none", links, err)
+	}
+	if topology, err := s.Topology(ctx); topology != nil || err != nil {
+		t.Errorf("Topology = %v, %v, want none", topology, err)
+	}
+
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, s)
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	if topology, err := c.CollectTopology(); topology != nil || err != nil {
+		t.Errorf("CollectTopology = %v, %v, want none", topology, err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !lib.shutdown || !lib.closed {
+		t.Errorf("Close left NVML shut down %v, unloaded %v; want both", lib.shutdown, lib.closed)
+	}
+}
+
+func TestNVMLProcessUtilization(t *testing.T) {
+	lib := &fakeNVML{devices: []fakeNVMLDevice{
+		{
+			uuid: "GPU-0",
+			utilization: []nvmlProcessUtilizationSample{
+				{PID: 10, TimeStamp: 1000, SMUtil: 40, MemUtil: 10},
+				{PID: 11, TimeStamp: 1500, SMUtil: 5, EncUtil: 30, DecUtil: 20},
+				{PID: 10, TimeStamp: 2000, SMUtil: 60, MemUtil: 20},
+			},
+		},
+		// a GPU in MIG mode does not sample processes
+		{uuid: "GPU-1", utilizationRet: nvmlErrorNotSupported},
+		{uuid: "GPU-2", utilizationRet: nvmlErrorUnknown},
+	}}
+	s := &nvmlSource{lib: lib}
+	ctx := context.Background()
+
+	// the first call reads every sample, using each process's latest
+	got, err := s.ProcessUtilization(ctx)
+	if err == nil || !strings.Contains(err.Error(), "GPU 2") {
+		t.Errorf("ProcessUtilization error = %v, want one for GPU 2", err)
+	}
+	want := []ProcessUtilization{
+		{GPUID: 0, PID: 10, SM: 60, Memory: 20},
+		{GPUID: 0, PID: 11, SM: 5, Encoder: 30, Decoder: 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProcessUtilization = %+v, want %+v", got, want)
+	}
+
+	// later calls only read the samples taken since
+	lib.devices[2].utilizationRet = nvmlSuccess
+	if got, err := s.ProcessUtilization(ctx); got != nil || err != nil {
+		t.Errorf("ProcessUtilization without new samples = %+v, %v, want none", got, err)
+	}
+	lib.devices[0].utilization = append(lib.devices[0].utilization,
+		nvmlProcessUtilizationSample{PID: 11, TimeStamp: 3000, SMUtil: 15})
+	got, err = s.ProcessUtilization(ctx)
+	if err != nil {
+		t.Fatalf("ProcessUtilization: %v", err)
+	}
+	if want := []ProcessUtilization{{GPUID: 0, PID: 11, SM: 15}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ProcessUtilization of new samples = %+v, want %+v", got, want)
+	}
+}
+
+// nilTopologySource is a source that reads no topology.
+type nilTopologySource struct {
+	Source
+}
+
+func (nilTopologySource) Topology(context.Context) (*types.Topology, error) {
+	return nil, nil
+}
+
+func TestCollectTopologyNone(t *testing.T) {
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, nilTopologySource{NewFakeSource()})
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	topology, err := c.CollectTopology()
+	if topology != nil || err != nil {
+		t.Errorf("CollectTopology = %v, %v, want none", topology, err)
+	}
+	if got := c.Topology(); got != nil {
+		t.Errorf("Topology = %v, want nil", got)
+	}
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ProcessUtilization samples per-process engine utilization once with
+// nvidia-smi pmon, which takes about a second. pmon does not support MIG
+// mode, so it returns nothing while a GPU was in MIG mode when GPUs last
+// ran, or if the driver does not support pmon at all. Engines a process did
+// not use during the sample are reported as 0.
+func (s *nvidiaSmiSource) ProcessUtilization(ctx context.Context) ([]ProcessUtilization, error) {
+	s.mu.Lock()
+	migEnabled := s.migEnabled
+	s.mu.Unlock()
+
+	if migEnabled {
+		return nil, nil
+	}
+
+	table, err := s.monitor(ctx, "pmon", "-c", "1", "-s", "u")
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	return parseProcessUtilization(table)
+}
+
+// parseProcessUtilization reads pmon -s u rows. Rows without a process,
+// printed for idle GPUs, are skipped, as are rows that cannot be parsed;
+// the latter are reported in the returned error.
+func parseProcessUtilization(table *monitorTable) ([]ProcessUtilization, error) {
+	var samples []ProcessUtilization
+	var errs []error
+
+	for i := range table.rows {
+		if table.text(i, "pid") == "" {
+			continue
+		}
+
+		var sample ProcessUtilization
+		var rowErrs []error
+		for _, column := range []struct {
+			value *int
+			name  string
+		}{
+			{&sample.GPUID, "gpu"},
+			{&sample.PID, "pid"},
+		} {
+			var err error
+			if *column.value, err = table.intValue(i, column.name); err != nil {
+				rowErrs = append(rowErrs, fmt.Errorf("%s: %w", column.name, err))
+			}
+		}
+		for _, column := range []struct {
+			value *float64
+			name  string
+		}{
+			{&sample.SM, "sm"},
+			{&sample.Memory, "mem"},
+			{&sample.Encoder, "enc"},
+			{&sample.Decoder, "dec"},
+		} {
+			var err error
+			if *column.value, err = table.floatValue(i, column.name); err != nil {
+				rowErrs = append(rowErrs, fmt.Errorf("%s: %w", column.name, err))
+			}
+		}
+
+		if err := errors.Join(rowErrs...); err != nil {
+			errs = append(errs, fmt.Errorf("row %d: %w", i+1, err))
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, errors.Join(errs...)
+}
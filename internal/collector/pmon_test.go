@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+func TestProcessUtilization(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		migEnabled bool
+		want       []ProcessUtilization
+		wantErr    bool
+		wantCalls  int
+	}{
+		{
+			// "-" marks engines the process did not use and GPUs without processes
+			name: "processes and an idle GPU",
+			output: `# gpu        pid  type    sm   mem   enc   dec   command
+# Idx          #   C/G     %     %     %     %   name
+    0      12345     C    45    20     -     -   python
+    0       2210     G     3     1     0     0   Xorg
+    1          -     -     -     -     -     -   -
+`,
+			want: []ProcessUtilization{
+				{GPUID: 0, PID: 12345, SM: 45, Memory: 20},
+				{GPUID: 0, PID: 2210, SM: 3, Memory: 1},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "newer driver with more engines and a command with spaces",
+			output: `# gpu         pid   type     sm    mem    enc    dec    jpg    ofa    command
+# Idx           #    C/G      %      %      %      %      %      %    name
+    0      12345     C+G     10      5     30     40      -      -    my app
+`,
+			want:      []ProcessUtilization{{GPUID: 0, PID: 12345, SM: 10, Memory: 5, Encoder: 30, Decoder: 40}},
+			wantCalls: 1,
+		},
+		{
+			name: "unparsable row",
+			output: `# gpu        pid  type    sm   mem   enc   dec   command
+# Idx          #   C/G     %     %     %     %   name
+    0      12345     C    45    20     -     -   python
+    1      12346     C  busy    20     -     -   python
+`,
+			want:      []ProcessUtilization{{GPUID: 0, PID: 12345, SM: 45, Memory: 20}},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			// pmon does not support MIG mode, so it is not run
+			name:       "GPU in MIG mode",
+			output:     "# gpu pid type sm mem enc dec command\n# Idx # C/G % % % % name\n",
+			migEnabled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, calls := fakeNvidiaSmi(t, "cat <<'OUT'\n"+tt.output+"OUT")
+			s.migEnabled = tt.migEnabled
+
+			got, err := s.ProcessUtilization(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ProcessUtilization error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProcessUtilization = %+v, want %+v", got, tt.want)
+			}
+			if n := len(calls()); n != tt.wantCalls {
+				t.Errorf("nvidia-smi ran %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCollectProcessesUtilization(t *testing.T) {
+	pid := os.Getpid()
+	source := NewFakeSource()
+	source.Apps = append(source.Apps, ComputeApp{
+		GPUUUID:       "GPU-00000000-0000-0000-0000-000000000001",
+		PID:           pid,
+		ProcessName:   "fake-app",
+		UsedGPUMemory: 1024 * mib,
+		Type:          ProcessTypeCompute,
+
+		GPUInstanceID:     -1,
+		ComputeInstanceID: -1,
+	})
+	// samples are joined by GPU and PID, so PID 1's sample on GPU 1 does
+	// not apply to PID 1 on GPU 0
+	source.Utilization = []ProcessUtilization{
+		{GPUID: 0, PID: pid, SM: 25, Memory: 10, Encoder: 12, Decoder: 20},
+		{GPUID: 1, PID: pid, SM: 50, Memory: 30},
+		{GPUID: 1, PID: 1, SM: 99},
+	}
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, source)
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	processes, err := c.CollectProcesses()
+	if err != nil {
+		t.Fatalf("CollectProcesses: %v", err)
+	}
+
+	type utilization struct {
+		sm, memory, encoder, decoder float64
+		ok                           bool
+	}
+	want := map[[2]int]utilization{
+		{0, pid}: {sm: 25, memory: 10, encoder: 12, decoder: 20, ok: true},
+		{0, 1}:   {},
+		{1, pid}: {sm: 50, memory: 30, ok: true},
+	}
+	got := make(map[[2]int]utilization, len(processes))
+	for _, process := range processes {
+		got[[2]int{process.GPUID, process.PID}] = utilization{
+			sm:      process.SMUtilization,
+			memory:  process.MemoryUtilization,
+			encoder: process.EncoderUtilization,
+			decoder: process.DecoderUtilization,
+			ok:      process.HasUtilization,
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("process utilization by GPU and PID = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// userHZ is the kernel clock tick rate used for times in /proc/<pid>/stat.
+// Linux exposes it as a constant 100 to userspace on all supported architectures.
+const userHZ = 100
+
+// processInfo holds host-side details of a GPU process.
+type processInfo struct {
+	user          string
+	cpuPercent    float64
+	memoryPercent float64
+	command       string
+}
+
+// procReader reads process details from a procfs mount.
+type procReader struct {
+	root string
+}
+
+// lookup reads user, CPU and memory usage and the full command line of pid.
+// CPU and memory usage are computed the same way as ps %cpu and %mem.
+func (r procReader) lookup(pid int) (processInfo, error) {
+	dir := filepath.Join(r.root, strconv.Itoa(pid))
+
+	uid, rssKB, err := r.readStatus(filepath.Join(dir, "status"))
+	if err != nil {
+		return processInfo{}, err
+	}
+
+	cpuTicks, startTicks, err := r.readStat(filepath.Join(dir, "stat"))
+	if err != nil {
+		return processInfo{}, err
+	}
+
+	command, err := r.readCmdline(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return processInfo{}, err
+	}
+
+	info := processInfo{
+		user:    lookupUser(uid),
+		command: command,
+	}
+
+	if uptime, err := r.readUptime(); err == nil {
+		elapsed := uptime - float64(startTicks)/userHZ
+		if elapsed > 0 {
+			info.cpuPercent = float64(cpuTicks) / userHZ / elapsed * 100
+		}
+	}
+
+	if memTotalKB, err := r.readMemTotal(); err == nil && memTotalKB > 0 {
+		info.memoryPercent = float64(rssKB) / float64(memTotalKB) * 100
+	}
+
+	return info, nil
+}
+
+// readStatus returns the effective UID and resident set size in kB.
+func (r procReader) readStatus(path string) (string, uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	var uid string
+	var rssKB uint64
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		switch key {
+		case "Uid":
+			// real, effective, saved set, filesystem
+			if len(fields) < 2 {
+				return "", 0, fmt.Errorf("%s: malformed Uid line", path)
+			}
+			uid = fields[1]
+		case "VmRSS":
+			if len(fields) < 1 {
+				return "", 0, fmt.Errorf("%s: malformed VmRSS line", path)
+			}
+			rssKB, err = strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("%s: failed to parse VmRSS: %w", path, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, err
+	}
+
+	if uid == "" {
+		return "", 0, fmt.Errorf("%s: no Uid line", path)
+	}
+
+	return uid, rssKB, nil
+}
+
+// readStat returns the CPU time used by the process (utime+stime) and its
+// start time since boot, both in clock ticks.
+func (r procReader) readStat(path string) (uint64, uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// comm is enclosed in parentheses and may itself contain spaces and
+	// parentheses, so the remaining fields start after the last ')'.
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("%s: malformed stat", path)
+	}
+
+	// fields[0] is field 3 (state) in proc(5) numbering.
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return 0, 0, fmt.Errorf("%s: too few fields (%d)", path, len(fields))
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: failed to parse utime: %w", path, err)
+	}
+
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: failed to parse stime: %w", path, err)
+	}
+
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: failed to parse starttime: %w", path, err)
+	}
+
+	return utime + stime, startTime, nil
+}
+
+// readCmdline returns the full argv joined with spaces. Arguments are kept
+// verbatim, including any commas or newlines they contain.
+func (r procReader) readCmdline(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	args := strings.Split(string(data), "\x00")
+	return strings.Join(args, " "), nil
+}
+
+// readUptime returns the system uptime in seconds.
+func (r procReader) readUptime() (float64, error) {
+	data, err := os.ReadFile(filepath.Join(r.root, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("malformed uptime")
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readMemTotal returns the total usable RAM in kB.
+func (r procReader) readMemTotal() (uint64, error) {
+	file, err := os.Open(filepath.Join(r.root, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("no MemTotal in meminfo")
+}
+
+// lookupUser resolves uid to a user name, falling back to the numeric uid
+// when the user is unknown, e.g. inside a container without the host's passwd.
+func lookupUser(uid string) string {
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+	return u.Username
+}
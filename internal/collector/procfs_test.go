@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// statLine formats /proc/<pid>/stat with the given comm, CPU times and
+// start time, in clock ticks.
+func statLine(pid int, comm string, utime, stime, startTime uint64) string {
+	return fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 1520 0 0 0 %d %d 0 0 20 0 4 0 %d 1234567 2048 18446744073709551615\n",
+		pid, comm, pid, pid, utime, stime, startTime)
+}
+
+// unknownUID is a UID no test host is expected to have a user for.
+const unknownUID = "3999999999"
+
+// writeProcfs writes files, by path relative to a new procfs root, and
+// returns the root.
+func writeProcfs(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProcReaderLookup(t *testing.T) {
+	system := map[string]string{
+		"uptime":  "50.00 180.00\n",
+		"meminfo": "MemTotal:        4096 kB\nMemFree:         1024 kB\n",
+	}
+	status := "Name:\tpython\nUid:\t1000\t" + unknownUID + "\t" + unknownUID + "\t" + unknownUID + "\nVmRSS:\t    1024 kB\n"
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    processInfo
+		wantErr bool
+	}{
+		{
+			// 4s of CPU over the 40s since it started 10s after boot
+			name: "CPU and memory usage",
+			files: map[string]string{
+				"42/status":  status,
+				"42/stat":    statLine(42, "python", 300, 100, 1000),
+				"42/cmdline": "python\x00train.py\x00",
+			},
+			want: processInfo{user: unknownUID, cpuPercent: 10, memoryPercent: 25, command: "python train.py"},
+		},
+		{
+			name: "comm with spaces and parentheses",
+			files: map[string]string{
+				"42/status":  status,
+				"42/stat":    statLine(42, "my app) (x", 300, 100, 1000),
+				"42/cmdline": "./my app\x00",
+			},
+			want: processInfo{user: unknownUID, cpuPercent: 10, memoryPercent: 25, command: "./my app"},
+		},
+		{
+			name: "arguments with commas and newlines",
+			files: map[string]string{
+				"42/status":  status,
+				"42/stat":    statLine(42, "python", 300, 100, 1000),
+				"42/cmdline": "python\x00-c\x00print(1,2)\nprint(3)\x00",
+			},
+			want: processInfo{user: unknownUID, cpuPercent: 10, memoryPercent: 25, command: "python -c print(1,2)\nprint(3)"},
+		},
+		{
+			name: "kernel thread without VmRSS or cmdline",
+			files: map[string]string{
+				"42/status":  "Name:\tkworker/0:1\nUid:\t0\t" + unknownUID + "\t0\t0\n",
+				"42/stat":    statLine(42, "kworker/0:1", 0, 0, 1000),
+				"42/cmdline": "",
+			},
+			want: processInfo{user: unknownUID},
+		},
+		{
+			name: "started at the current uptime",
+			files: map[string]string{
+				"42/status":  status,
+				"42/stat":    statLine(42, "python", 0, 0, 5000),
+				"42/cmdline": "python\x00",
+			},
+			want: processInfo{user: unknownUID, memoryPercent: 25, command: "python"},
+		},
+		{
+			name:    "exited process",
+			files:   map[string]string{},
+			wantErr: true,
+		},
+		{
+			name: "truncated stat",
+			files: map[string]string{
+				"42/status":  status,
+				"42/stat":    "42 (python) S 1 42 42\n",
+				"42/cmdline": "python\x00",
+			},
+			wantErr: true,
+		},
+		{
+			name: "status without Uid",
+			files: map[string]string{
+				"42/status":  "Name:\tpython\n",
+				"42/stat":    statLine(42, "python", 300, 100, 1000),
+				"42/cmdline": "python\x00",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(system)+len(tt.files))
+			for name, content := range system {
+				files[name] = content
+			}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+
+			got, err := procReader{root: writeProcfs(t, files)}.lookup(42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookup error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lookup = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcReaderWithoutSystemFiles(t *testing.T) {
+	root := writeProcfs(t, map[string]string{
+		"42/status":  "Uid:\t" + unknownUID + "\t" + unknownUID + "\t" + unknownUID + "\t" + unknownUID + "\nVmRSS:\t1024 kB\n",
+		"42/stat":    statLine(42, "python", 300, 100, 1000),
+		"42/cmdline": "python\x00",
+	})
+
+	// Usage is left zero without uptime and meminfo.
+	got, err := procReader{root: root}.lookup(42)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if want := (processInfo{user: unknownUID, command: "python"}); got != want {
+		t.Errorf("lookup = %+v, want %+v", got, want)
+	}
+}
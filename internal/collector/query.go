@@ -0,0 +1,327 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayout is the layout of the nvidia-smi "timestamp" field.
+const timestampLayout = "2006/01/02 15:04:05.000"
+
+// textFields are free-text fields that nvidia-smi prints without quoting,
+// so a comma inside the value splits it across several CSV cells.
+var textFields = map[string]bool{
+	"process_name": true,
+}
+
+// byteUnits maps memory units printed by nvidia-smi to their size in bytes.
+var byteUnits = map[string]uint64{
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+}
+
+// FieldError reports a single nvidia-smi field that could not be parsed.
+type FieldError struct {
+	Row   int
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("row %d: field %s: cannot parse %q: %v", e.Row, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// queryColumn locates a requested field in the CSV output.
+type queryColumn struct {
+	index int
+	unit  string
+}
+
+// queryTable is the parsed output of an nvidia-smi --query-* command run with
+// --format=csv,nounits. Columns are keyed by the requested field name rather
+// than the header text, because nvidia-smi prints some fields under a
+// different name (e.g. gpu_name as "name"); the header supplies the units.
+type queryTable struct {
+	columns map[string]queryColumn
+	rows    [][]string
+}
+
+// parseQueryTable parses CSV output, including its header row, produced by
+// querying fields.
+func parseQueryTable(output string, fields []string) (*queryTable, error) {
+	table := &queryTable{columns: make(map[string]queryColumn, len(fields))}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return table, nil
+	}
+
+	header := splitCSVLine(lines[0])
+	if len(header) != len(fields) {
+		return nil, fmt.Errorf("header has %d columns, expected %d for %s", len(header), len(fields), strings.Join(fields, ","))
+	}
+
+	textIndex := -1
+	for i, field := range fields {
+		table.columns[field] = queryColumn{index: i, unit: headerUnit(header[i])}
+		if textFields[field] {
+			textIndex = i
+		}
+	}
+
+	for lineNum, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		cells := strings.Split(line, ",")
+		if extra := len(cells) - len(fields); extra > 0 && textIndex >= 0 {
+			text := strings.Join(cells[textIndex:textIndex+extra+1], ",")
+			cells = append(append(cells[:textIndex:textIndex], text), cells[textIndex+extra+1:]...)
+		}
+		for i, cell := range cells {
+			cells[i] = strings.TrimSpace(cell)
+		}
+		if len(cells) != len(fields) {
+			return nil, fmt.Errorf("line %d: invalid field count (%d), expected %d fields", lineNum+2, len(cells), len(fields))
+		}
+
+		table.rows = append(table.rows, cells)
+	}
+
+	return table, nil
+}
+
+// splitCSVLine splits a line of nvidia-smi CSV output and trims each cell.
+// nvidia-smi never quotes values, so a plain split is more faithful than
+// encoding/csv.
+func splitCSVLine(line string) []string {
+	cells := strings.Split(line, ",")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+// headerUnit extracts the unit from a header such as "memory.used [MiB]".
+func headerUnit(header string) string {
+	start := strings.LastIndexByte(header, '[')
+	end := strings.LastIndexByte(header, ']')
+	if start < 0 || end < start {
+		return ""
+	}
+	return strings.TrimSpace(header[start+1 : end])
+}
+
+// rename re-keys the columns queried as names[i] to keys[i].
+func (t *queryTable) rename(names, keys []string) {
+	columns := make(map[string]queryColumn, len(keys))
+	for i, name := range names {
+		columns[keys[i]] = t.columns[name]
+	}
+	t.columns = columns
+}
+
+// len returns the number of data rows.
+func (t *queryTable) len() int {
+	return len(t.rows)
+}
+
+// row returns typed access to data row i.
+func (t *queryTable) row(i int) *queryRow {
+	return &queryRow{table: t, index: i}
+}
+
+// queryRow gives typed access to one row of a queryTable. Each accessor
+// returns the zero value for unavailable or unparsable fields and records
+// a *FieldError for the latter; Err returns them all.
+type queryRow struct {
+	table *queryTable
+	index int
+	errs  []error
+}
+
+// value returns the raw cell for field and its unit from the header.
+func (r *queryRow) value(field string) (string, string) {
+	column, ok := r.table.columns[field]
+	if !ok {
+		return "", ""
+	}
+	return r.table.rows[r.index][column.index], column.unit
+}
+
+func (r *queryRow) fail(field, value string, err error) {
+	r.errs = append(r.errs, &FieldError{Row: r.index + 1, Field: field, Value: value, Err: err})
+}
+
+// Err returns the parse failures recorded so far, or nil.
+func (r *queryRow) Err() error {
+	return errors.Join(r.errs...)
+}
+
+// Text returns field as text, or "" if it is not available.
+func (r *queryRow) Text(field string) string {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return ""
+	}
+	return value
+}
+
+// Int returns field as an integer.
+func (r *queryRow) Int(field string) int {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return 0
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// Uint returns field as a non-negative count.
+func (r *queryRow) Uint(field string) uint64 {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return 0
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		r.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// Float returns field as a number in the unit nvidia-smi reports it in:
+// percent, degrees Celsius, watts or MHz.
+func (r *queryRow) Float(field string) float64 {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return 0
+	}
+
+	number, _ := splitUnit(value)
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		r.fail(field, value, err)
+		return 0
+	}
+	return f
+}
+
+// Bytes returns a memory field converted to bytes.
+func (r *queryRow) Bytes(field string) uint64 {
+	value, unit := r.value(field)
+	if notAvailable(value) {
+		return 0
+	}
+
+	n, err := parseBytes(value, unit)
+	if err != nil {
+		r.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// Bool returns field as a boolean. nvidia-smi reports flags as
+// "Active"/"Not Active", "Enabled"/"Disabled" or "Yes"/"No" depending on the field.
+func (r *queryRow) Bool(field string) bool {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return false
+	}
+
+	flag, err := parseFlag(value)
+	if err != nil {
+		r.fail(field, value, err)
+	}
+	return flag
+}
+
+// parseFlag parses a flag value printed by nvidia-smi.
+func parseFlag(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "active", "enabled", "yes", "true", "1":
+		return true, nil
+	case "not active", "disabled", "no", "false", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("not a boolean")
+	}
+}
+
+// Time returns field parsed as an nvidia-smi timestamp, or the current time
+// if it is not available.
+func (r *queryRow) Time(field string) time.Time {
+	value, _ := r.value(field)
+	if notAvailable(value) {
+		return time.Now()
+	}
+
+	t, err := time.ParseInLocation(timestampLayout, value, time.Local)
+	if err != nil {
+		r.fail(field, value, err)
+		return time.Now()
+	}
+	return t
+}
+
+// notAvailable reports whether value is one of nvidia-smi's placeholders
+// such as "N/A", "[N/A]" or "[Not Supported]".
+func notAvailable(value string) bool {
+	return value == "" || value == "N/A" ||
+		(strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"))
+}
+
+// splitUnit splits a value such as "1024 MiB" or "75 %" into its number and unit.
+func splitUnit(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexByte(value, ' '); i >= 0 {
+		return value[:i], strings.TrimSpace(value[i+1:])
+	}
+	return value, ""
+}
+
+// parseBytes converts a memory value to bytes. The unit printed with the
+// value takes precedence over defaultUnit; nvidia-smi reports memory in MiB
+// when neither is present.
+func parseBytes(value, defaultUnit string) (uint64, error) {
+	number, unit := splitUnit(value)
+	if unit == "" {
+		unit = defaultUnit
+	}
+	if unit == "" {
+		unit = "MiB"
+	}
+
+	multiplier, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
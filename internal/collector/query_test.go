@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestParseQueryTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		fields []string
+		want   [][]string
+	}{
+		{
+			name:   "units stripped by nounits",
+			output: "index, memory.used [MiB], utilization.gpu [%]\n0, 1024, 30\n1, 0, 0\n",
+			fields: []string{"index", "memory.used", "utilization.gpu"},
+			want:   [][]string{{"0", "1024", "30"}, {"1", "0", "0"}},
+		},
+		{
+			name:   "placeholders kept verbatim",
+			output: "index, fan.speed [%], power.draw [W]\n0, [N/A], [Not Supported]\n",
+			fields: []string{"index", "fan.speed", "power.draw"},
+			want:   [][]string{{"0", "[N/A]", "[Not Supported]"}},
+		},
+		{
+			name:   "commas rejoined in process_name",
+			output: "pid, process_name, used_gpu_memory [MiB]\n42, python -c print(1,2), 512\n",
+			fields: []string{"pid", "process_name", "used_gpu_memory"},
+			want:   [][]string{{"42", "python -c print(1,2)", "512"}},
+		},
+		{
+			name:   "renamed header",
+			output: "name, pci.bus_id\nNVIDIA A100, 00000000:3B:00.0\n",
+			fields: []string{"gpu_name", "pci.bus_id"},
+			want:   [][]string{{"NVIDIA A100", "00000000:3B:00.0"}},
+		},
+		{
+			name:   "blank lines skipped",
+			output: "index\n\n0\n\n1\n",
+			fields: []string{"index"},
+			want:   [][]string{{"0"}, {"1"}},
+		},
+		{
+			name:   "empty output",
+			output: "\n",
+			fields: []string{"index"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := parseQueryTable(tt.output, tt.fields)
+			if err != nil {
+				t.Fatalf("parseQueryTable: %v", err)
+			}
+			if table.len() != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", table.len(), len(tt.want))
+			}
+			for i, want := range tt.want {
+				row := table.row(i)
+				for j, field := range tt.fields {
+					if got, _ := row.value(field); got != want[j] {
+						t.Errorf("row %d: %s = %q, want %q", i, field, got, want[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseQueryTableErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		fields []string
+	}{
+		{
+			name:   "missing header column",
+			output: "index, memory.used [MiB]\n0, 1024\n",
+			fields: []string{"index", "memory.used", "memory.total"},
+		},
+		{
+			name:   "extra header column",
+			output: "index, memory.used [MiB], memory.total [MiB]\n0, 1024, 2048\n",
+			fields: []string{"index", "memory.used"},
+		},
+		{
+			name:   "short row",
+			output: "index, memory.used [MiB]\n0\n",
+			fields: []string{"index", "memory.used"},
+		},
+		{
+			name:   "comma without text field",
+			output: "index, memory.used [MiB]\n0, 1,024\n",
+			fields: []string{"index", "memory.used"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseQueryTable(tt.output, tt.fields); err == nil {
+				t.Error("parseQueryTable succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestQueryRow(t *testing.T) {
+	output := "name, memory.used [MiB], memory.total [KiB], power.draw [W], mig.mode.current, fan.speed [%], pstate\n" +
+		"NVIDIA A100, 1024, 2048, 71.50, Enabled, [N/A], not-a-number\n"
+	names := []string{"gpu_name", "memory.used", "memory.total", "power.draw", "mig.mode.current", "fan.speed", "pstate"}
+
+	table, err := parseQueryTable(output, names)
+	if err != nil {
+		t.Fatalf("parseQueryTable: %v", err)
+	}
+	table.rename(names, []string{"name", "used", "total", "power", "mig", "fan", "pstate"})
+
+	row := table.row(0)
+	if got := row.Text("name"); got != "NVIDIA A100" {
+		t.Errorf("Text(name) = %q", got)
+	}
+	if got := row.Bytes("used"); got != 1024<<20 {
+		t.Errorf("Bytes(used) = %d, want %d", got, 1024<<20)
+	}
+	if got := row.Bytes("total"); got != 2048<<10 {
+		t.Errorf("Bytes(total) = %d, want %d", got, 2048<<10)
+	}
+	if got := row.Float("power"); got != 71.5 {
+		t.Errorf("Float(power) = %v", got)
+	}
+	if got := row.Bool("mig"); !got {
+		t.Error("Bool(mig) = false")
+	}
+	if got := row.Float("fan"); got != 0 {
+		t.Errorf("Float(fan) = %v, want 0", got)
+	}
+	if got := row.Text("gpu_name"); got != "" {
+		t.Errorf("Text of a column renamed away = %q, want empty", got)
+	}
+	if err := row.Err(); err != nil {
+		t.Fatalf("Err before a parse failure: %v", err)
+	}
+
+	if got := row.Int("pstate"); got != 0 {
+		t.Errorf("Int(pstate) = %d, want 0", got)
+	}
+	var fieldErr *FieldError
+	if err := row.Err(); !errors.As(err, &fieldErr) || fieldErr.Field != "pstate" || fieldErr.Value != "not-a-number" {
+		t.Errorf("Err = %v, want a *FieldError for pstate", err)
+	}
+	if !errors.Is(row.Err(), strconv.ErrSyntax) {
+		t.Errorf("Err = %v, want it to wrap strconv.ErrSyntax", row.Err())
+	}
+}
+
+func TestNotAvailable(t *testing.T) {
+	for value, want := range map[string]bool{
+		"":                true,
+		"N/A":             true,
+		"[N/A]":           true,
+		"[Not Supported]": true,
+		"[Unknown Error]": true,
+		"0":               false,
+		"Not Active":      false,
+	} {
+		if got := notAvailable(value); got != want {
+			t.Errorf("notAvailable(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		value       string
+		defaultUnit string
+		want        uint64
+		wantErr     bool
+	}{
+		{value: "12", want: 12 << 20},
+		{value: "12", defaultUnit: "KiB", want: 12 << 10},
+		{value: "12", defaultUnit: "B", want: 12},
+		{value: "12 GiB", defaultUnit: "KiB", want: 12 << 30},
+		{value: "12 MB", want: 12 * 1000 * 1000},
+		{value: "12", defaultUnit: "%", wantErr: true},
+		{value: "12 furlongs", wantErr: true},
+		{value: "1.5 GiB", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBytes(tt.value, tt.defaultUnit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBytes(%q, %q) error = %v, wantErr %v", tt.value, tt.defaultUnit, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseBytes(%q, %q) = %d, want %d", tt.value, tt.defaultUnit, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderUnit(t *testing.T) {
+	for header, want := range map[string]string{
+		"memory.used [MiB]":   "MiB",
+		"utilization.gpu [%]": "%",
+		"name":                "",
+		"clocks.max.sm [MHz]": "MHz",
+		"broken ]unit[":       "",
+	} {
+		if got := headerUnit(header); got != want {
+			t.Errorf("headerUnit(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// Source names accepted in CollectorConfig.Source.
+const (
+	SourceNvidiaSmi    = "nvidia-smi"
+	SourceNvidiaSmiXML = "nvidia-smi-xml"
+	SourceNVML         = "nvml"
+	SourceFake         = "fake"
+)
+
+// Process types of ComputeApp.Type.
+const (
+	ProcessTypeCompute   = "compute"
+	ProcessTypeGraphics  = "graphics"
+	ProcessTypeMPSServer = "mps_server"
+	ProcessTypeMPSClient = "mps_client"
+)
+
+// Source provides raw GPU data to the Collector.
+type Source interface {
+	// GPUs returns current metrics for each GPU. Hostname is filled in by the Collector.
+	GPUs(ctx context.Context) ([]types.GPUMetrics, error)
+	// GPUMapping returns the mapping from GPU UUID to GPU index.
+	GPUMapping(ctx context.Context) (map[string]int, error)
+	// ComputeApps returns the processes currently using the GPUs, for compute,
+	// graphics or through MPS.
+	// Apps may be returned together with an error if some of their details are missing.
+	ComputeApps(ctx context.Context) ([]ComputeApp, error)
+}
+
+// MIGSource is implemented by Sources that can enumerate MIG devices.
+type MIGSource interface {
+	// MIGDevices returns the MIG devices of GPUs in MIG mode.
+	// Hostname is filled in by the Collector.
+	MIGDevices(ctx context.Context) ([]types.MIGDevice, error)
+}
+
+// NVLinkSource is implemented by Sources that can read NVLink state and counters.
+type NVLinkSource interface {
+	// NVLinks returns the NVLinks of every GPU. Hostname is filled in by the Collector.
+	NVLinks(ctx context.Context) ([]types.NVLink, error)
+}
+
+// VGPUSource is implemented by Sources that can enumerate vGPU instances.
+type VGPUSource interface {
+	// VGPUs returns the active vGPUs of GPUs hosting vGPUs.
+	// Hostname is filled in by the Collector.
+	VGPUs(ctx context.Context) ([]types.VGPU, error)
+}
+
+// ProcessUtilizationSource is implemented by Sources that can sample how
+// much of each GPU engine every process uses.
+type ProcessUtilizationSource interface {
+	// ProcessUtilization returns one sample per process and GPU.
+	ProcessUtilization(ctx context.Context) ([]ProcessUtilization, error)
+}
+
+// AccountingSource is implemented by Sources that can read the statistics
+// the driver keeps per process while accounting mode is enabled.
+type AccountingSource interface {
+	// AccountedApps returns the processes in the driver's accounting buffers,
+	// both running and finished. Apps may be returned together with an error
+	// if some could not be read.
+	AccountedApps(ctx context.Context) ([]AccountedApp, error)
+}
+
+// TopologySource is implemented by Sources that can read the GPU topology.
+type TopologySource interface {
+	// Topology returns how the GPUs connect to each other, to NICs and to CPUs.
+	// Hostname, GPU UUIDs and names may be left for the Collector to fill in.
+	Topology(ctx context.Context) (*types.Topology, error)
+}
+
+// ComputeApp describes a process using a GPU as reported by a Source.
+type ComputeApp struct {
+	Timestamp     time.Time
+	GPUUUID       string // GPU or MIG device UUID
+	PID           int
+	ProcessName   string
+	UsedGPUMemory uint64 // bytes
+	Type          string // one of the ProcessType constants
+
+	// GPU and compute instance of the MIG device the process runs on,
+	// or -1 if unknown or not on a MIG device
+	GPUInstanceID     int
+	ComputeInstanceID int
+}
+
+// ProcessUtilization is a process's use of a GPU's engines in percent, as
+// reported by a Source.
+type ProcessUtilization struct {
+	GPUID   int
+	PID     int
+	SM      float64
+	Memory  float64 // memory bandwidth
+	Encoder float64
+	Decoder float64
+}
+
+// AccountedApp is a process recorded by the driver's accounting mode.
+type AccountedApp struct {
+	GPUUUID           string
+	PID               int
+	GPUUtilization    float64 // percent, averaged over the process's run time
+	MemoryUtilization float64 // percent, averaged over the process's run time
+	MaxMemoryUsage    uint64  // bytes
+	Time              time.Duration
+	Running           bool
+}
+
+// newSource creates the Source selected by config.Source.
+func newSource(config types.CollectorConfig) (Source, error) {
+	switch config.Source {
+	case "", SourceNvidiaSmi:
+		return newStreamingNvidiaSmiSource(config)
+	case SourceNvidiaSmiXML:
+		return newNvidiaSmiXMLSource(config)
+	case SourceNVML:
+		s, err := newNVMLSource(config)
+		if err != nil {
+			log.Printf("NVML is not available, falling back to nvidia-smi: %v", err)
+			return newStreamingNvidiaSmiSource(config)
+		}
+		return s, nil
+	case SourceFake:
+		return NewFakeSource(), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", config.Source)
+	}
+}
+
+// newStreamingNvidiaSmiSource creates an nvidia-smi source that streams
+// GPU metrics if config.StreamInterval is set.
+func newStreamingNvidiaSmiSource(config types.CollectorConfig) (*nvidiaSmiSource, error) {
+	s, err := newNvidiaSmiSource(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.StreamInterval > 0 {
+		s.startStream(config.StreamInterval)
+	}
+	return s, nil
+}
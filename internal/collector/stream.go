@@ -0,0 +1,460 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamMinBackoff and streamMaxBackoff bound the delay before a
+	// streaming nvidia-smi that exited is started again.
+	streamMinBackoff = time.Second
+	streamMaxBackoff = time.Minute
+
+	// streamStaleIntervals is how many sampling intervals a streamed row
+	// is used for before it is considered stale.
+	streamStaleIntervals = 3
+
+	// streamRefreshInterval is how long, while streaming, the output of a
+	// one-shot command for values that rarely change is reused.
+	streamRefreshInterval = time.Minute
+)
+
+// commandStream keeps a long-running nvidia-smi command, such as
+// --query-gpu with --loop-ms or dmon, running and passes each line it
+// prints to handle. When the command exits it is started again after a
+// delay that doubles with every exit, up to streamMaxBackoff, unless exited
+// reports that it can be restarted at once or must not be restarted.
+type commandStream struct {
+	name   string // for logging, e.g. "dmon"
+	path   string
+	args   func() []string                           // arguments for the next start
+	handle func(line string)                         // called for each line of output
+	exited func(err error, stderr string) streamExit // called when the command exits
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// streamExit is what a commandStream does after its command exited.
+type streamExit int
+
+const (
+	streamBackoff streamExit = iota // restart after a delay
+	streamRestart                   // restart at once
+	streamStop                      // do not restart
+)
+
+// start runs the command in the background until Close is called or exited
+// stops it.
+func (s *commandStream) start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+}
+
+func (s *commandStream) run() {
+	defer close(s.done)
+
+	backoff := streamMinBackoff
+	for {
+		started := time.Now()
+		stderr, err := s.runOnce()
+
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		switch s.exited(err, stderr) {
+		case streamRestart:
+			continue
+		case streamStop:
+			return
+		}
+
+		// a command that ran for a while is restarted promptly
+		if time.Since(started) >= streamMaxBackoff {
+			backoff = streamMinBackoff
+		}
+		log.Printf("nvidia-smi %s exited: %v; restarting in %v", s.name, err, backoff)
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, streamMaxBackoff)
+	}
+}
+
+// runOnce starts the command and reads its output until it exits.
+func (s *commandStream) runOnce() (string, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return "", nil
+	}
+	cmd := exec.Command(s.path, s.args()...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	s.cmd = cmd
+	s.mu.Unlock()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+
+	err = cmd.Wait()
+	if err == nil {
+		err = fmt.Errorf("exited unexpectedly")
+	}
+
+	s.mu.Lock()
+	s.cmd = nil
+	s.mu.Unlock()
+
+	return stderr.String(), err
+}
+
+// Close stops the command and waits for it to exit.
+func (s *commandStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	if s.cmd != nil {
+		s.cmd.Process.Kill()
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+// streamRow is the last line printed for one GPU.
+type streamRow struct {
+	line     string
+	received time.Time
+}
+
+// gpuStream keeps nvidia-smi --query-gpu and dmon running, so that GPUs
+// reads their latest samples instead of starting nvidia-smi each time.
+// Each GPU's row is replaced as soon as a new one is printed. Rows that
+// have not been renewed for streamStaleIntervals intervals are ignored, and
+// GPUs falls back to running the one-shot commands when no row is current.
+type gpuStream struct {
+	source   *nvidiaSmiSource
+	interval time.Duration
+	query    *commandStream
+	dmon     *commandStream
+
+	mu            sync.Mutex
+	names, keys   []string // fields of the running query, as returned by resolveFields
+	queryHeader   string   // "" until the running query has printed it
+	queryRows     map[string]streamRow
+	invalid       string   // field the running query was rejected for
+	monitorHeader []string // column names and units of dmon
+	monitorRows   map[string]streamRow
+	outputs       map[string]cachedOutput // by command line, see refreshOutput
+}
+
+// cachedOutput is the output of a one-shot nvidia-smi command.
+type cachedOutput struct {
+	output []byte
+	read   time.Time
+}
+
+// startStream starts streaming GPU metrics sampled every interval.
+func (s *nvidiaSmiSource) startStream(interval time.Duration) {
+	stream := &gpuStream{source: s, interval: interval, outputs: make(map[string]cachedOutput)}
+
+	stream.query = &commandStream{
+		name:   "--query-gpu",
+		path:   s.path,
+		args:   stream.queryArgs,
+		handle: stream.handleQuery,
+		exited: stream.queryExited,
+	}
+
+	stream.dmon = &commandStream{
+		name:   "dmon",
+		path:   s.path,
+		args:   stream.monitorArgs,
+		handle: stream.handleMonitor,
+		exited: stream.monitorExited,
+	}
+
+	s.stream = stream
+	stream.query.start()
+	stream.dmon.start()
+}
+
+// queryArgs returns the arguments of --query-gpu with --loop-ms for the
+// fields this driver accepts, and resets the rows of the previous run.
+func (g *gpuStream) queryArgs() []string {
+	names, keys := g.source.resolveFields(gpuQueryFields)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.names, g.keys = names, keys
+	g.queryHeader = ""
+	g.queryRows = make(map[string]streamRow)
+	g.invalid = ""
+
+	return []string{
+		"--query-gpu=" + strings.Join(names, ","),
+		"--format=csv,nounits",
+		"--loop-ms=" + strconv.FormatInt(g.interval.Milliseconds(), 10),
+	}
+}
+
+// handleQuery records a line of --query-gpu output. nvidia-smi prints the
+// header once and then a row per GPU every interval.
+func (g *gpuStream) handleQuery(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if match := invalidFieldPattern.FindStringSubmatch(line); match != nil {
+		g.invalid = match[1]
+		return
+	}
+	if g.queryHeader == "" {
+		g.queryHeader = line
+		return
+	}
+
+	table, err := parseQueryTable(g.queryHeader+"\n"+line, g.names)
+	if err != nil || table.len() == 0 {
+		log.Printf("Skipping nvidia-smi --query-gpu output %q: %v", line, err)
+		return
+	}
+	table.rename(g.names, g.keys)
+	index := table.row(0).Text("index")
+
+	g.queryRows[index] = streamRow{line: line, received: time.Now()}
+}
+
+// queryExited restarts the query at once without a field it was rejected
+// for, as query does. The field may already have been marked invalid by a
+// one-shot query since the stream started.
+func (g *gpuStream) queryExited(err error, stderr string) streamExit {
+	g.mu.Lock()
+	invalid, names := g.invalid, g.names
+	g.mu.Unlock()
+
+	if match := invalidFieldPattern.FindStringSubmatch(stderr); match != nil {
+		invalid = match[1]
+	}
+	if invalid == "" || !slices.Contains(names, invalid) {
+		return streamBackoff
+	}
+
+	g.source.markInvalid(invalid)
+	return streamRestart
+}
+
+// monitorExited stops dmon for good if the driver does not support it, as
+// monitor does, so that it is neither restarted nor run once per collection.
+func (g *gpuStream) monitorExited(err error, stderr string) streamExit {
+	if !unsupportedPattern.MatchString(stderr) {
+		return streamBackoff
+	}
+
+	g.source.markUnsupported("dmon")
+	return streamStop
+}
+
+// monitorArgs returns the arguments of dmon sampling PCIe throughput, and
+// resets the rows of the previous run.
+func (g *gpuStream) monitorArgs() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.monitorHeader = nil
+	g.monitorRows = make(map[string]streamRow)
+
+	// dmon samples in whole seconds
+	seconds := max(int((g.interval+time.Second-1)/time.Second), 1)
+	return []string{"dmon", "-s", "t", "-d", strconv.Itoa(seconds)}
+}
+
+// handleMonitor records a line of dmon output. dmon repeats its two header
+// lines every so often.
+func (g *gpuStream) handleMonitor(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if strings.HasPrefix(line, "#") {
+		if len(g.monitorHeader) < 2 {
+			g.monitorHeader = append(g.monitorHeader, line)
+		}
+		return
+	}
+	if len(g.monitorHeader) < 2 {
+		return
+	}
+
+	index, _, _ := strings.Cut(line, " ")
+	g.monitorRows[index] = streamRow{line: line, received: time.Now()}
+}
+
+// current returns the lines of rows that are not stale, ordered by GPU index.
+func (g *gpuStream) current(rows map[string]streamRow) []string {
+	cutoff := time.Now().Add(-streamStaleIntervals * g.interval)
+
+	indexes := make([]string, 0, len(rows))
+	for index, row := range rows {
+		if row.received.After(cutoff) {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		a, _ := strconv.Atoi(indexes[i])
+		b, _ := strconv.Atoi(indexes[j])
+		return a < b
+	})
+
+	lines := make([]string, len(indexes))
+	for i, index := range indexes {
+		lines[i] = rows[index].line
+	}
+	return lines
+}
+
+// queryTable returns the latest --query-gpu rows as a table, or nil if
+// there is no stream or no current row.
+func (g *gpuStream) queryTable() *queryTable {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lines := g.current(g.queryRows)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	table, err := parseQueryTable(g.queryHeader+"\n"+strings.Join(lines, "\n"), g.names)
+	if err != nil {
+		return nil
+	}
+	table.rename(g.names, g.keys)
+	return table
+}
+
+// monitorTable returns the latest dmon rows as a table, or nil if there is
+// no stream or no current row.
+func (g *gpuStream) monitorTable() *monitorTable {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lines := g.current(g.monitorRows)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	output := append(append([]string{}, g.monitorHeader...), lines...)
+	table, err := parseMonitorTable(strings.Join(output, "\n"))
+	if err != nil {
+		return nil
+	}
+	return table
+}
+
+// cached returns the output stored for key within the last
+// streamRefreshInterval, if any. It returns nothing if there is no stream.
+func (g *gpuStream) cached(key string) ([]byte, bool) {
+	if g == nil {
+		return nil, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cached, ok := g.outputs[key]
+	if !ok || time.Since(cached.read) >= streamRefreshInterval {
+		return nil, false
+	}
+	return cached.output, true
+}
+
+// store records output for key, unless there is no stream.
+func (g *gpuStream) store(key string, output []byte) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.outputs[key] = cachedOutput{output: output, read: time.Now()}
+}
+
+// refreshOutput runs nvidia-smi with args and returns its output, like
+// exec.Cmd.Output. While streaming, a successful run's output is reused for
+// streamRefreshInterval, so that commands for values that rarely change,
+// such as NVLink speeds or MIG device profiles, do not run on every
+// collection.
+func (s *nvidiaSmiSource) refreshOutput(ctx context.Context, args ...string) ([]byte, error) {
+	key := strings.Join(args, " ")
+	if output, ok := s.stream.cached(key); ok {
+		return output, nil
+	}
+
+	output, err := exec.CommandContext(ctx, s.path, args...).Output()
+	if err != nil {
+		return output, err
+	}
+	s.stream.store(key, output)
+	return output, nil
+}
+
+// Close stops both commands.
+func (g *gpuStream) Close() error {
+	g.query.Close()
+	g.dmon.Close()
+	return nil
+}
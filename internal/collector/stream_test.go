@@ -0,0 +1,381 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// newTestStream returns a stream for a fake nvidia-smi that fails every
+// command, with neither of its commands started, so that lines can be fed
+// to it directly.
+func newTestStream(t *testing.T) (*gpuStream, func() []string) {
+	t.Helper()
+
+	s, calls := fakeNvidiaSmi(t, "exit 2")
+	g := &gpuStream{source: s, interval: time.Second, outputs: make(map[string]cachedOutput)}
+	s.stream = g
+	return g, calls
+}
+
+// queryLine returns a --query-gpu row for the running query's fields with
+// the given values and every other field not available.
+func queryLine(g *gpuStream, values map[string]string) string {
+	cells := make([]string, len(g.names))
+	for i := range g.names {
+		cells[i] = "[N/A]"
+		if value, ok := values[g.keys[i]]; ok {
+			cells[i] = value
+		}
+	}
+	return strings.Join(cells, ", ")
+}
+
+func TestGPUStreamQuery(t *testing.T) {
+	g, calls := newTestStream(t)
+
+	args := g.queryArgs()
+	if !slices.Contains(args, "--loop-ms=1000") || !slices.Contains(args, "--format=csv,nounits") {
+		t.Errorf("queryArgs = %q", args)
+	}
+
+	if g.queryTable() != nil {
+		t.Error("queryTable before any output is not nil")
+	}
+
+	// rows are keyed by index; a GPU's new row replaces its old one
+	g.handleQuery(strings.Join(g.names, ", "))
+	g.handleQuery(queryLine(g, map[string]string{"index": "1", "uuid": "GPU-1", "temperature.gpu": "40"}))
+	g.handleQuery("")
+	g.handleQuery(queryLine(g, map[string]string{"index": "0", "uuid": "GPU-0", "temperature.gpu": "30"}))
+	g.handleQuery(queryLine(g, map[string]string{"index": "1", "uuid": "GPU-1", "temperature.gpu": "41"}))
+	g.handleQuery("not, a, row")
+
+	table := g.queryTable()
+	if table == nil || table.len() != 2 {
+		t.Fatalf("queryTable = %+v, want 2 rows", table)
+	}
+	for i, want := range []struct {
+		uuid        string
+		temperature float64
+	}{{"GPU-0", 30}, {"GPU-1", 41}} {
+		row := table.row(i)
+		if got := row.Text("uuid"); got != want.uuid {
+			t.Errorf("row %d uuid = %q, want %q", i, got, want.uuid)
+		}
+		if got := row.Float("temperature.gpu"); got != want.temperature {
+			t.Errorf("row %d temperature = %v, want %v", i, got, want.temperature)
+		}
+	}
+
+	mapping, err := g.source.GPUMapping(context.Background())
+	if err != nil {
+		t.Fatalf("GPUMapping: %v", err)
+	}
+	if want := map[string]int{"GPU-0": 0, "GPU-1": 1}; !reflect.DeepEqual(mapping, want) {
+		t.Errorf("GPUMapping = %v, want %v", mapping, want)
+	}
+
+	metrics, err := g.source.GPUs(context.Background())
+	if len(metrics) != 2 || metrics[1].Temperature != 41 {
+		t.Errorf("GPUs = %+v, %v", metrics, err)
+	}
+	for _, call := range calls() {
+		if strings.Contains(call, "--query-gpu") {
+			t.Errorf("nvidia-smi %s ran while streaming", call)
+		}
+	}
+}
+
+func TestGPUStreamInvalidField(t *testing.T) {
+	g, _ := newTestStream(t)
+	g.queryArgs()
+
+	g.handleQuery(`Field "pstate" is not a valid field to query.`)
+	if g.queryExited(nil, "") != streamRestart {
+		t.Fatal("queryExited did not restart the query at once")
+	}
+	if strings.Contains(g.queryArgs()[0], "pstate") || slices.Contains(g.names, "pstate") {
+		t.Errorf("restarted query still has pstate: %q", g.names)
+	}
+
+	// an exit without a rejected field is restarted after a delay
+	if g.queryExited(nil, "Unable to determine the device handle") == streamRestart {
+		t.Error("queryExited restarted the query at once without a rejected field")
+	}
+}
+
+func TestGPUStreamMonitor(t *testing.T) {
+	g, calls := newTestStream(t)
+
+	if args := g.monitorArgs(); !reflect.DeepEqual(args, []string{"dmon", "-s", "t", "-d", "1"}) {
+		t.Errorf("monitorArgs = %q", args)
+	}
+	g.interval = 1500 * time.Millisecond
+	if args := g.monitorArgs(); args[len(args)-1] != "2" {
+		t.Errorf("monitorArgs for 1.5s = %q, want a 2s delay", args)
+	}
+
+	for _, line := range []string{
+		"    0     99     99", // before the header, ignored
+		"# gpu  rxpci  txpci",
+		"# Idx   MB/s   MB/s",
+		"    0     10     20",
+		"    1      1      2",
+		"# gpu  rxpci  txpci",
+		"# Idx   MB/s   MB/s",
+		"    0     12     34",
+	} {
+		g.handleMonitor(line)
+	}
+
+	metrics := []types.GPUMetrics{{GPUID: 0}, {GPUID: 1}}
+	if err := g.source.addPCIeThroughput(context.Background(), metrics); err != nil {
+		t.Fatalf("addPCIeThroughput: %v", err)
+	}
+	if metrics[0].PCIeRxThroughput != 12e6 || metrics[0].PCIeTxThroughput != 34e6 || metrics[1].PCIeRxThroughput != 1e6 {
+		t.Errorf("throughput = %+v", metrics)
+	}
+	if got := calls(); got != nil {
+		t.Errorf("nvidia-smi ran while streaming: %q", got)
+	}
+}
+
+func TestGPUStreamStale(t *testing.T) {
+	g, _ := newTestStream(t)
+	g.queryArgs()
+	g.monitorArgs()
+
+	g.handleQuery(strings.Join(g.names, ", "))
+	g.handleQuery(queryLine(g, map[string]string{"index": "0"}))
+	g.handleQuery(queryLine(g, map[string]string{"index": "1"}))
+	g.handleMonitor("# gpu  rxpci  txpci")
+	g.handleMonitor("# Idx   MB/s   MB/s")
+	g.handleMonitor("    0     10     20")
+
+	// GPU 1 stopped being printed three intervals ago
+	old := time.Now().Add(-streamStaleIntervals * g.interval)
+	g.queryRows["1"] = streamRow{line: g.queryRows["1"].line, received: old}
+	if table := g.queryTable(); table == nil || table.len() != 1 || table.row(0).Int("index") != 0 {
+		t.Errorf("queryTable with one stale row = %+v", table)
+	}
+
+	g.queryRows["0"] = streamRow{line: g.queryRows["0"].line, received: old}
+	g.monitorRows["0"] = streamRow{line: g.monitorRows["0"].line, received: old}
+	if table := g.queryTable(); table != nil {
+		t.Errorf("queryTable with only stale rows = %+v, want nil", table)
+	}
+	if table := g.monitorTable(); table != nil {
+		t.Errorf("monitorTable with only stale rows = %+v, want nil", table)
+	}
+
+	var none *gpuStream
+	if none.queryTable() != nil || none.monitorTable() != nil {
+		t.Error("tables of a nil stream are not nil")
+	}
+}
+
+func TestRefreshOutput(t *testing.T) {
+	g, calls := newTestStream(t)
+	s := g.source
+
+	smi, smiCalls := fakeNvidiaSmi(t, "echo output")
+	smi.stream = g
+	for i := 0; i < 3; i++ {
+		output, err := smi.refreshOutput(context.Background(), "nvlink", "--status")
+		if err != nil || string(output) != "output\n" {
+			t.Fatalf("refreshOutput = %q, %v", output, err)
+		}
+	}
+	if got := smiCalls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %d times while streaming, want once: %q", len(got), got)
+	}
+
+	// output older than streamRefreshInterval is read again
+	g.outputs["nvlink --status"] = cachedOutput{output: []byte("old\n"), read: time.Now().Add(-streamRefreshInterval)}
+	if output, _ := smi.refreshOutput(context.Background(), "nvlink", "--status"); string(output) != "output\n" {
+		t.Errorf("refreshOutput after the refresh interval = %q", output)
+	}
+
+	// failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := s.refreshOutput(context.Background(), "-L"); err == nil {
+			t.Fatal("refreshOutput succeeded, want error")
+		}
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("failing nvidia-smi ran %d times, want 2: %q", len(got), got)
+	}
+
+	// without a stream nothing is cached
+	smi.stream = nil
+	smi.refreshOutput(context.Background(), "nvlink", "--status")
+	smi.refreshOutput(context.Background(), "nvlink", "--status")
+	if got := smiCalls(); len(got) != 4 {
+		t.Errorf("nvidia-smi ran %d times in all, want 4: %q", len(got), got)
+	}
+}
+
+// countingStream returns a commandStream running script, which records the
+// lines it prints and the times it is started.
+func countingStream(t *testing.T, script string, exited func(err error, stderr string) streamExit) (*commandStream, func() ([]string, int)) {
+	t.Helper()
+
+	s, _ := fakeNvidiaSmi(t, script)
+
+	var mu sync.Mutex
+	var lines []string
+	starts := 0
+	stream := &commandStream{
+		name: "test",
+		path: s.path,
+		args: func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			starts++
+			return nil
+		},
+		handle: func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, line)
+		},
+		exited: exited,
+	}
+	return stream, func() ([]string, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(lines), starts
+	}
+}
+
+// waitFor polls until done reports true or timeout passes.
+func waitFor(timeout time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestCommandStreamRestartAtOnce(t *testing.T) {
+	var mu sync.Mutex
+	exits := 0
+	stream, state := countingStream(t, "echo sample", func(err error, stderr string) streamExit {
+		mu.Lock()
+		defer mu.Unlock()
+		exits++
+		if exits <= 2 {
+			return streamRestart
+		}
+		return streamBackoff
+	})
+
+	stream.start()
+	defer stream.Close()
+
+	// the first two exits restart the command at once, well within the backoff
+	if !waitFor(streamMinBackoff/2, func() bool { _, starts := state(); return starts >= 3 }) {
+		_, starts := state()
+		t.Fatalf("started %d times, want 3 without a delay", starts)
+	}
+	if lines, _ := state(); len(lines) < 3 || lines[0] != "sample" {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestCommandStreamBackoff(t *testing.T) {
+	stream, state := countingStream(t, "echo sample", func(error, string) streamExit { return streamBackoff })
+
+	started := time.Now()
+	stream.start()
+
+	if !waitFor(3*streamMinBackoff, func() bool { _, starts := state(); return starts >= 2 }) {
+		t.Fatal("the command was not restarted")
+	}
+	if elapsed := time.Since(started); elapsed < streamMinBackoff {
+		t.Errorf("restarted after %v, want at least %v", elapsed, streamMinBackoff)
+	}
+
+	// the second backoff is twice as long; Close must not wait for it
+	closed := make(chan struct{})
+	go func() {
+		stream.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(streamMinBackoff):
+		t.Fatal("Close waited for the backoff")
+	}
+	if _, starts := state(); starts != 2 {
+		t.Errorf("started %d times, want 2", starts)
+	}
+}
+
+func TestGPUStreamMonitorUnsupported(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, `echo "Failed to process command line: dmon is Not Supported" >&2; exit 1`)
+	g := &gpuStream{source: s, interval: time.Second, outputs: make(map[string]cachedOutput)}
+	s.stream = g
+	g.dmon = &commandStream{
+		name:   "dmon",
+		path:   s.path,
+		args:   g.monitorArgs,
+		handle: g.handleMonitor,
+		exited: g.monitorExited,
+	}
+
+	g.dmon.start()
+	defer g.dmon.Close()
+
+	if !waitFor(5*time.Second, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.unsupported["dmon"]
+	}) {
+		t.Fatal("dmon was not marked unsupported")
+	}
+
+	// dmon is neither restarted after the backoff nor run once instead
+	time.Sleep(streamMinBackoff + streamMinBackoff/2)
+	metrics := []types.GPUMetrics{{GPUID: 0}}
+	if err := s.addPCIeThroughput(context.Background(), metrics); err != nil {
+		t.Errorf("addPCIeThroughput: %v", err)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %q, want dmon once", got)
+	}
+}
+
+func TestCommandStreamClose(t *testing.T) {
+	stream, state := countingStream(t, "echo sample; exec sleep 60", func(error, string) streamExit { return streamBackoff })
+	stream.start()
+
+	if !waitFor(5*time.Second, func() bool { lines, _ := state(); return len(lines) == 1 }) {
+		t.Fatal("the command printed nothing")
+	}
+
+	// Close kills the running command instead of waiting for it to exit
+	closed := make(chan struct{})
+	go func() {
+		stream.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the command")
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+var (
+	// topologyGPUPattern matches a GPU row or column name of nvidia-smi
+	// topo -m, e.g. "GPU0".
+	topologyGPUPattern = regexp.MustCompile(`^GPU(\d+)$`)
+
+	// nicLegendPattern matches an entry of the NIC legend of nvidia-smi
+	// topo -m, e.g. "  NIC0: mlx5_0".
+	nicLegendPattern = regexp.MustCompile(`^\s*(NIC\d+): (\S+)\s*$`)
+
+	// escapePattern matches the terminal escape sequences nvidia-smi uses
+	// to underline the topo -m header.
+	escapePattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// topologyAffinityColumns are the columns of nvidia-smi topo -m that follow
+// the device columns, in order. Older drivers print only the first.
+var topologyAffinityColumns = []string{"CPU Affinity", "NUMA Affinity", "GPU NUMA ID"}
+
+// Topology reads the connection matrix of nvidia-smi topo -m. It does not
+// change while the driver is loaded, so it is read once and a copy of it is
+// returned afterwards. GPU UUIDs and names are not part of it and are left
+// for the Collector to fill in.
+func (s *nvidiaSmiSource) Topology(ctx context.Context) (*types.Topology, error) {
+	s.mu.Lock()
+	topology := s.topology
+	s.mu.Unlock()
+
+	if topology == nil {
+		output, err := exec.CommandContext(ctx, s.path, "topo", "-m").Output()
+		if err != nil {
+			return nil, err
+		}
+
+		if topology, err = parseTopology(string(output)); err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		s.topology = topology
+		s.mu.Unlock()
+	}
+
+	copied := *topology
+	copied.GPUs = append([]types.TopologyGPU(nil), topology.GPUs...)
+	copied.NICs = append([]types.TopologyNIC(nil), topology.NICs...)
+	return &copied, nil
+}
+
+// parseTopology parses the output of nvidia-smi topo -m: a tab-separated
+// matrix with a row and a column per GPU and NIC, followed by the CPU and
+// NUMA affinity of each GPU, and a legend naming the NICs.
+func parseTopology(output string) (*types.Topology, error) {
+	lines := strings.Split(escapePattern.ReplaceAllString(output, ""), "\n")
+
+	var header []string
+	var rows [][]string
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if header != nil {
+				break
+			}
+			continue
+		}
+
+		cells := strings.Split(line, "\t")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+		if header == nil {
+			header = cells[1:]
+			continue
+		}
+		rows = append(rows, cells)
+	}
+	if header == nil {
+		return nil, errors.New("no topology matrix in nvidia-smi output")
+	}
+
+	// device columns come first; every other column is an affinity
+	var devices []string
+	for _, column := range header {
+		if column == "" {
+			continue
+		}
+		if isAffinityColumn(column) {
+			break
+		}
+		devices = append(devices, column)
+	}
+
+	nicDevices := make(map[string]string)
+	for _, line := range lines {
+		if match := nicLegendPattern.FindStringSubmatch(line); match != nil {
+			nicDevices[match[1]] = match[2]
+		}
+	}
+
+	topology := &types.Topology{}
+	for _, column := range devices {
+		if topologyGPUPattern.MatchString(column) {
+			continue
+		}
+		// older drivers name NICs by device rather than NIC#
+		device := nicDevices[column]
+		if device == "" {
+			device = column
+		}
+		topology.NICs = append(topology.NICs, types.TopologyNIC{Name: column, Device: device})
+	}
+
+	for _, cells := range rows {
+		match := topologyGPUPattern.FindStringSubmatch(cells[0])
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+
+		gpu := types.TopologyGPU{
+			GPUID:     index,
+			GPUNUMAID: -1,
+			GPULinks:  make(map[int]string),
+			NICLinks:  make(map[string]string),
+		}
+
+		values := cells[1:]
+		for i, column := range devices {
+			if i >= len(values) || values[i] == "X" || values[i] == "" {
+				continue
+			}
+			if peer := topologyGPUPattern.FindStringSubmatch(column); peer != nil {
+				peerIndex, _ := strconv.Atoi(peer[1])
+				gpu.GPULinks[peerIndex] = values[i]
+			} else {
+				gpu.NICLinks[column] = values[i]
+			}
+		}
+
+		// affinity values may be separated by more than one tab, so they
+		// are matched to their columns by order rather than position
+		var affinities []string
+		if len(values) > len(devices) {
+			for _, value := range values[len(devices):] {
+				if value != "" {
+					affinities = append(affinities, value)
+				}
+			}
+		}
+		for i, value := range affinities {
+			if i >= len(topologyAffinityColumns) || notAvailable(value) {
+				continue
+			}
+			switch topologyAffinityColumns[i] {
+			case "CPU Affinity":
+				gpu.CPUAffinity = value
+			case "NUMA Affinity":
+				gpu.NUMAAffinity = value
+			case "GPU NUMA ID":
+				gpu.GPUNUMAID = detailID(value)
+			}
+		}
+
+		topology.GPUs = append(topology.GPUs, gpu)
+	}
+	if len(topology.GPUs) == 0 {
+		return nil, errors.New("no GPUs in topology matrix")
+	}
+
+	return topology, nil
+}
+
+// isAffinityColumn reports whether a topo -m column holds affinities
+// rather than link types.
+func isAffinityColumn(column string) bool {
+	for _, name := range topologyAffinityColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
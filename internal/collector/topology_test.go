@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// sampleTopology is nvidia-smi topo -m output for two NVLinked GPUs and a NIC.
+var sampleTopology = strings.Join([]string{
+	"\tGPU0\tGPU1\tNIC0\tCPU Affinity\tNUMA Affinity\tGPU NUMA ID",
+	"GPU0\t X \tNV2\tPXB\t0-15\t0\t\tN/A",
+	"GPU1\tNV2\t X \tPHB\t0-15\t0\t\tN/A",
+	"NIC0\tPXB\tPHB\t X ",
+	"",
+	"Legend:",
+	"",
+	"  X    = Self",
+	"",
+	"NIC Legend:",
+	"",
+	"  NIC0: mlx5_0",
+	"",
+}, "\n")
+
+func TestTopologyCached(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, "cat <<'OUT'\n"+sampleTopology+"OUT")
+
+	first, err := s.Topology(context.Background())
+	if err != nil {
+		t.Fatalf("Topology: %v", err)
+	}
+	want := &types.Topology{
+		GPUs: []types.TopologyGPU{
+			{GPUID: 0, CPUAffinity: "0-15", NUMAAffinity: "0", GPUNUMAID: -1, GPULinks: map[int]string{1: "NV2"}, NICLinks: map[string]string{"NIC0": "PXB"}},
+			{GPUID: 1, CPUAffinity: "0-15", NUMAAffinity: "0", GPUNUMAID: -1, GPULinks: map[int]string{0: "NV2"}, NICLinks: map[string]string{"NIC0": "PHB"}},
+		},
+		NICs: []types.TopologyNIC{{Name: "NIC0", Device: "mlx5_0"}},
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("Topology = %+v, want %+v", first, want)
+	}
+
+	// Callers fill in the copy they get; the cache must not see it.
+	first.Hostname = "test"
+	first.GPUs[0].GPUUUID = "GPU-0"
+
+	second, err := s.Topology(context.Background())
+	if err != nil {
+		t.Fatalf("Topology: %v", err)
+	}
+	if !reflect.DeepEqual(second, want) {
+		t.Errorf("cached Topology = %+v, want %+v", second, want)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %d times, want once: %q", len(got), got)
+	}
+}
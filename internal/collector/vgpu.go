@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// vgpuHostMode is the virtualization_mode of a GPU that hosts vGPUs.
+const vgpuHostMode = "Host VGPU"
+
+// VGPUs enumerates the active vGPU instances from nvidia-smi vgpu -q on the
+// GPUs as of when GPUs last ran. It returns nothing unless a GPU was hosting
+// vGPUs then, so that hosts without vGPU support do not run nvidia-smi vgpu
+// at all.
+func (s *nvidiaSmiSource) VGPUs(ctx context.Context) ([]types.VGPU, error) {
+	s.mu.Lock()
+	vgpuHost, gpus := s.vgpuHost, s.gpus
+	s.mu.Unlock()
+
+	if !vgpuHost {
+		return nil, nil
+	}
+
+	output, err := exec.CommandContext(ctx, s.path, "vgpu", "-q").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vGPUs: %w", err)
+	}
+	sections := parseDetails(string(output)).gpus()
+
+	var vgpus []types.VGPU
+	var errs []error
+	for _, gpu := range gpus {
+		section, ok := sections[normalizeBusID(gpu.pciBusID)]
+		if !ok {
+			continue
+		}
+
+		for _, node := range section.all("vGPU ID") {
+			vgpu, err := parseVGPU(node)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("GPU %d: %w", gpu.id, err))
+			}
+
+			vgpu.GPUID = gpu.id
+			vgpu.GPUUUID = gpu.uuid
+			vgpu.GPUName = gpu.name
+			vgpus = append(vgpus, vgpu)
+		}
+	}
+
+	return vgpus, errors.Join(errs...)
+}
+
+// parseVGPU reads a "vGPU ID" entry of nvidia-smi vgpu -q. Values that
+// cannot be parsed are left zero and reported in the returned error.
+func parseVGPU(node *detailNode) (types.VGPU, error) {
+	vgpu := types.VGPU{
+		ID:                 node.value,
+		UUID:               node.get("vGPU UUID"),
+		TypeName:           node.get("vGPU Name"),
+		VMName:             node.get("VM Name"),
+		VMUUID:             node.get("VM UUID"),
+		GuestDriverVersion: node.get("Guest Driver Version"),
+		LicenseStatus:      node.get("License Status"),
+		GPUInstanceID:      detailID(node.get("GPU Instance ID")),
+	}
+
+	var errs []error
+	for _, size := range []struct {
+		value *uint64
+		key   string
+	}{
+		{&vgpu.TotalMemory, "Total"},
+		{&vgpu.UsedMemory, "Used"},
+		{&vgpu.FreeMemory, "Free"},
+	} {
+		var err error
+		if *size.value, err = node.bytes("FB Memory Usage", size.key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// older drivers report only used and free framebuffer
+	if vgpu.TotalMemory == 0 {
+		vgpu.TotalMemory = vgpu.UsedMemory + vgpu.FreeMemory
+	}
+
+	for _, number := range []struct {
+		value *float64
+		path  []string
+	}{
+		{&vgpu.GPUUtilization, []string{"Utilization", "Gpu"}},
+		{&vgpu.MemoryUtilization, []string{"Utilization", "Memory"}},
+		{&vgpu.EncoderUtilization, []string{"Utilization", "Encoder"}},
+		{&vgpu.DecoderUtilization, []string{"Utilization", "Decoder"}},
+		{&vgpu.EncoderAverageFPS, []string{"Encoder Stats", "Average FPS"}},
+		{&vgpu.EncoderAverageLatency, []string{"Encoder Stats", "Average Latency"}},
+	} {
+		var err error
+		if *number.value, err = node.float(number.path...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// nvidia-smi reports encode latency in microseconds
+	vgpu.EncoderAverageLatency /= 1e6
+
+	if sessions := node.get("Encoder Stats", "Active Sessions"); sessions != "" {
+		var err error
+		if vgpu.EncoderSessions, err = strconv.Atoi(sessions); err != nil {
+			errs = append(errs, fmt.Errorf("Encoder Stats/Active Sessions: %w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return vgpu, fmt.Errorf("vGPU %s: %w", vgpu.ID, err)
+	}
+	return vgpu, nil
+}
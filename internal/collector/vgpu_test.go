@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// sampleVGPUQuery is nvidia-smi vgpu -q output for a GPU hosting two vGPUs:
+// one with a licensed guest driver, and one backed by a MIG instance whose
+// guest driver is not loaded, as reported by an older driver without the
+// framebuffer total.
+const sampleVGPUQuery = `
+GPU 00000000:3B:00.0
+    Active vGPUs                          : 2
+    vGPU ID                               : 3251634213
+        VM UUID                           : ee7b7a4b-388a-4357-a425-5318b2c65b3f
+        VM Name                           : vm-train-01
+        vGPU Name                         : GRID A100-4C
+        vGPU Type                         : 473
+        vGPU UUID                         : 3c0cb5d2-d8c1-11ee-8f3b-0242ac120002
+        Guest Driver Version              : 535.104.05
+        License Status                    : Licensed (Expiry: 2024-12-31 23:59:59 GMT)
+        GPU Instance ID                   : N/A
+        Accounting Mode                   : Disabled
+        FB Memory Usage
+            Total                         : 4096 MiB
+            Used                          : 1024 MiB
+            Free                          : 3072 MiB
+        Utilization
+            Gpu                           : 25 %
+            Memory                        : 10 %
+            Encoder                       : 5 %
+            Decoder                       : 0 %
+        Encoder Stats
+            Active Sessions               : 1
+            Average FPS                   : 30
+            Average Latency               : 2000
+    vGPU ID                               : 3251634214
+        VM UUID                           : 5d6a1c9e-3b1f-4f0e-9d8e-1a2b3c4d5e6f
+        VM Name                           : vm-infer-02
+        vGPU Name                         : GRID A100-1-5C
+        vGPU UUID                         : 7a1e4f20-d8c1-11ee-8f3b-0242ac120002
+        Guest Driver Version              : N/A
+        License Status                    : Unlicensed (Unrestricted)
+        GPU Instance ID                   : 3
+        FB Memory Usage
+            Used                          : 0 MiB
+            Free                          : 5120 MiB
+        Utilization
+            Gpu                           : N/A
+            Memory                        : N/A
+            Encoder                       : N/A
+            Decoder                       : N/A
+        Encoder Stats
+            Active Sessions               : N/A
+            Average FPS                   : N/A
+            Average Latency               : N/A
+`
+
+// vgpuHostGPU is a GPU in the Host VGPU virtualization mode.
+var vgpuHostGPU = types.GPUMetrics{
+	GPUID:              0,
+	UUID:               "GPU-00000000-0000-0000-0000-000000000000",
+	GPUName:            "NVIDIA A100-PCIE-40GB",
+	PCIBusID:           "00000000:3B:00.0",
+	VirtualizationMode: vgpuHostMode,
+}
+
+func TestVGPUs(t *testing.T) {
+	s, _ := fakeNvidiaSmi(t, "cat <<'OUT'\n"+sampleVGPUQuery+"OUT")
+	s.setState([]types.GPUMetrics{vgpuHostGPU})
+
+	vgpus, err := s.VGPUs(context.Background())
+	if err != nil {
+		t.Fatalf("VGPUs: %v", err)
+	}
+
+	want := []types.VGPU{
+		{
+			GPUID:                 0,
+			GPUUUID:               "GPU-00000000-0000-0000-0000-000000000000",
+			GPUName:               "NVIDIA A100-PCIE-40GB",
+			ID:                    "3251634213",
+			UUID:                  "3c0cb5d2-d8c1-11ee-8f3b-0242ac120002",
+			TypeName:              "GRID A100-4C",
+			VMName:                "vm-train-01",
+			VMUUID:                "ee7b7a4b-388a-4357-a425-5318b2c65b3f",
+			GuestDriverVersion:    "535.104.05",
+			LicenseStatus:         "Licensed (Expiry: 2024-12-31 23:59:59 GMT)",
+			GPUInstanceID:         -1,
+			TotalMemory:           4096 * mib,
+			UsedMemory:            1024 * mib,
+			FreeMemory:            3072 * mib,
+			GPUUtilization:        25,
+			MemoryUtilization:     10,
+			EncoderUtilization:    5,
+			EncoderSessions:       1,
+			EncoderAverageFPS:     30,
+			EncoderAverageLatency: 0.002,
+		},
+		{
+			GPUID:         0,
+			GPUUUID:       "GPU-00000000-0000-0000-0000-000000000000",
+			GPUName:       "NVIDIA A100-PCIE-40GB",
+			ID:            "3251634214",
+			UUID:          "7a1e4f20-d8c1-11ee-8f3b-0242ac120002",
+			TypeName:      "GRID A100-1-5C",
+			VMName:        "vm-infer-02",
+			VMUUID:        "5d6a1c9e-3b1f-4f0e-9d8e-1a2b3c4d5e6f",
+			LicenseStatus: "Unlicensed (Unrestricted)",
+			GPUInstanceID: 3,
+			TotalMemory:   5120 * mib,
+			FreeMemory:    5120 * mib,
+		},
+	}
+	if !reflect.DeepEqual(vgpus, want) {
+		t.Errorf("VGPUs =\n%+v\nwant\n%+v", vgpus, want)
+	}
+}
+
+func TestVGPUsNotHost(t *testing.T) {
+	s, calls := fakeNvidiaSmi(t, "cat <<'OUT'\n"+sampleVGPUQuery+"OUT")
+	gpu := vgpuHostGPU
+	gpu.VirtualizationMode = "None"
+	s.setState([]types.GPUMetrics{gpu})
+
+	vgpus, err := s.VGPUs(context.Background())
+	if vgpus != nil || err != nil {
+		t.Errorf("VGPUs = %v, %v, want nil, nil", vgpus, err)
+	}
+	if got := calls(); got != nil {
+		t.Errorf("nvidia-smi ran without a vGPU host: %q", got)
+	}
+}
+
+func TestParseVGPUInvalidValue(t *testing.T) {
+	output := `
+GPU 00000000:3B:00.0
+    vGPU ID                               : 1
+        vGPU Name                         : GRID A100-4C
+        FB Memory Usage
+            Total                         : 4096 MiB
+        Utilization
+            Gpu                           : busy
+`
+	node := parseDetails(output).gpus()["00000000:3B:00.0"].all("vGPU ID")[0]
+
+	// the values that parse are kept
+	vgpu, err := parseVGPU(node)
+	if err == nil {
+		t.Error("parseVGPU did not report the invalid utilization")
+	}
+	if vgpu.TypeName != "GRID A100-4C" || vgpu.TotalMemory != 4096*mib || vgpu.GPUUtilization != 0 {
+		t.Errorf("parseVGPU = %+v", vgpu)
+	}
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// xidPattern matches the driver's Xid report, e.g.
+// "NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, name=python, GPU has fallen off the bus."
+// Older drivers omit the "PCI:" prefix.
+var xidPattern = regexp.MustCompile(`NVRM: Xid \((?:PCI:)?([0-9A-Fa-f:.]+)\): (\d+)(.*)`)
+
+// xidPIDPattern matches the PID reported with some Xids.
+var xidPIDPattern = regexp.MustCompile(`pid=(\d+)`)
+
+// xidPollInterval is how often a regular file is checked for new lines
+// once its end has been reached.
+const xidPollInterval = time.Second
+
+// xidEvent is one Xid error logged by the driver.
+type xidEvent struct {
+	pciAddress string // as returned by pciLocation
+	xid        int
+	pid        int // 0 if not reported
+}
+
+// xidCounts holds the Xid errors seen for one PCI address.
+type xidCounts struct {
+	counts map[int]uint64
+	last   xidEvent
+}
+
+// xidWatcher follows the kernel log and counts the Xid errors it contains.
+// It reads /dev/kmsg, which replays the retained log before blocking for new
+// records, or a regular file, which it tails.
+type xidWatcher struct {
+	file *os.File
+
+	mu     sync.Mutex
+	byPCI  map[string]*xidCounts
+	closed bool
+}
+
+// newXIDWatcher opens path and starts counting Xid errors in the background.
+func newXIDWatcher(path string) (*xidWatcher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &xidWatcher{
+		file:  file,
+		byPCI: make(map[string]*xidCounts),
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// run reads the log until the watcher is closed.
+func (w *xidWatcher) run() {
+	reader := bufio.NewReader(w.file)
+
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			w.handle(strings.TrimSuffix(partial, "\n"))
+			partial = ""
+			continue
+		}
+
+		switch {
+		case w.isClosed():
+			return
+		case errors.Is(err, io.EOF):
+			// end of a regular file; wait for more to be appended
+			time.Sleep(xidPollInterval)
+		case errors.Is(err, syscall.EPIPE):
+			// /dev/kmsg overwrote records before we read them
+			partial = ""
+		default:
+			log.Printf("Stopped reading Xid errors: %v", err)
+			return
+		}
+	}
+}
+
+// handle counts line if it is an Xid report.
+func (w *xidWatcher) handle(line string) {
+	event, ok := parseXID(line)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	counts, ok := w.byPCI[event.pciAddress]
+	if !ok {
+		counts = &xidCounts{counts: make(map[int]uint64)}
+		w.byPCI[event.pciAddress] = counts
+	}
+	counts.counts[event.xid]++
+	counts.last = event
+}
+
+// snapshot returns a copy of the counts keyed by PCI address.
+func (w *xidWatcher) snapshot() map[string]xidCounts {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result := make(map[string]xidCounts, len(w.byPCI))
+	for address, counts := range w.byPCI {
+		copied := xidCounts{counts: make(map[int]uint64, len(counts.counts)), last: counts.last}
+		for xid, n := range counts.counts {
+			copied.counts[xid] = n
+		}
+		result[address] = copied
+	}
+	return result
+}
+
+func (w *xidWatcher) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// Close stops the watcher.
+func (w *xidWatcher) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// parseXID parses a kernel log line, in /dev/kmsg or dmesg format, that
+// reports an Xid error.
+func parseXID(line string) (xidEvent, bool) {
+	match := xidPattern.FindStringSubmatch(line)
+	if match == nil {
+		return xidEvent{}, false
+	}
+
+	address, ok := pciLocation(match[1])
+	if !ok {
+		return xidEvent{}, false
+	}
+	xid, err := strconv.Atoi(match[2])
+	if err != nil {
+		return xidEvent{}, false
+	}
+
+	event := xidEvent{pciAddress: address, xid: xid}
+	if pid := xidPIDPattern.FindStringSubmatch(match[3]); pid != nil {
+		event.pid, _ = strconv.Atoi(pid[1])
+	}
+	return event, true
+}
+
+// pciLocation converts a PCI address such as "0000:3b:00" from the kernel
+// log or "00000000:3B:00.0" from nvidia-smi to a common "domain:bus:device"
+// form, ignoring the function.
+func pciLocation(address string) (string, bool) {
+	address, _, _ = strings.Cut(address, ".")
+	parts := strings.Split(address, ":")
+	if len(parts) == 2 {
+		parts = append([]string{"0"}, parts...)
+	}
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	var values [3]uint64
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 16, 32)
+		if err != nil {
+			return "", false
+		}
+		values[i] = value
+	}
+	return fmt.Sprintf("%04x:%02x:%02x", values[0], values[1], values[2]), true
+}
@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// sampleKernelLog holds Xid reports in /dev/kmsg and dmesg format, from
+// current and older drivers, among unrelated lines.
+const sampleKernelLog = `6,1023,5210934,-;NVRM: loading NVIDIA UNIX x86_64 Kernel Module  550.54.15
+4,1024,5210935,-;NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, name=python, GPU has fallen off the bus.
+4,1025,5210936,-;NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, name=python, GPU has fallen off the bus.
+[ 5211.000000] NVRM: Xid (PCI:0000:3b:00): 13, pid=4321, name=train, Graphics SM Warp Exception
+[ 5212.000000] NVRM: Xid (0000:86:00): 48, An uncorrectable double bit error (DBE) has been detected on GPU
+4,1026,5213000,-;NVRM: Xid (PCI:0000:01:00): 31, pid=99, name=fake-app, Ch 00000008, intr 10000000. MMU Fault
+4,1027,5213001,-;NVRM: GPU at PCI:0000:01:00: GPU-00000000-0000-0000-0000-000000000000
+`
+
+func TestParseXID(t *testing.T) {
+	tests := []struct {
+		line string
+		want xidEvent
+		ok   bool
+	}{
+		{
+			line: "4,1024,5210935,-;NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, name=python, GPU has fallen off the bus.",
+			want: xidEvent{pciAddress: "0000:3b:00", xid: 79, pid: 1234},
+			ok:   true,
+		},
+		{
+			line: "[ 5212.000000] NVRM: Xid (0000:86:00): 48, An uncorrectable double bit error (DBE) has been detected on GPU",
+			want: xidEvent{pciAddress: "0000:86:00", xid: 48},
+			ok:   true,
+		},
+		{
+			line: "NVRM: Xid (PCI:0000:3B:00): 63, pid='<unknown>', name=<unknown>, Row Remapping",
+			want: xidEvent{pciAddress: "0000:3b:00", xid: 63},
+			ok:   true,
+		},
+		{line: "NVRM: loading NVIDIA UNIX x86_64 Kernel Module  550.54.15"},
+		{line: "NVRM: Xid (PCI:0000:zz:00): 79, GPU has fallen off the bus."},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseXID(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseXID(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPCILocation(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		ok      bool
+	}{
+		{address: "0000:3b:00", want: "0000:3b:00", ok: true},
+		{address: "00000000:3B:00.0", want: "0000:3b:00", ok: true},
+		{address: "0000:3B:00.1", want: "0000:3b:00", ok: true},
+		{address: "3b:00", want: "0000:3b:00", ok: true},
+		{address: "00000001:01:1f.0", want: "0001:01:1f", ok: true},
+		{address: "3b"},
+		{address: "0000:3b:00:00"},
+		{address: "0000:xx:00"},
+	}
+
+	for _, tt := range tests {
+		got, ok := pciLocation(tt.address)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("pciLocation(%q) = %q, %v, want %q, %v", tt.address, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// waitForXIDs polls w until it has counted n Xid errors.
+func waitForXIDs(t *testing.T, w *xidWatcher, n uint64) map[string]xidCounts {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snapshot := w.snapshot()
+		var total uint64
+		for _, counts := range snapshot {
+			for _, count := range counts.counts {
+				total += count
+			}
+		}
+		if total >= n || time.Now().After(deadline) {
+			return snapshot
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestXIDWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kmsg")
+	if err := os.WriteFile(path, []byte(sampleKernelLog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newXIDWatcher(path)
+	if err != nil {
+		t.Fatalf("newXIDWatcher: %v", err)
+	}
+	defer w.Close()
+
+	want := map[string]xidCounts{
+		"0000:3b:00": {counts: map[int]uint64{79: 2, 13: 1}, last: xidEvent{pciAddress: "0000:3b:00", xid: 13, pid: 4321}},
+		"0000:86:00": {counts: map[int]uint64{48: 1}, last: xidEvent{pciAddress: "0000:86:00", xid: 48}},
+		"0000:01:00": {counts: map[int]uint64{31: 1}, last: xidEvent{pciAddress: "0000:01:00", xid: 31, pid: 99}},
+	}
+	if got := waitForXIDs(t, w, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot = %+v, want %+v", got, want)
+	}
+
+	// Lines appended later are picked up when the file is tailed.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("4,1028,5214000,-;NVRM: Xid (PCI:0000:86:00): 48, An uncorrectable double bit error\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if got := waitForXIDs(t, w, 6)["0000:86:00"].counts[48]; got != 2 {
+		t.Errorf("Xid 48 count after append = %d, want 2", got)
+	}
+}
+
+func TestCollectXIDErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kmsg")
+	if err := os.WriteFile(path, []byte(sampleKernelLog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewWithSource(types.CollectorConfig{HostnameOverride: "test", KmsgPath: path}, NewFakeSource())
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.CollectGPUMetrics(); err != nil {
+		t.Fatalf("CollectGPUMetrics: %v", err)
+	}
+	waitForXIDs(t, c.xid, 5)
+
+	got := c.CollectXIDErrors()
+	want := []types.XIDErrors{
+		{
+			Hostname: "test",
+			GPUID:    0,
+			GPUUUID:  "GPU-00000000-0000-0000-0000-000000000000",
+			GPUName:  "NVIDIA Fake GPU",
+			PCIBusID: "00000000:01:00.0",
+			Counts:   map[int]uint64{31: 1},
+			LastXID:  31,
+			LastPID:  99,
+		},
+		{
+			Hostname: "test",
+			GPUID:    -1,
+			PCIBusID: "0000:3b:00",
+			Counts:   map[int]uint64{79: 2, 13: 1},
+			LastXID:  13,
+			LastPID:  4321,
+		},
+		{
+			Hostname: "test",
+			GPUID:    -1,
+			PCIBusID: "0000:86:00",
+			Counts:   map[int]uint64{48: 1},
+			LastXID:  48,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectXIDErrors = %+v, want %+v", got, want)
+	}
+}
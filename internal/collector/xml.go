@@ -0,0 +1,723 @@
+package collector
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+)
+
+// smiLog is the document printed by nvidia-smi -q -x. Only the elements the
+// exporter reads are declared. Elements that drivers have renamed are
+// declared under each name, and those whose children vary between drivers
+// are decoded as generic elements.
+type smiLog struct {
+	XMLName       xml.Name `xml:"nvidia_smi_log"`
+	Timestamp     string   `xml:"timestamp"` // e.g. "Thu Oct 16 10:00:00 2026"
+	DriverVersion string   `xml:"driver_version"`
+	CUDAVersion   string   `xml:"cuda_version"`
+	GPUs          []smiGPU `xml:"gpu"`
+}
+
+// smiGPU is a <gpu> element of nvidia-smi -q -x. It carries no index;
+// GPUs are listed in index order.
+type smiGPU struct {
+	ID                 string `xml:"id,attr"` // PCI bus ID
+	ProductName        string `xml:"product_name"`
+	DisplayActive      string `xml:"display_active"`
+	PersistenceMode    string `xml:"persistence_mode"`
+	CurrentMIG         string `xml:"mig_mode>current_mig"`
+	AccountingMode     string `xml:"accounting_mode"`
+	Serial             string `xml:"serial"`
+	UUID               string `xml:"uuid"`
+	VBIOSVersion       string `xml:"vbios_version"`
+	BoardPartNumber    string `xml:"board_part_number"`
+	VirtualizationMode string `xml:"gpu_virtualization_mode>virtualization_mode"`
+
+	PCI struct {
+		BusID          string `xml:"pci_bus_id"`
+		MaxLinkGen     string `xml:"pci_gpu_link_info>pcie_gen>max_link_gen"`
+		CurrentLinkGen string `xml:"pci_gpu_link_info>pcie_gen>current_link_gen"`
+		MaxLinkWidth   string `xml:"pci_gpu_link_info>link_widths>max_link_width"`     // e.g. "16x"
+		LinkWidth      string `xml:"pci_gpu_link_info>link_widths>current_link_width"` // e.g. "16x"
+		TxThroughput   string `xml:"tx_util"`                                          // e.g. "0 KB/s"
+		RxThroughput   string `xml:"rx_util"`                                          // e.g. "0 KB/s"
+	} `xml:"pci"`
+
+	FanSpeed              string      `xml:"fan_speed"`
+	PerformanceState      string      `xml:"performance_state"`
+	ClocksEventReasons    *smiElement `xml:"clocks_event_reasons"`
+	ClocksThrottleReasons *smiElement `xml:"clocks_throttle_reasons"` // before driver 535
+
+	FBMemory        smiMemory `xml:"fb_memory_usage"`
+	BAR1Memory      smiMemory `xml:"bar1_memory_usage"`
+	ProtectedMemory smiMemory `xml:"cc_protected_memory_usage"`
+	ComputeMode     string    `xml:"compute_mode"`
+
+	Utilization struct {
+		GPU     string `xml:"gpu_util"`
+		Memory  string `xml:"memory_util"`
+		Encoder string `xml:"encoder_util"`
+		Decoder string `xml:"decoder_util"`
+	} `xml:"utilization"`
+
+	EncoderStats struct {
+		SessionCount   string `xml:"session_count"`
+		AverageFPS     string `xml:"average_fps"`
+		AverageLatency string `xml:"average_latency"` // microseconds
+	} `xml:"encoder_stats"`
+
+	CurrentECC string `xml:"ecc_mode>current_ecc"`
+	ECCErrors  struct {
+		Volatile  *smiElement `xml:"volatile"`
+		Aggregate *smiElement `xml:"aggregate"`
+	} `xml:"ecc_errors"`
+
+	RetiredPages struct {
+		SingleBit         string `xml:"multiple_single_bit_retirement>retired_count"`
+		DoubleBit         string `xml:"double_bit_retirement>retired_count"`
+		PendingRetirement string `xml:"pending_retirement"`
+		PendingBlacklist  string `xml:"pending_blacklist"` // before driver 450
+	} `xml:"retired_pages"`
+
+	RemappedRows struct {
+		Correctable   string `xml:"remapped_row_corr"`
+		Uncorrectable string `xml:"remapped_row_unc"`
+		Pending       string `xml:"remapped_row_pending"`
+		Failure       string `xml:"remapped_row_failure"`
+	} `xml:"remapped_rows"`
+
+	Temperature struct {
+		GPU                string `xml:"gpu_temp"`
+		Shutdown           string `xml:"gpu_temp_max_threshold"`
+		Slowdown           string `xml:"gpu_temp_slow_threshold"`
+		MaxOperating       string `xml:"gpu_temp_max_gpu_threshold"`
+		Memory             string `xml:"memory_temp"`
+		MemoryMaxOperating string `xml:"gpu_temp_max_mem_threshold"`
+	} `xml:"temperature"`
+
+	GPUPowerReadings *smiPowerReadings `xml:"gpu_power_readings"`
+	PowerReadings    *smiPowerReadings `xml:"power_readings"` // before driver 535
+
+	Clocks                    smiClocks `xml:"clocks"`
+	ApplicationsClocks        smiClocks `xml:"applications_clocks"`
+	DefaultApplicationsClocks smiClocks `xml:"default_applications_clocks"`
+	MaxClocks                 smiClocks `xml:"max_clocks"`
+
+	Fabric struct {
+		State       string `xml:"state"`
+		Status      string `xml:"status"`
+		CliqueID    string `xml:"cliqueId"`
+		ClusterUUID string `xml:"clusterUuid"`
+	} `xml:"fabric"`
+
+	Processes []smiProcess `xml:"processes>process_info"`
+}
+
+// smiMemory is a memory usage element such as <fb_memory_usage>.
+type smiMemory struct {
+	Total    string `xml:"total"`
+	Reserved string `xml:"reserved"`
+	Used     string `xml:"used"`
+	Free     string `xml:"free"`
+}
+
+// smiClocks is a clock element such as <clocks> or <max_clocks>.
+type smiClocks struct {
+	Graphics string `xml:"graphics_clock"`
+	SM       string `xml:"sm_clock"`
+	Memory   string `xml:"mem_clock"`
+	Video    string `xml:"video_clock"`
+}
+
+// smiPowerReadings is the power section of a GPU. Newer drivers report the
+// average and instant draw and call the enforced limit the current one.
+type smiPowerReadings struct {
+	PowerDraw        string `xml:"power_draw"`
+	AveragePowerDraw string `xml:"average_power_draw"`
+	InstantPowerDraw string `xml:"instant_power_draw"`
+	PowerLimit       string `xml:"power_limit"`
+	RequestedLimit   string `xml:"requested_power_limit"`
+	EnforcedLimit    string `xml:"enforced_power_limit"`
+	CurrentLimit     string `xml:"current_power_limit"`
+	DefaultLimit     string `xml:"default_power_limit"`
+	MinLimit         string `xml:"min_power_limit"`
+	MaxLimit         string `xml:"max_power_limit"`
+}
+
+// smiProcess is a <process_info> element.
+type smiProcess struct {
+	GPUInstanceID     string `xml:"gpu_instance_id"`
+	ComputeInstanceID string `xml:"compute_instance_id"`
+	PID               string `xml:"pid"`
+	Type              string `xml:"type"`
+	ProcessName       string `xml:"process_name"`
+	UsedMemory        string `xml:"used_memory"`
+}
+
+// smiElement is an element decoded generically, for sections whose child
+// names differ between drivers.
+type smiElement struct {
+	XMLName  xml.Name
+	Value    string       `xml:",chardata"`
+	Children []smiElement `xml:",any"`
+}
+
+// child returns the direct child called name, or nil.
+func (e *smiElement) child(name string) *smiElement {
+	if e == nil {
+		return nil
+	}
+	for i := range e.Children {
+		if e.Children[i].XMLName.Local == name {
+			return &e.Children[i]
+		}
+	}
+	return nil
+}
+
+// smiTimestampLayout is the layout of the timestamp of nvidia-smi -q -x.
+const smiTimestampLayout = time.ANSIC
+
+// nvidiaSmiXMLSource reads GPU metrics and processes from a single run of
+// nvidia-smi -q -x per collection. MIG devices, NVLinks, vGPUs, topology,
+// process utilization and accounting are read by the embedded
+// nvidiaSmiSource as usual: the XML lacks the profiles and placements of MIG
+// devices that nvidia-smi -L and mig -lgi provide, and has no counterpart
+// for the rest.
+type nvidiaSmiXMLSource struct {
+	*nvidiaSmiSource
+
+	xmlMu sync.Mutex
+	last  *smiLog // read by GPUs or GPUMapping and not yet used by ComputeApps
+}
+
+func newNvidiaSmiXMLSource(config types.CollectorConfig) (*nvidiaSmiXMLSource, error) {
+	s, err := newNvidiaSmiSource(config)
+	if err != nil {
+		return nil, err
+	}
+	return &nvidiaSmiXMLSource{nvidiaSmiSource: s}, nil
+}
+
+// readLog runs nvidia-smi -q -x and decodes its output.
+func (s *nvidiaSmiXMLSource) readLog(ctx context.Context) (*smiLog, error) {
+	output, err := exec.CommandContext(ctx, s.path, "-q", "-x").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var log smiLog
+	if err := xml.Unmarshal(output, &log); err != nil {
+		return nil, fmt.Errorf("failed to decode nvidia-smi XML: %w", err)
+	}
+	return &log, nil
+}
+
+// recentLog returns the log read by GPUs or GPUMapping in this collection,
+// that is since ComputeApps last ran, or nil if there is none. If take is
+// set, the log is consumed so that the next collection reads a fresh one.
+func (s *nvidiaSmiXMLSource) recentLog(take bool) *smiLog {
+	s.xmlMu.Lock()
+	defer s.xmlMu.Unlock()
+
+	log := s.last
+	if take {
+		s.last = nil
+	}
+	return log
+}
+
+// GPUs reads current GPU metrics from nvidia-smi -q -x. The log is kept for
+// GPUMapping and ComputeApps, so that one collection runs nvidia-smi once.
+// Values that cannot be parsed are left zero and reported in the returned
+// error.
+func (s *nvidiaSmiXMLSource) GPUs(ctx context.Context) ([]types.GPUMetrics, error) {
+	log, err := s.readLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.xmlMu.Lock()
+	s.last = log
+	s.xmlMu.Unlock()
+
+	metrics, err := parseSmiLog(log)
+	s.setState(metrics)
+
+	return metrics, err
+}
+
+// GPUMapping gets the mapping from GPU UUID to GPU index from the log read
+// by GPUs in this collection, or from a new one if GPUs has not read one.
+// A new log is kept for ComputeApps.
+func (s *nvidiaSmiXMLSource) GPUMapping(ctx context.Context) (map[string]int, error) {
+	log := s.recentLog(false)
+	if log == nil {
+		var err error
+		if log, err = s.readLog(ctx); err != nil {
+			return nil, err
+		}
+
+		s.xmlMu.Lock()
+		s.last = log
+		s.xmlMu.Unlock()
+	}
+
+	mapping := make(map[string]int, len(log.GPUs))
+	for i, gpu := range log.GPUs {
+		if gpu.UUID != "" {
+			mapping[gpu.UUID] = i
+		}
+	}
+	return mapping, nil
+}
+
+// ComputeApps lists the processes of each GPU in the log read by GPUs in
+// this collection, or in a new one if GPUs has not read one. Processes on
+// MIG devices carry the parent GPU's UUID and their instance IDs.
+func (s *nvidiaSmiXMLSource) ComputeApps(ctx context.Context) ([]ComputeApp, error) {
+	log := s.recentLog(true)
+	if log == nil {
+		var err error
+		if log, err = s.readLog(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	timestamp := parseSmiTimestamp(log.Timestamp)
+
+	var apps []ComputeApp
+	var errs []error
+	for i, gpu := range log.GPUs {
+		for _, process := range gpu.Processes {
+			// nvidia-smi reports N/A for processes in other containers it cannot see
+			if notAvailable(process.PID) {
+				continue
+			}
+
+			pid, err := strconv.Atoi(process.PID)
+			if err != nil {
+				errs = append(errs, &FieldError{Row: i + 1, Field: "processes/process_info/pid", Value: process.PID, Err: err})
+				continue
+			}
+
+			var usedMemory uint64
+			if !notAvailable(process.UsedMemory) {
+				if usedMemory, err = parseBytes(process.UsedMemory, ""); err != nil {
+					errs = append(errs, &FieldError{Row: i + 1, Field: "processes/process_info/used_memory", Value: process.UsedMemory, Err: err})
+				}
+			}
+
+			detail := detailProcess{
+				pid:               pid,
+				processType:       process.Type,
+				name:              process.ProcessName,
+				usedGPUMemory:     usedMemory,
+				gpuInstanceID:     detailID(process.GPUInstanceID),
+				computeInstanceID: detailID(process.ComputeInstanceID),
+			}
+
+			apps = append(apps, ComputeApp{
+				Timestamp:     timestamp,
+				GPUUUID:       gpu.UUID,
+				PID:           detail.pid,
+				ProcessName:   detail.name,
+				UsedGPUMemory: detail.usedGPUMemory,
+				Type:          processType(detail),
+
+				GPUInstanceID:     detail.gpuInstanceID,
+				ComputeInstanceID: detail.computeInstanceID,
+			})
+		}
+	}
+
+	return apps, errors.Join(errs...)
+}
+
+// parseSmiTimestamp parses the timestamp of nvidia-smi -q -x, or returns
+// the current time if it cannot.
+func parseSmiTimestamp(value string) time.Time {
+	t, err := time.ParseInLocation(smiTimestampLayout, strings.TrimSpace(value), time.Local)
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// parseSmiLog builds GPU metrics from every <gpu> element of log.
+func parseSmiLog(log *smiLog) ([]types.GPUMetrics, error) {
+	timestamp := parseSmiTimestamp(log.Timestamp)
+
+	metrics := make([]types.GPUMetrics, 0, len(log.GPUs))
+	var errs []error
+	for i := range log.GPUs {
+		metric, err := parseSmiGPU(&log.GPUs[i], i)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		metric.Timestamp = timestamp
+		metric.DriverVersion = log.DriverVersion
+		metric.CUDAVersion = log.CUDAVersion
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// parseSmiGPU converts a <gpu> element, the index-th of the log, to GPU
+// metrics. Values that cannot be parsed are left zero and reported in the
+// returned error.
+func parseSmiGPU(gpu *smiGPU, index int) (types.GPUMetrics, error) {
+	f := &smiFields{row: index + 1}
+
+	gpuName := f.text(gpu.ProductName)
+	if gpuName == "" {
+		gpuName = "unknown"
+	}
+
+	busID := f.text(gpu.PCI.BusID)
+	if busID == "" {
+		busID = gpu.ID
+	}
+
+	// newer drivers report the average draw instead of a single reading
+	power := gpu.GPUPowerReadings
+	if power == nil {
+		power = gpu.PowerReadings
+	}
+	if power == nil {
+		power = &smiPowerReadings{}
+	}
+	powerDraw := firstAvailable(power.PowerDraw, power.AveragePowerDraw, power.InstantPowerDraw)
+	powerLimit := firstAvailable(power.RequestedLimit, power.PowerLimit)
+	enforcedLimit := firstAvailable(power.CurrentLimit, power.EnforcedLimit)
+
+	reasons := gpu.ClocksEventReasons
+	reasonPrefix := "clocks_event_reason_"
+	if reasons == nil {
+		reasons = gpu.ClocksThrottleReasons
+		reasonPrefix = "clocks_throttle_reason_"
+	}
+	reason := func(name string) bool {
+		element := reasons.child(reasonPrefix + name)
+		if element == nil {
+			return false
+		}
+		return f.bool(reasonPrefix+name, element.Value)
+	}
+
+	// nvidia-smi reports encode latency in microseconds
+	encoderLatency := f.float("encoder_stats/average_latency", gpu.EncoderStats.AverageLatency) / 1e6
+
+	pendingRetirement := firstAvailable(gpu.RetiredPages.PendingRetirement, gpu.RetiredPages.PendingBlacklist)
+
+	metric := types.GPUMetrics{
+		GPUID:                         index,
+		GPUName:                       gpuName,
+		UUID:                          f.text(gpu.UUID),
+		Serial:                        f.text(gpu.Serial),
+		PCIBusID:                      busID,
+		VBIOSVersion:                  f.text(gpu.VBIOSVersion),
+		BoardPartNumber:               f.text(gpu.BoardPartNumber),
+		Temperature:                   f.float("temperature/gpu_temp", gpu.Temperature.GPU),
+		MemoryTemperature:             f.float("temperature/memory_temp", gpu.Temperature.Memory),
+		ShutdownTemperature:           f.float("temperature/gpu_temp_max_threshold", gpu.Temperature.Shutdown),
+		SlowdownTemperature:           f.float("temperature/gpu_temp_slow_threshold", gpu.Temperature.Slowdown),
+		MaxOperatingTemperature:       f.float("temperature/gpu_temp_max_gpu_threshold", gpu.Temperature.MaxOperating),
+		MemoryMaxOperatingTemperature: f.float("temperature/gpu_temp_max_mem_threshold", gpu.Temperature.MemoryMaxOperating),
+		FreeMemory:                    f.bytes("fb_memory_usage/free", gpu.FBMemory.Free),
+		UsedMemory:                    f.bytes("fb_memory_usage/used", gpu.FBMemory.Used),
+		TotalMemory:                   f.bytes("fb_memory_usage/total", gpu.FBMemory.Total),
+		ReservedMemory:                f.bytes("fb_memory_usage/reserved", gpu.FBMemory.Reserved),
+		BAR1TotalMemory:               f.bytes("bar1_memory_usage/total", gpu.BAR1Memory.Total),
+		BAR1UsedMemory:                f.bytes("bar1_memory_usage/used", gpu.BAR1Memory.Used),
+		ProtectedTotalMemory:          f.bytes("cc_protected_memory_usage/total", gpu.ProtectedMemory.Total),
+		ProtectedUsedMemory:           f.bytes("cc_protected_memory_usage/used", gpu.ProtectedMemory.Used),
+		GPUUtilization:                f.float("utilization/gpu_util", gpu.Utilization.GPU),
+		MemoryUtilization:             f.float("utilization/memory_util", gpu.Utilization.Memory),
+		EncoderUtilization:            f.float("utilization/encoder_util", gpu.Utilization.Encoder),
+		DecoderUtilization:            f.float("utilization/decoder_util", gpu.Utilization.Decoder),
+		EncoderSessions:               f.int("encoder_stats/session_count", gpu.EncoderStats.SessionCount),
+		EncoderAverageFPS:             f.float("encoder_stats/average_fps", gpu.EncoderStats.AverageFPS),
+		EncoderAverageLatency:         encoderLatency,
+		PowerDraw:                     f.float("power_draw", powerDraw),
+		PowerLimit:                    f.float("power_limit", powerLimit),
+		EnforcedPowerLimit:            f.float("enforced_power_limit", enforcedLimit),
+		PowerMinLimit:                 f.float("min_power_limit", power.MinLimit),
+		PowerMaxLimit:                 f.float("max_power_limit", power.MaxLimit),
+		PowerDefaultLimit:             f.float("default_power_limit", power.DefaultLimit),
+		Clocks:                        f.clocks("clocks", gpu.Clocks),
+		MaxClocks:                     f.clocks("max_clocks", gpu.MaxClocks),
+		ApplicationClocks:             f.clocks("applications_clocks", gpu.ApplicationsClocks),
+		DefaultApplicationClocks:      f.clocks("default_applications_clocks", gpu.DefaultApplicationsClocks),
+		ClockEventReasons: types.ClockEventReasons{
+			GPUIdle:                   reason("gpu_idle"),
+			ApplicationsClocksSetting: reason("applications_clocks_setting"),
+			SWPowerCap:                reason("sw_power_cap"),
+			HWSlowdown:                reason("hw_slowdown"),
+			HWThermalSlowdown:         reason("hw_thermal_slowdown"),
+			HWPowerBrakeSlowdown:      reason("hw_power_brake_slowdown"),
+			SWThermalSlowdown:         reason("sw_thermal_slowdown"),
+			SyncBoost:                 reason("sync_boost"),
+		},
+		ECCMode:                   f.bool("ecc_mode/current_ecc", gpu.CurrentECC),
+		ECCCorrectedVolatile:      f.eccErrors("ecc_errors/volatile", gpu.ECCErrors.Volatile, true),
+		ECCUncorrectedVolatile:    f.eccErrors("ecc_errors/volatile", gpu.ECCErrors.Volatile, false),
+		ECCCorrectedAggregate:     f.eccErrors("ecc_errors/aggregate", gpu.ECCErrors.Aggregate, true),
+		ECCUncorrectedAggregate:   f.eccErrors("ecc_errors/aggregate", gpu.ECCErrors.Aggregate, false),
+		RetiredPagesSingleBit:     f.uint("retired_pages/multiple_single_bit_retirement/retired_count", gpu.RetiredPages.SingleBit),
+		RetiredPagesDoubleBit:     f.uint("retired_pages/double_bit_retirement/retired_count", gpu.RetiredPages.DoubleBit),
+		RetiredPagesPending:       f.bool("retired_pages/pending_retirement", pendingRetirement),
+		RemappedRowsCorrectable:   f.uint("remapped_rows/remapped_row_corr", gpu.RemappedRows.Correctable),
+		RemappedRowsUncorrectable: f.uint("remapped_rows/remapped_row_unc", gpu.RemappedRows.Uncorrectable),
+		RemappedRowsPending:       f.bool("remapped_rows/remapped_row_pending", gpu.RemappedRows.Pending),
+		RemappedRowsFailure:       f.bool("remapped_rows/remapped_row_failure", gpu.RemappedRows.Failure),
+		PCIeLinkGen:               f.int("pci/current_link_gen", gpu.PCI.CurrentLinkGen),
+		PCIeLinkGenMax:            f.int("pci/max_link_gen", gpu.PCI.MaxLinkGen),
+		PCIeLinkWidth:             f.int("pci/current_link_width", strings.TrimSuffix(gpu.PCI.LinkWidth, "x")),
+		PCIeLinkWidthMax:          f.int("pci/max_link_width", strings.TrimSuffix(gpu.PCI.MaxLinkWidth, "x")),
+		PCIeRxThroughput:          f.rate("pci/rx_util", gpu.PCI.RxThroughput),
+		PCIeTxThroughput:          f.rate("pci/tx_util", gpu.PCI.TxThroughput),
+		FanSpeed:                  f.float("fan_speed", gpu.FanSpeed),
+		PerformanceState:          f.performanceState("performance_state", gpu.PerformanceState),
+		ComputeMode:               f.text(gpu.ComputeMode),
+		PersistenceMode:           f.bool("persistence_mode", gpu.PersistenceMode),
+		DisplayActive:             f.bool("display_active", gpu.DisplayActive),
+		MIGMode:                   f.bool("mig_mode/current_mig", gpu.CurrentMIG),
+		VirtualizationMode:        f.text(gpu.VirtualizationMode),
+		AccountingMode:            f.bool("accounting_mode", gpu.AccountingMode),
+		Fabric: types.GPUFabric{
+			State:       f.text(gpu.Fabric.State),
+			Status:      f.text(gpu.Fabric.Status),
+			CliqueID:    f.text(gpu.Fabric.CliqueID),
+			ClusterUUID: f.text(gpu.Fabric.ClusterUUID),
+		},
+	}
+
+	return metric, errors.Join(f.errs...)
+}
+
+// firstAvailable returns the first of values that is not a placeholder
+// such as "N/A", or "".
+func firstAvailable(values ...string) string {
+	for _, value := range values {
+		if !notAvailable(strings.TrimSpace(value)) {
+			return value
+		}
+	}
+	return ""
+}
+
+// smiFields converts the text of elements of one <gpu> element. Like
+// queryRow, each method returns the zero value for unavailable or
+// unparsable values and records a *FieldError for the latter.
+type smiFields struct {
+	row  int
+	errs []error
+}
+
+func (f *smiFields) fail(field, value string, err error) {
+	f.errs = append(f.errs, &FieldError{Row: f.row, Field: field, Value: value, Err: err})
+}
+
+// text returns value, or "" if it is not available.
+func (f *smiFields) text(value string) string {
+	value = strings.TrimSpace(value)
+	if notAvailable(value) {
+		return ""
+	}
+	return value
+}
+
+func (f *smiFields) int(field, value string) int {
+	value = f.text(value)
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		f.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+func (f *smiFields) uint(field, value string) uint64 {
+	value = f.text(value)
+	if value == "" {
+		return 0
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		f.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// float returns value without its unit, such as 85 for "85 C".
+func (f *smiFields) float(field, value string) float64 {
+	value = f.text(value)
+	if value == "" {
+		return 0
+	}
+
+	number, _ := splitUnit(value)
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		f.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// bytes returns a memory size such as "1024 MiB" in bytes.
+func (f *smiFields) bytes(field, value string) uint64 {
+	value = f.text(value)
+	if value == "" {
+		return 0
+	}
+
+	n, err := parseBytes(value, "")
+	if err != nil {
+		f.fail(field, value, err)
+		return 0
+	}
+	return n
+}
+
+// rate returns a throughput such as "120 KB/s" in bytes per second.
+func (f *smiFields) rate(field, value string) float64 {
+	value = f.text(value)
+	if value == "" {
+		return 0
+	}
+
+	number, unit := splitUnit(value)
+	multiplier, ok := byteUnits[strings.TrimSuffix(unit, "/s")]
+	if !ok {
+		f.fail(field, value, fmt.Errorf("unknown unit %q", unit))
+		return 0
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		f.fail(field, value, err)
+		return 0
+	}
+	return n * float64(multiplier)
+}
+
+// bool accepts the same flag values as queryRow.Bool.
+func (f *smiFields) bool(field, value string) bool {
+	value = f.text(value)
+	if value == "" {
+		return false
+	}
+
+	flag, err := parseFlag(value)
+	if err != nil {
+		f.fail(field, value, err)
+	}
+	return flag
+}
+
+// performanceState converts a P-state such as "P2" to its number, or -1
+// if it is not available.
+func (f *smiFields) performanceState(field, value string) int {
+	value = f.text(value)
+	if value == "" {
+		return -1
+	}
+
+	state, err := parsePState(value)
+	if err != nil {
+		f.fail(field, value, err)
+		return -1
+	}
+	return state
+}
+
+func (f *smiFields) clocks(field string, clocks smiClocks) types.GPUClocks {
+	return types.GPUClocks{
+		Graphics: f.float(field+"/graphics_clock", clocks.Graphics),
+		SM:       f.float(field+"/sm_clock", clocks.SM),
+		Memory:   f.float(field+"/mem_clock", clocks.Memory),
+		Video:    f.float(field+"/video_clock", clocks.Video),
+	}
+}
+
+// smiECCLocations maps the per-location ECC counters of drivers before 510,
+// listed under <single_bit> and <double_bit>, to ECCErrors fields.
+var smiECCLocations = map[string]func(*types.ECCErrors) *uint64{
+	"device_memory":  func(e *types.ECCErrors) *uint64 { return &e.DeviceMemory },
+	"dram":           func(e *types.ECCErrors) *uint64 { return &e.DRAM },
+	"sram":           func(e *types.ECCErrors) *uint64 { return &e.SRAM },
+	"register_file":  func(e *types.ECCErrors) *uint64 { return &e.RegisterFile },
+	"l1_cache":       func(e *types.ECCErrors) *uint64 { return &e.L1Cache },
+	"l2_cache":       func(e *types.ECCErrors) *uint64 { return &e.L2Cache },
+	"texture_memory": func(e *types.ECCErrors) *uint64 { return &e.TextureMemory },
+	"cbu":            func(e *types.ECCErrors) *uint64 { return &e.CBU },
+	"total":          func(e *types.ECCErrors) *uint64 { return &e.Total },
+}
+
+// eccErrors reads the corrected or uncorrected ECC errors of a <volatile>
+// or <aggregate> element. Newer drivers count errors in DRAM and SRAM only,
+// as <dram_correctable>, <sram_uncorrectable_parity> and so on, and report
+// no total, which is then their sum.
+func (f *smiFields) eccErrors(field string, counters *smiElement, corrected bool) types.ECCErrors {
+	var ecc types.ECCErrors
+	if counters == nil {
+		return ecc
+	}
+
+	bits := "double_bit"
+	if corrected {
+		bits = "single_bit"
+	}
+	if locations := counters.child(bits); locations != nil {
+		for _, location := range locations.Children {
+			name := location.XMLName.Local
+			if counter, ok := smiECCLocations[name]; ok {
+				*counter(&ecc) = f.uint(field+"/"+bits+"/"+name, location.Value)
+			}
+		}
+		return ecc
+	}
+
+	hasTotal := false
+	for _, counter := range counters.Children {
+		name := counter.XMLName.Local
+		memory, kind, ok := strings.Cut(name, "_")
+		if !ok || strings.HasPrefix(kind, "correctable") != corrected ||
+			!strings.HasPrefix(strings.TrimPrefix(kind, "un"), "correctable") {
+			continue
+		}
+
+		value := f.uint(field+"/"+name, counter.Value)
+		switch memory {
+		case "dram":
+			ecc.DRAM += value
+		case "sram":
+			ecc.SRAM += value
+		case "total":
+			ecc.Total += value
+			hasTotal = true
+		}
+	}
+	if !hasTotal {
+		ecc.Total = ecc.DRAM + ecc.SRAM
+	}
+
+	return ecc
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// sampleSmiLog is a trimmed nvidia-smi -q -x document for two GPUs, the
+// second running a compute process.
+const sampleSmiLog = `<?xml version="1.0" ?>
+<!DOCTYPE nvidia_smi_log SYSTEM "nvsmi_device_v12.dtd">
+<nvidia_smi_log>
+	<timestamp>Thu Oct 16 10:00:00 2026</timestamp>
+	<driver_version>550.54.15</driver_version>
+	<cuda_version>12.4</cuda_version>
+	<attached_gpus>2</attached_gpus>
+	<gpu id="00000000:3B:00.0">
+		<product_name>NVIDIA A100-SXM4-40GB</product_name>
+		<uuid>GPU-00000000-0000-0000-0000-00000000003b</uuid>
+		<pci>
+			<pci_bus_id>00000000:3B:00.0</pci_bus_id>
+		</pci>
+		<fb_memory_usage>
+			<total>40960 MiB</total>
+			<used>0 MiB</used>
+			<free>40960 MiB</free>
+		</fb_memory_usage>
+		<temperature>
+			<gpu_temp>31 C</gpu_temp>
+		</temperature>
+		<processes>
+		</processes>
+	</gpu>
+	<gpu id="00000000:86:00.0">
+		<product_name>NVIDIA A100-SXM4-40GB</product_name>
+		<uuid>GPU-00000000-0000-0000-0000-000000000086</uuid>
+		<pci>
+			<pci_bus_id>00000000:86:00.0</pci_bus_id>
+		</pci>
+		<fb_memory_usage>
+			<total>40960 MiB</total>
+			<used>1024 MiB</used>
+			<free>39936 MiB</free>
+		</fb_memory_usage>
+		<temperature>
+			<gpu_temp>45 C</gpu_temp>
+		</temperature>
+		<processes>
+			<process_info>
+				<gpu_instance_id>N/A</gpu_instance_id>
+				<compute_instance_id>N/A</compute_instance_id>
+				<pid>4242</pid>
+				<type>C</type>
+				<process_name>python</process_name>
+				<used_memory>1000 MiB</used_memory>
+			</process_info>
+		</processes>
+	</gpu>
+</nvidia_smi_log>`
+
+func TestXMLSourceOneRunPerCollection(t *testing.T) {
+	smi, calls := fakeNvidiaSmi(t, "cat <<'OUT'\n"+sampleSmiLog+"\nOUT")
+	s := &nvidiaSmiXMLSource{nvidiaSmiSource: smi}
+	ctx := context.Background()
+
+	metrics, err := s.GPUs(ctx)
+	if err != nil {
+		t.Fatalf("GPUs: %v", err)
+	}
+	if len(metrics) != 2 || metrics[1].GPUID != 1 || metrics[1].Temperature != 45 || metrics[1].UsedMemory != 1024*mib {
+		t.Errorf("GPUs = %+v", metrics)
+	}
+
+	mapping, err := s.GPUMapping(ctx)
+	if err != nil {
+		t.Fatalf("GPUMapping: %v", err)
+	}
+	wantMapping := map[string]int{
+		"GPU-00000000-0000-0000-0000-00000000003b": 0,
+		"GPU-00000000-0000-0000-0000-000000000086": 1,
+	}
+	if !reflect.DeepEqual(mapping, wantMapping) {
+		t.Errorf("GPUMapping = %v, want %v", mapping, wantMapping)
+	}
+
+	apps, err := s.ComputeApps(ctx)
+	if err != nil {
+		t.Fatalf("ComputeApps: %v", err)
+	}
+	if len(apps) != 1 || apps[0].PID != 4242 || apps[0].GPUUUID != "GPU-00000000-0000-0000-0000-000000000086" ||
+		apps[0].UsedGPUMemory != 1000*mib || apps[0].GPUInstanceID != -1 {
+		t.Errorf("ComputeApps = %+v", apps)
+	}
+
+	if got := calls(); len(got) != 1 {
+		t.Errorf("nvidia-smi ran %d times in one collection, want once: %q", len(got), got)
+	}
+
+	// ComputeApps consumed the log; a collection of processes alone reads
+	// a new one for the mapping and lists the processes from it.
+	mapping, err = s.GPUMapping(ctx)
+	if err != nil {
+		t.Fatalf("GPUMapping without GPUs: %v", err)
+	}
+	if !reflect.DeepEqual(mapping, wantMapping) {
+		t.Errorf("GPUMapping without GPUs = %v, want %v", mapping, wantMapping)
+	}
+	if apps, err := s.ComputeApps(ctx); err != nil || len(apps) != 1 {
+		t.Errorf("ComputeApps without GPUs = %+v, %v", apps, err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("nvidia-smi ran %d times in two collections, want twice: %q", len(got), got)
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// constCounterVec exposes counter values maintained outside the exporter,
+// such as error counts read from the driver, as Prometheus counters.
+// Unlike prometheus.CounterVec, values are set rather than incremented.
+type constCounterVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mu      sync.Mutex
+	samples map[string]constSample
+}
+
+type constSample struct {
+	labelValues []string
+	value       float64
+}
+
+func newConstCounterVec(name, help string, labelNames []string) *constCounterVec {
+	return &constCounterVec{
+		desc:       prometheus.NewDesc(name, help, labelNames, nil),
+		labelNames: labelNames,
+		samples:    make(map[string]constSample),
+	}
+}
+
+// Set sets the counter value for labels, which must contain every label name.
+func (v *constCounterVec) Set(labels prometheus.Labels, value float64) {
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labelValues[i] = labels[name]
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples[strings.Join(labelValues, "\xff")] = constSample{labelValues: labelValues, value: value}
+}
+
+// Reset deletes all values.
+func (v *constCounterVec) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples = make(map[string]constSample)
+}
+
+// Describe implements prometheus.Collector.
+func (v *constCounterVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector.
+func (v *constCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, sample := range v.samples {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, sample.value, sample.labelValues...)
+	}
+}
+
+// constHistogramVec exposes histograms accumulated outside the exporter,
+// such as distributions of finished processes, as Prometheus histograms.
+// Unlike prometheus.HistogramVec, bucket counts are set rather than observed.
+type constHistogramVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mu      sync.Mutex
+	samples map[string]constHistogramSample
+}
+
+type constHistogramSample struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	buckets     map[float64]uint64
+}
+
+func newConstHistogramVec(name, help string, labelNames []string) *constHistogramVec {
+	return &constHistogramVec{
+		desc:       prometheus.NewDesc(name, help, labelNames, nil),
+		labelNames: labelNames,
+		samples:    make(map[string]constHistogramSample),
+	}
+}
+
+// Set sets the histogram for labels, which must contain every label name.
+// buckets maps each upper bound to the cumulative count of observations
+// at most that bound.
+func (v *constHistogramVec) Set(labels prometheus.Labels, count uint64, sum float64, buckets map[float64]uint64) {
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		labelValues[i] = labels[name]
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples[strings.Join(labelValues, "\xff")] = constHistogramSample{labelValues: labelValues, count: count, sum: sum, buckets: buckets}
+}
+
+// Reset deletes all values.
+func (v *constHistogramVec) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples = make(map[string]constHistogramSample)
+}
+
+// Describe implements prometheus.Collector.
+func (v *constHistogramVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector.
+func (v *constHistogramVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, sample := range v.samples {
+		ch <- prometheus.MustNewConstHistogram(v.desc, sample.count, sample.sum, sample.buckets, sample.labelValues...)
+	}
+}
@@ -2,31 +2,134 @@
 package metrics
 
 import (
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/nvidia-gpu-list-exporter/pkg/types"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// computeModes are the compute modes always exported by nvidia_gpu_compute_mode,
+// in nvidia-smi's spelling lowercased.
+var computeModes = []string{"default", "exclusive_process", "prohibited"}
+
+// fabricStates are the fabric states always exported by nvidia_gpu_fabric_state,
+// in nvidia-smi's spelling lowercased with underscores for spaces.
+var fabricStates = []string{"not_supported", "not_started", "in_progress", "completed"}
+
 // Metrics represents a collection of Prometheus metrics for GPU monitoring.
 type Metrics struct {
-	gpuTemperature    *prometheus.GaugeVec
-	gpuFreeMemory     *prometheus.GaugeVec
-	gpuUsedMemory     *prometheus.GaugeVec
-	gpuTotalMemory    *prometheus.GaugeVec
-	gpuUtilization    *prometheus.GaugeVec
-	memoryUtilization *prometheus.GaugeVec
-	processGPUMemory  *prometheus.GaugeVec
-	processCPU        *prometheus.GaugeVec
-	processMemory     *prometheus.GaugeVec
+	gpuInfo                  *prometheus.GaugeVec
+	gpuTemperature           *prometheus.GaugeVec
+	memoryTemperature        *prometheus.GaugeVec
+	temperatureThreshold     *prometheus.GaugeVec
+	thermalHeadroom          *prometheus.GaugeVec
+	gpuFreeMemory            *prometheus.GaugeVec
+	gpuUsedMemory            *prometheus.GaugeVec
+	gpuTotalMemory           *prometheus.GaugeVec
+	gpuMemory                *prometheus.GaugeVec
+	gpuUtilization           *prometheus.GaugeVec
+	memoryUtilization        *prometheus.GaugeVec
+	encoderUtilization       *prometheus.GaugeVec
+	decoderUtilization       *prometheus.GaugeVec
+	encoderSessions          *prometheus.GaugeVec
+	encoderAverageFPS        *prometheus.GaugeVec
+	encoderAverageLatency    *prometheus.GaugeVec
+	powerDraw                *prometheus.GaugeVec
+	powerLimit               *prometheus.GaugeVec
+	enforcedPowerLimit       *prometheus.GaugeVec
+	powerMinLimit            *prometheus.GaugeVec
+	powerMaxLimit            *prometheus.GaugeVec
+	powerDefaultLimit        *prometheus.GaugeVec
+	clock                    *prometheus.GaugeVec
+	clockMax                 *prometheus.GaugeVec
+	clockApplications        *prometheus.GaugeVec
+	clockDefaultApplications *prometheus.GaugeVec
+	clockEventReason         *prometheus.GaugeVec
+	eccMode                  *prometheus.GaugeVec
+	eccVolatileErrors        *prometheus.GaugeVec
+	eccAggregateErrors       *constCounterVec
+	retiredPages             *constCounterVec
+	retiredPagesPending      *prometheus.GaugeVec
+	remappedRows             *constCounterVec
+	remappedRowsPending      *prometheus.GaugeVec
+	remappedRowsFailure      *prometheus.GaugeVec
+	pcieLinkGen              *prometheus.GaugeVec
+	pcieLinkGenMax           *prometheus.GaugeVec
+	pcieLinkWidth            *prometheus.GaugeVec
+	pcieLinkWidthMax         *prometheus.GaugeVec
+	pcieThroughput           *prometheus.GaugeVec
+	fanSpeed                 *prometheus.GaugeVec
+	performanceState         *prometheus.GaugeVec
+	computeMode              *prometheus.GaugeVec
+	persistenceMode          *prometheus.GaugeVec
+	displayActive            *prometheus.GaugeVec
+	migMode                  *prometheus.GaugeVec
+	accountingMode           *prometheus.GaugeVec
+	fabricState              *prometheus.GaugeVec
+	fabricInfo               *prometheus.GaugeVec
+	migInfo                  *prometheus.GaugeVec
+	migTotalMemory           *prometheus.GaugeVec
+	migUsedMemory            *prometheus.GaugeVec
+	migFreeMemory            *prometheus.GaugeVec
+	vgpuInfo                 *prometheus.GaugeVec
+	vgpuTotalMemory          *prometheus.GaugeVec
+	vgpuUsedMemory           *prometheus.GaugeVec
+	vgpuFreeMemory           *prometheus.GaugeVec
+	vgpuUtilization          *prometheus.GaugeVec
+	vgpuEncoderSessions      *prometheus.GaugeVec
+	vgpuEncoderAverageFPS    *prometheus.GaugeVec
+	vgpuEncoderLatency       *prometheus.GaugeVec
+	nvlinkActive             *prometheus.GaugeVec
+	nvlinkSpeed              *prometheus.GaugeVec
+	nvlinkData               *constCounterVec
+	nvlinkErrors             *constCounterVec
+	topologyInfo             *prometheus.GaugeVec
+	topologyLink             *prometheus.GaugeVec
+	topologyNICLink          *prometheus.GaugeVec
+	accountedProcesses       *constCounterVec
+	accountedSeconds         *constCounterVec
+	accountedGPUBusy         *constCounterVec
+	accountedMemoryBusy      *constCounterVec
+	accountedMaxMemory       *constHistogramVec
+	finishedSeconds          *prometheus.GaugeVec
+	finishedGPUUtil          *prometheus.GaugeVec
+	finishedMemoryUtil       *prometheus.GaugeVec
+	finishedMaxMemory        *prometheus.GaugeVec
+	xidErrors                *constCounterVec
+	lastXID                  *prometheus.GaugeVec
+	processGPUMemory         *prometheus.GaugeVec
+	processCPU               *prometheus.GaugeVec
+	processMemory            *prometheus.GaugeVec
+	processSM                *prometheus.GaugeVec
+	processMemoryBandwidth   *prometheus.GaugeVec
+	processEncoder           *prometheus.GaugeVec
+	processDecoder           *prometheus.GaugeVec
 }
 
 // New creates a new Prometheus metrics collection.
 func New() *Metrics {
-	gpuLabels := []string{"hostname", "gpu_id", "gpu_name"}
-	processLabels := []string{"hostname", "gpu_id", "pid", "process_name", "user", "command"}
+	gpuLabels := []string{"hostname", "gpu_id", "gpu_uuid", "gpu_name"}
+	clockLabels := extend(gpuLabels, "clock")
+	reasonLabels := extend(gpuLabels, "reason")
+	eccLabels := extend(gpuLabels, "error_type", "location")
+	migLabels := extend(gpuLabels, "gpu_instance_id", "compute_instance_id", "mig_profile")
+	vgpuLabels := extend(gpuLabels, "vgpu_id")
+	nvlinkLabels := extend(gpuLabels, "link")
+	xidLabels := extend(gpuLabels, "pci_bus_id")
+	finishedLabels := extend(gpuLabels, "pid")
+	processLabels := []string{"hostname", "gpu_id", "gpu_uuid", "gpu_instance_id", "compute_instance_id", "mig_profile", "pid", "process_name", "type", "user", "command"}
 
 	return &Metrics{
+		gpuInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_info",
+				Help: "GPU identity and driver versions, always 1",
+			},
+			extend(gpuLabels, "serial", "pci_bus_id", "vbios_version", "driver_version", "cuda_version", "board_part_number", "virtualization_mode"),
+		),
+
 		gpuTemperature: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "nvidia_gpu_temperature_celsius",
@@ -35,6 +138,30 @@ func New() *Metrics {
 			gpuLabels,
 		),
 
+		memoryTemperature: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_memory_temperature_celsius",
+				Help: "GPU memory (HBM) temperature in Celsius",
+			},
+			gpuLabels,
+		),
+
+		temperatureThreshold: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_temperature_threshold_celsius",
+				Help: "GPU temperature thresholds in Celsius by threshold",
+			},
+			extend(gpuLabels, "threshold"),
+		),
+
+		thermalHeadroom: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_thermal_headroom_celsius",
+				Help: "Degrees Celsius until the GPU or its memory reaches a temperature at which clocks are reduced",
+			},
+			gpuLabels,
+		),
+
 		gpuFreeMemory: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "nvidia_gpu_free_memory_bytes",
@@ -59,6 +186,14 @@ func New() *Metrics {
 			gpuLabels,
 		),
 
+		gpuMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_memory_bytes",
+				Help: "GPU memory breakdown in bytes by kind (reserved, BAR1, confidential computing protected memory)",
+			},
+			extend(gpuLabels, "kind"),
+		),
+
 		gpuUtilization: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "nvidia_gpu_utilization_percent",
@@ -75,6 +210,528 @@ func New() *Metrics {
 			gpuLabels,
 		),
 
+		encoderUtilization: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_encoder_utilization_percent",
+				Help: "GPU video encoder (NVENC) utilization percentage",
+			},
+			gpuLabels,
+		),
+
+		decoderUtilization: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_decoder_utilization_percent",
+				Help: "GPU video decoder (NVDEC) utilization percentage",
+			},
+			gpuLabels,
+		),
+
+		encoderSessions: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_encoder_sessions",
+				Help: "Number of active video encoder sessions",
+			},
+			gpuLabels,
+		),
+
+		encoderAverageFPS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_encoder_average_fps",
+				Help: "Average frames per second across active video encoder sessions",
+			},
+			gpuLabels,
+		),
+
+		encoderAverageLatency: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_encoder_average_latency_seconds",
+				Help: "Average encode latency in seconds across active video encoder sessions",
+			},
+			gpuLabels,
+		),
+
+		powerDraw: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_draw_watts",
+				Help: "GPU power draw in watts",
+			},
+			gpuLabels,
+		),
+
+		powerLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_limit_watts",
+				Help: "GPU software power limit in watts",
+			},
+			gpuLabels,
+		),
+
+		enforcedPowerLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_enforced_limit_watts",
+				Help: "GPU enforced power limit in watts",
+			},
+			gpuLabels,
+		),
+
+		powerMinLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_min_limit_watts",
+				Help: "GPU minimum configurable power limit in watts",
+			},
+			gpuLabels,
+		),
+
+		powerMaxLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_max_limit_watts",
+				Help: "GPU maximum configurable power limit in watts",
+			},
+			gpuLabels,
+		),
+
+		powerDefaultLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_power_default_limit_watts",
+				Help: "GPU default power limit in watts",
+			},
+			gpuLabels,
+		),
+
+		clock: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_clock_mhz",
+				Help: "GPU current clock speed in MHz by clock domain",
+			},
+			clockLabels,
+		),
+
+		clockMax: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_clock_max_mhz",
+				Help: "GPU maximum clock speed in MHz by clock domain",
+			},
+			clockLabels,
+		),
+
+		clockApplications: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_clock_applications_mhz",
+				Help: "GPU application clock target in MHz by clock domain",
+			},
+			clockLabels,
+		),
+
+		clockDefaultApplications: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_clock_default_applications_mhz",
+				Help: "GPU default application clock target in MHz by clock domain",
+			},
+			clockLabels,
+		),
+
+		clockEventReason: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_clock_event_reason_active",
+				Help: "Whether a clock event (throttle) reason is currently holding GPU clocks down (1 = active)",
+			},
+			reasonLabels,
+		),
+
+		eccMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_ecc_mode_enabled",
+				Help: "Whether ECC mode is currently enabled (1 = enabled)",
+			},
+			gpuLabels,
+		),
+
+		eccVolatileErrors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_ecc_volatile_errors",
+				Help: "ECC errors since the last driver load by error type and memory location",
+			},
+			eccLabels,
+		),
+
+		eccAggregateErrors: newConstCounterVec(
+			"nvidia_gpu_ecc_aggregate_errors_total",
+			"ECC errors over the GPU's lifetime by error type and memory location",
+			eccLabels,
+		),
+
+		retiredPages: newConstCounterVec(
+			"nvidia_gpu_retired_pages_total",
+			"GPU memory pages retired by cause",
+			extend(gpuLabels, "cause"),
+		),
+
+		retiredPagesPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_retired_pages_pending",
+				Help: "Whether a page is pending retirement until the next reboot (1 = pending)",
+			},
+			gpuLabels,
+		),
+
+		remappedRows: newConstCounterVec(
+			"nvidia_gpu_remapped_rows_total",
+			"GPU memory rows remapped by error type",
+			extend(gpuLabels, "error_type"),
+		),
+
+		remappedRowsPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_remapped_rows_pending",
+				Help: "Whether a row remapping is pending until the next GPU reset (1 = pending)",
+			},
+			gpuLabels,
+		),
+
+		remappedRowsFailure: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_remapped_rows_failure",
+				Help: "Whether a row remapping has failed (1 = failed)",
+			},
+			gpuLabels,
+		),
+
+		pcieLinkGen: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_pcie_link_gen",
+				Help: "Current PCIe link generation",
+			},
+			gpuLabels,
+		),
+
+		pcieLinkGenMax: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_pcie_link_gen_max",
+				Help: "Maximum PCIe link generation supported by the GPU and system",
+			},
+			gpuLabels,
+		),
+
+		pcieLinkWidth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_pcie_link_width",
+				Help: "Current PCIe link width in lanes",
+			},
+			gpuLabels,
+		),
+
+		pcieLinkWidthMax: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_pcie_link_width_max",
+				Help: "Maximum PCIe link width in lanes supported by the GPU and system",
+			},
+			gpuLabels,
+		),
+
+		pcieThroughput: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_pcie_throughput_bytes_per_second",
+				Help: "PCIe throughput in bytes per second by direction",
+			},
+			extend(gpuLabels, "direction"),
+		),
+
+		fanSpeed: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_fan_speed_percent",
+				Help: "GPU fan speed as a percentage of its maximum",
+			},
+			gpuLabels,
+		),
+
+		performanceState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_performance_state",
+				Help: "GPU performance state from 0 (P0, maximum performance) to 15 (P15, minimum performance)",
+			},
+			gpuLabels,
+		),
+
+		computeMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_compute_mode",
+				Help: "GPU compute mode (1 for the current mode, 0 otherwise)",
+			},
+			extend(gpuLabels, "mode"),
+		),
+
+		persistenceMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_persistence_mode_enabled",
+				Help: "Whether persistence mode is enabled (1 = enabled)",
+			},
+			gpuLabels,
+		),
+
+		displayActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_display_active",
+				Help: "Whether a display is initialized on the GPU (1 = active)",
+			},
+			gpuLabels,
+		),
+
+		migMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_mig_mode_enabled",
+				Help: "Whether MIG mode is enabled (1 = enabled)",
+			},
+			gpuLabels,
+		),
+
+		accountingMode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_accounting_mode_enabled",
+				Help: "Whether accounting mode is enabled (1 = enabled)",
+			},
+			gpuLabels,
+		),
+
+		fabricState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_fabric_state",
+				Help: "NVLink fabric registration state of the GPU (1 for the current state, 0 otherwise)",
+			},
+			extend(gpuLabels, "state"),
+		),
+
+		fabricInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_fabric_info",
+				Help: "NVLink fabric registration status, clique and cluster of the GPU, always 1",
+			},
+			extend(gpuLabels, "status", "clique_id", "cluster_uuid"),
+		),
+
+		migInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_mig_info",
+				Help: "MIG device identity and placement, always 1",
+			},
+			extend(migLabels, "mig_uuid", "mig_index", "gpu_instance_profile_id", "placement_start", "placement_size"),
+		),
+
+		migTotalMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_mig_total_memory_bytes",
+				Help: "MIG device total memory in bytes, shared by the compute instances of a GPU instance",
+			},
+			migLabels,
+		),
+
+		migUsedMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_mig_used_memory_bytes",
+				Help: "MIG device used memory in bytes",
+			},
+			migLabels,
+		),
+
+		migFreeMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_mig_free_memory_bytes",
+				Help: "MIG device free memory in bytes",
+			},
+			migLabels,
+		),
+
+		vgpuInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_info",
+				Help: "vGPU identity, type, VM and license status, always 1",
+			},
+			extend(vgpuLabels, "vgpu_uuid", "vgpu_type", "vm_name", "vm_uuid", "guest_driver_version", "license_status", "gpu_instance_id"),
+		),
+
+		vgpuTotalMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_total_memory_bytes",
+				Help: "vGPU framebuffer size in bytes",
+			},
+			vgpuLabels,
+		),
+
+		vgpuUsedMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_used_memory_bytes",
+				Help: "vGPU used framebuffer in bytes",
+			},
+			vgpuLabels,
+		),
+
+		vgpuFreeMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_free_memory_bytes",
+				Help: "vGPU free framebuffer in bytes",
+			},
+			vgpuLabels,
+		),
+
+		vgpuUtilization: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_utilization_percent",
+				Help: "vGPU utilization percentage by engine",
+			},
+			extend(vgpuLabels, "engine"),
+		),
+
+		vgpuEncoderSessions: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_encoder_sessions",
+				Help: "Number of active video encoder sessions of the vGPU",
+			},
+			vgpuLabels,
+		),
+
+		vgpuEncoderAverageFPS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_encoder_average_fps",
+				Help: "Average frames per second across active video encoder sessions of the vGPU",
+			},
+			vgpuLabels,
+		),
+
+		vgpuEncoderLatency: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_vgpu_encoder_average_latency_seconds",
+				Help: "Average encode latency in seconds across active video encoder sessions of the vGPU",
+			},
+			vgpuLabels,
+		),
+
+		nvlinkActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_nvlink_active",
+				Help: "Whether the NVLink is active (1 = active)",
+			},
+			nvlinkLabels,
+		),
+
+		nvlinkSpeed: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_nvlink_speed_bytes_per_second",
+				Help: "NVLink speed in bytes per second",
+			},
+			nvlinkLabels,
+		),
+
+		nvlinkData: newConstCounterVec(
+			"nvidia_gpu_nvlink_data_bytes_total",
+			"Data transferred over the NVLink in bytes by direction",
+			extend(nvlinkLabels, "direction"),
+		),
+
+		nvlinkErrors: newConstCounterVec(
+			"nvidia_gpu_nvlink_errors_total",
+			"NVLink errors by error type",
+			extend(nvlinkLabels, "error_type"),
+		),
+
+		topologyInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_topology_info",
+				Help: "CPU and NUMA affinity of the GPU, always 1",
+			},
+			extend(gpuLabels, "cpu_affinity", "numa_affinity", "gpu_numa_id"),
+		),
+
+		topologyLink: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_topology_link",
+				Help: "Connection type between two GPUs as shown by nvidia-smi topo -m, always 1",
+			},
+			[]string{"hostname", "gpu_a", "gpu_b", "type"},
+		),
+
+		topologyNICLink: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_topology_nic_link",
+				Help: "Connection type between a GPU and a NIC as shown by nvidia-smi topo -m, always 1",
+			},
+			extend(gpuLabels, "nic", "nic_device", "type"),
+		),
+
+		accountedProcesses: newConstCounterVec(
+			"nvidia_gpu_accounted_processes_total",
+			"Processes that finished on the GPU according to accounting mode",
+			gpuLabels,
+		),
+
+		accountedSeconds: newConstCounterVec(
+			"nvidia_gpu_accounted_process_seconds_total",
+			"Total run time in seconds of processes that finished on the GPU",
+			gpuLabels,
+		),
+
+		accountedGPUBusy: newConstCounterVec(
+			"nvidia_gpu_accounted_process_gpu_busy_seconds_total",
+			"Run time in seconds of finished processes weighted by their average GPU utilization",
+			gpuLabels,
+		),
+
+		accountedMemoryBusy: newConstCounterVec(
+			"nvidia_gpu_accounted_process_memory_busy_seconds_total",
+			"Run time in seconds of finished processes weighted by their average memory utilization",
+			gpuLabels,
+		),
+
+		accountedMaxMemory: newConstHistogramVec(
+			"nvidia_gpu_accounted_process_max_memory_bytes",
+			"Peak memory usage in bytes of processes that finished on the GPU",
+			gpuLabels,
+		),
+
+		finishedSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_finished_process_seconds",
+				Help: "Run time in seconds of a process that finished on the GPU in the last few minutes",
+			},
+			finishedLabels,
+		),
+
+		finishedGPUUtil: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_finished_process_gpu_utilization_percent",
+				Help: "Average GPU utilization of a process that finished on the GPU in the last few minutes",
+			},
+			finishedLabels,
+		),
+
+		finishedMemoryUtil: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_finished_process_memory_utilization_percent",
+				Help: "Average memory utilization of a process that finished on the GPU in the last few minutes",
+			},
+			finishedLabels,
+		),
+
+		finishedMaxMemory: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_finished_process_max_memory_bytes",
+				Help: "Peak memory usage in bytes of a process that finished on the GPU in the last few minutes",
+			},
+			finishedLabels,
+		),
+
+		xidErrors: newConstCounterVec(
+			"nvidia_gpu_xid_errors_total",
+			"Xid errors logged by the NVIDIA driver in the kernel log by Xid code",
+			extend(xidLabels, "xid"),
+		),
+
+		lastXID: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_last_xid",
+				Help: "Code of the most recent Xid error logged by the NVIDIA driver",
+			},
+			xidLabels,
+		),
+
 		processGPUMemory: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "nvidia_gpu_process_gpu_memory_bytes",
@@ -98,21 +755,130 @@ func New() *Metrics {
 			},
 			processLabels,
 		),
+
+		processSM: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_process_sm_utilization_percent",
+				Help: "Share of the GPU's streaming multiprocessors used by the process, in percent",
+			},
+			processLabels,
+		),
+
+		processMemoryBandwidth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_process_memory_utilization_percent",
+				Help: "Share of the GPU's memory bandwidth used by the process, in percent",
+			},
+			processLabels,
+		),
+
+		processEncoder: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_process_encoder_utilization_percent",
+				Help: "Share of the GPU's video encoder used by the process, in percent",
+			},
+			processLabels,
+		),
+
+		processDecoder: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nvidia_gpu_process_decoder_utilization_percent",
+				Help: "Share of the GPU's video decoder used by the process, in percent",
+			},
+			processLabels,
+		),
 	}
 }
 
 // Register registers all metrics with the Prometheus registry.
 func (m *Metrics) Register(registry prometheus.Registerer) error {
 	collectors := []prometheus.Collector{
+		m.gpuInfo,
 		m.gpuTemperature,
+		m.memoryTemperature,
+		m.temperatureThreshold,
+		m.thermalHeadroom,
 		m.gpuFreeMemory,
 		m.gpuUsedMemory,
 		m.gpuTotalMemory,
+		m.gpuMemory,
 		m.gpuUtilization,
 		m.memoryUtilization,
+		m.encoderUtilization,
+		m.decoderUtilization,
+		m.encoderSessions,
+		m.encoderAverageFPS,
+		m.encoderAverageLatency,
+		m.powerDraw,
+		m.powerLimit,
+		m.enforcedPowerLimit,
+		m.powerMinLimit,
+		m.powerMaxLimit,
+		m.powerDefaultLimit,
+		m.clock,
+		m.clockMax,
+		m.clockApplications,
+		m.clockDefaultApplications,
+		m.clockEventReason,
+		m.eccMode,
+		m.eccVolatileErrors,
+		m.eccAggregateErrors,
+		m.retiredPages,
+		m.retiredPagesPending,
+		m.remappedRows,
+		m.remappedRowsPending,
+		m.remappedRowsFailure,
+		m.pcieLinkGen,
+		m.pcieLinkGenMax,
+		m.pcieLinkWidth,
+		m.pcieLinkWidthMax,
+		m.pcieThroughput,
+		m.fanSpeed,
+		m.performanceState,
+		m.computeMode,
+		m.persistenceMode,
+		m.displayActive,
+		m.migMode,
+		m.accountingMode,
+		m.fabricState,
+		m.fabricInfo,
+		m.migInfo,
+		m.migTotalMemory,
+		m.migUsedMemory,
+		m.migFreeMemory,
+		m.vgpuInfo,
+		m.vgpuTotalMemory,
+		m.vgpuUsedMemory,
+		m.vgpuFreeMemory,
+		m.vgpuUtilization,
+		m.vgpuEncoderSessions,
+		m.vgpuEncoderAverageFPS,
+		m.vgpuEncoderLatency,
+		m.nvlinkActive,
+		m.nvlinkSpeed,
+		m.nvlinkData,
+		m.nvlinkErrors,
+		m.topologyInfo,
+		m.topologyLink,
+		m.topologyNICLink,
+		m.accountedProcesses,
+		m.accountedSeconds,
+		m.accountedGPUBusy,
+		m.accountedMemoryBusy,
+		m.accountedMaxMemory,
+		m.finishedSeconds,
+		m.finishedGPUUtil,
+		m.finishedMemoryUtil,
+		m.finishedMaxMemory,
+		m.xidErrors,
+		m.lastXID,
 		m.processGPUMemory,
 		m.processCPU,
 		m.processMemory,
+		m.processSM,
+		m.processMemoryBandwidth,
+		m.processEncoder,
+		m.processDecoder,
 	}
 
 	for _, collector := range collectors {
@@ -126,26 +892,466 @@ func (m *Metrics) Register(registry prometheus.Registerer) error {
 
 // UpdateGPU updates GPU metrics with the provided data.
 func (m *Metrics) UpdateGPU(gpuMetrics []types.GPUMetrics) {
+	m.gpuInfo.Reset()
 	m.gpuTemperature.Reset()
+	m.memoryTemperature.Reset()
+	m.temperatureThreshold.Reset()
+	m.thermalHeadroom.Reset()
 	m.gpuFreeMemory.Reset()
 	m.gpuUsedMemory.Reset()
 	m.gpuTotalMemory.Reset()
+	m.gpuMemory.Reset()
 	m.gpuUtilization.Reset()
 	m.memoryUtilization.Reset()
+	m.encoderUtilization.Reset()
+	m.decoderUtilization.Reset()
+	m.encoderSessions.Reset()
+	m.encoderAverageFPS.Reset()
+	m.encoderAverageLatency.Reset()
+	m.powerDraw.Reset()
+	m.powerLimit.Reset()
+	m.enforcedPowerLimit.Reset()
+	m.powerMinLimit.Reset()
+	m.powerMaxLimit.Reset()
+	m.powerDefaultLimit.Reset()
+	m.clock.Reset()
+	m.clockMax.Reset()
+	m.clockApplications.Reset()
+	m.clockDefaultApplications.Reset()
+	m.clockEventReason.Reset()
+	m.eccMode.Reset()
+	m.eccVolatileErrors.Reset()
+	m.eccAggregateErrors.Reset()
+	m.retiredPages.Reset()
+	m.retiredPagesPending.Reset()
+	m.remappedRows.Reset()
+	m.remappedRowsPending.Reset()
+	m.remappedRowsFailure.Reset()
+	m.pcieLinkGen.Reset()
+	m.pcieLinkGenMax.Reset()
+	m.pcieLinkWidth.Reset()
+	m.pcieLinkWidthMax.Reset()
+	m.pcieThroughput.Reset()
+	m.fanSpeed.Reset()
+	m.performanceState.Reset()
+	m.computeMode.Reset()
+	m.persistenceMode.Reset()
+	m.displayActive.Reset()
+	m.migMode.Reset()
+	m.accountingMode.Reset()
+	m.fabricState.Reset()
+	m.fabricInfo.Reset()
 
 	for _, metric := range gpuMetrics {
 		labels := prometheus.Labels{
 			"hostname": metric.Hostname,
 			"gpu_id":   strconv.Itoa(metric.GPUID),
+			"gpu_uuid": metric.UUID,
 			"gpu_name": metric.GPUName,
 		}
 
+		infoLabels := withLabel(labels, "serial", metric.Serial)
+		infoLabels["pci_bus_id"] = metric.PCIBusID
+		infoLabels["vbios_version"] = metric.VBIOSVersion
+		infoLabels["driver_version"] = metric.DriverVersion
+		infoLabels["cuda_version"] = metric.CUDAVersion
+		infoLabels["board_part_number"] = metric.BoardPartNumber
+		infoLabels["virtualization_mode"] = metric.VirtualizationMode
+		m.gpuInfo.With(infoLabels).Set(1)
+
 		m.gpuTemperature.With(labels).Set(metric.Temperature)
-		m.gpuFreeMemory.With(labels).Set(float64(metric.FreeMemory * 1024 * 1024))
-		m.gpuUsedMemory.With(labels).Set(float64(metric.UsedMemory * 1024 * 1024))
-		m.gpuTotalMemory.With(labels).Set(float64(metric.TotalMemory * 1024 * 1024))
+		if metric.MemoryTemperature > 0 {
+			m.memoryTemperature.With(labels).Set(metric.MemoryTemperature)
+		}
+		for threshold, value := range map[string]float64{
+			"shutdown":             metric.ShutdownTemperature,
+			"slowdown":             metric.SlowdownTemperature,
+			"max_operating":        metric.MaxOperatingTemperature,
+			"memory_max_operating": metric.MemoryMaxOperatingTemperature,
+		} {
+			if value > 0 {
+				m.temperatureThreshold.With(withLabel(labels, "threshold", threshold)).Set(value)
+			}
+		}
+		if headroom, ok := thermalHeadroom(metric); ok {
+			m.thermalHeadroom.With(labels).Set(headroom)
+		}
+		m.gpuFreeMemory.With(labels).Set(float64(metric.FreeMemory))
+		m.gpuUsedMemory.With(labels).Set(float64(metric.UsedMemory))
+		m.gpuTotalMemory.With(labels).Set(float64(metric.TotalMemory))
+		m.gpuMemory.With(withLabel(labels, "kind", "reserved")).Set(float64(metric.ReservedMemory))
+		if metric.BAR1TotalMemory > 0 {
+			m.gpuMemory.With(withLabel(labels, "kind", "bar1_total")).Set(float64(metric.BAR1TotalMemory))
+			m.gpuMemory.With(withLabel(labels, "kind", "bar1_used")).Set(float64(metric.BAR1UsedMemory))
+		}
+		if metric.ProtectedTotalMemory > 0 {
+			m.gpuMemory.With(withLabel(labels, "kind", "protected_total")).Set(float64(metric.ProtectedTotalMemory))
+			m.gpuMemory.With(withLabel(labels, "kind", "protected_used")).Set(float64(metric.ProtectedUsedMemory))
+		}
 		m.gpuUtilization.With(labels).Set(metric.GPUUtilization)
 		m.memoryUtilization.With(labels).Set(metric.MemoryUtilization)
+		m.encoderUtilization.With(labels).Set(metric.EncoderUtilization)
+		m.decoderUtilization.With(labels).Set(metric.DecoderUtilization)
+		m.encoderSessions.With(labels).Set(float64(metric.EncoderSessions))
+		m.encoderAverageFPS.With(labels).Set(metric.EncoderAverageFPS)
+		m.encoderAverageLatency.With(labels).Set(metric.EncoderAverageLatency)
+		m.powerDraw.With(labels).Set(metric.PowerDraw)
+		m.powerLimit.With(labels).Set(metric.PowerLimit)
+		m.enforcedPowerLimit.With(labels).Set(metric.EnforcedPowerLimit)
+		m.powerMinLimit.With(labels).Set(metric.PowerMinLimit)
+		m.powerMaxLimit.With(labels).Set(metric.PowerMaxLimit)
+		m.powerDefaultLimit.With(labels).Set(metric.PowerDefaultLimit)
+		m.pcieLinkGen.With(labels).Set(float64(metric.PCIeLinkGen))
+		m.pcieLinkGenMax.With(labels).Set(float64(metric.PCIeLinkGenMax))
+		m.pcieLinkWidth.With(labels).Set(float64(metric.PCIeLinkWidth))
+		m.pcieLinkWidthMax.With(labels).Set(float64(metric.PCIeLinkWidthMax))
+		m.pcieThroughput.With(withLabel(labels, "direction", "rx")).Set(metric.PCIeRxThroughput)
+		m.pcieThroughput.With(withLabel(labels, "direction", "tx")).Set(metric.PCIeTxThroughput)
+		m.fanSpeed.With(labels).Set(metric.FanSpeed)
+		if metric.PerformanceState >= 0 {
+			m.performanceState.With(labels).Set(float64(metric.PerformanceState))
+		}
+		m.persistenceMode.With(labels).Set(boolToFloat(metric.PersistenceMode))
+		m.displayActive.With(labels).Set(boolToFloat(metric.DisplayActive))
+		m.migMode.With(labels).Set(boolToFloat(metric.MIGMode))
+		m.accountingMode.With(labels).Set(boolToFloat(metric.AccountingMode))
+
+		if metric.ComputeMode != "" {
+			current := strings.ToLower(metric.ComputeMode)
+			for _, mode := range computeModes {
+				m.computeMode.With(withLabel(labels, "mode", mode)).Set(boolToFloat(mode == current))
+			}
+			if !slices.Contains(computeModes, current) {
+				m.computeMode.With(withLabel(labels, "mode", current)).Set(1)
+			}
+		}
+
+		if fabric := metric.Fabric; fabric.State != "" {
+			current := strings.ReplaceAll(strings.ToLower(fabric.State), " ", "_")
+			for _, state := range fabricStates {
+				m.fabricState.With(withLabel(labels, "state", state)).Set(boolToFloat(state == current))
+			}
+			if !slices.Contains(fabricStates, current) {
+				m.fabricState.With(withLabel(labels, "state", current)).Set(1)
+			}
+
+			infoLabels := withLabel(labels, "status", fabric.Status)
+			infoLabels["clique_id"] = fabric.CliqueID
+			infoLabels["cluster_uuid"] = fabric.ClusterUUID
+			m.fabricInfo.With(infoLabels).Set(1)
+		}
+
+		setClocks(m.clock, labels, metric.Clocks, "gr", "sm", "mem", "video")
+		setClocks(m.clockMax, labels, metric.MaxClocks, "gr", "sm", "mem")
+		setClocks(m.clockApplications, labels, metric.ApplicationClocks, "gr", "mem")
+		setClocks(m.clockDefaultApplications, labels, metric.DefaultApplicationClocks, "gr", "mem")
+
+		reasons := metric.ClockEventReasons
+		for reason, active := range map[string]bool{
+			"idle":                        reasons.GPUIdle,
+			"applications_clocks_setting": reasons.ApplicationsClocksSetting,
+			"sw_power_cap":                reasons.SWPowerCap,
+			"hw_slowdown":                 reasons.HWSlowdown,
+			"hw_thermal_slowdown":         reasons.HWThermalSlowdown,
+			"hw_power_brake_slowdown":     reasons.HWPowerBrakeSlowdown,
+			"sw_thermal_slowdown":         reasons.SWThermalSlowdown,
+			"sync_boost":                  reasons.SyncBoost,
+		} {
+			m.clockEventReason.With(withLabel(labels, "reason", reason)).Set(boolToFloat(active))
+		}
+
+		m.eccMode.With(labels).Set(boolToFloat(metric.ECCMode))
+		for errorType, counts := range map[string]types.ECCErrors{
+			"corrected":   metric.ECCCorrectedVolatile,
+			"uncorrected": metric.ECCUncorrectedVolatile,
+		} {
+			for location, count := range eccLocations(counts) {
+				eccLabels := withLabel(withLabel(labels, "error_type", errorType), "location", location)
+				m.eccVolatileErrors.With(eccLabels).Set(float64(count))
+			}
+		}
+		for errorType, counts := range map[string]types.ECCErrors{
+			"corrected":   metric.ECCCorrectedAggregate,
+			"uncorrected": metric.ECCUncorrectedAggregate,
+		} {
+			for location, count := range eccLocations(counts) {
+				eccLabels := withLabel(withLabel(labels, "error_type", errorType), "location", location)
+				m.eccAggregateErrors.Set(eccLabels, float64(count))
+			}
+		}
+
+		m.retiredPages.Set(withLabel(labels, "cause", "single_bit_ecc"), float64(metric.RetiredPagesSingleBit))
+		m.retiredPages.Set(withLabel(labels, "cause", "double_bit_ecc"), float64(metric.RetiredPagesDoubleBit))
+		m.retiredPagesPending.With(labels).Set(boolToFloat(metric.RetiredPagesPending))
+		m.remappedRows.Set(withLabel(labels, "error_type", "correctable"), float64(metric.RemappedRowsCorrectable))
+		m.remappedRows.Set(withLabel(labels, "error_type", "uncorrectable"), float64(metric.RemappedRowsUncorrectable))
+		m.remappedRowsPending.With(labels).Set(boolToFloat(metric.RemappedRowsPending))
+		m.remappedRowsFailure.With(labels).Set(boolToFloat(metric.RemappedRowsFailure))
+	}
+}
+
+// setClocks sets one series per clock domain, named as in nvidia-smi's
+// clocks.* query fields.
+func setClocks(gauge *prometheus.GaugeVec, labels prometheus.Labels, clocks types.GPUClocks, domains ...string) {
+	values := map[string]float64{
+		"gr":    clocks.Graphics,
+		"sm":    clocks.SM,
+		"mem":   clocks.Memory,
+		"video": clocks.Video,
+	}
+
+	for _, domain := range domains {
+		gauge.With(withLabel(labels, "clock", domain)).Set(values[domain])
+	}
+}
+
+// thermalHeadroom returns how far the GPU is from the lowest threshold at
+// which clocks are reduced: the slowdown or maximum operating temperature
+// for the GPU, and the maximum operating temperature for its memory.
+// It reports false if no threshold is known.
+func thermalHeadroom(metric types.GPUMetrics) (float64, bool) {
+	headroom, ok := 0.0, false
+	for _, limit := range []struct{ temperature, threshold float64 }{
+		{metric.Temperature, metric.SlowdownTemperature},
+		{metric.Temperature, metric.MaxOperatingTemperature},
+		{metric.MemoryTemperature, metric.MemoryMaxOperatingTemperature},
+	} {
+		if limit.temperature <= 0 || limit.threshold <= 0 {
+			continue
+		}
+		if h := limit.threshold - limit.temperature; !ok || h < headroom {
+			headroom, ok = h, true
+		}
+	}
+	return headroom, ok
+}
+
+// eccLocations returns ECC error counts keyed by the memory location names
+// used in nvidia-smi's ecc.errors.* fields.
+func eccLocations(counts types.ECCErrors) map[string]uint64 {
+	return map[string]uint64{
+		"device_memory":  counts.DeviceMemory,
+		"dram":           counts.DRAM,
+		"sram":           counts.SRAM,
+		"register_file":  counts.RegisterFile,
+		"l1_cache":       counts.L1Cache,
+		"l2_cache":       counts.L2Cache,
+		"texture_memory": counts.TextureMemory,
+		"cbu":            counts.CBU,
+		"total":          counts.Total,
+	}
+}
+
+// UpdateMIGDevices updates MIG device metrics.
+func (m *Metrics) UpdateMIGDevices(devices []types.MIGDevice) {
+	m.migInfo.Reset()
+	m.migTotalMemory.Reset()
+	m.migUsedMemory.Reset()
+	m.migFreeMemory.Reset()
+
+	for _, device := range devices {
+		labels := prometheus.Labels{
+			"hostname":            device.Hostname,
+			"gpu_id":              strconv.Itoa(device.GPUID),
+			"gpu_uuid":            device.GPUUUID,
+			"gpu_name":            device.GPUName,
+			"gpu_instance_id":     strconv.Itoa(device.GPUInstanceID),
+			"compute_instance_id": strconv.Itoa(device.ComputeInstanceID),
+			"mig_profile":         device.Profile,
+		}
+
+		infoLabels := withLabel(labels, "mig_uuid", device.UUID)
+		infoLabels["mig_index"] = strconv.Itoa(device.Index)
+		infoLabels["gpu_instance_profile_id"] = optionalID(device.GPUInstanceProfileID)
+		infoLabels["placement_start"] = optionalID(device.PlacementStart)
+		infoLabels["placement_size"] = optionalID(device.PlacementSize)
+		m.migInfo.With(infoLabels).Set(1)
+
+		m.migTotalMemory.With(labels).Set(float64(device.TotalMemory))
+		m.migUsedMemory.With(labels).Set(float64(device.UsedMemory))
+		m.migFreeMemory.With(labels).Set(float64(device.FreeMemory))
+	}
+}
+
+// UpdateVGPUs updates vGPU metrics.
+func (m *Metrics) UpdateVGPUs(vgpus []types.VGPU) {
+	m.vgpuInfo.Reset()
+	m.vgpuTotalMemory.Reset()
+	m.vgpuUsedMemory.Reset()
+	m.vgpuFreeMemory.Reset()
+	m.vgpuUtilization.Reset()
+	m.vgpuEncoderSessions.Reset()
+	m.vgpuEncoderAverageFPS.Reset()
+	m.vgpuEncoderLatency.Reset()
+
+	for _, vgpu := range vgpus {
+		labels := prometheus.Labels{
+			"hostname": vgpu.Hostname,
+			"gpu_id":   strconv.Itoa(vgpu.GPUID),
+			"gpu_uuid": vgpu.GPUUUID,
+			"gpu_name": vgpu.GPUName,
+			"vgpu_id":  vgpu.ID,
+		}
+
+		infoLabels := withLabel(labels, "vgpu_uuid", vgpu.UUID)
+		infoLabels["vgpu_type"] = vgpu.TypeName
+		infoLabels["vm_name"] = vgpu.VMName
+		infoLabels["vm_uuid"] = vgpu.VMUUID
+		infoLabels["guest_driver_version"] = vgpu.GuestDriverVersion
+		infoLabels["license_status"] = vgpu.LicenseStatus
+		infoLabels["gpu_instance_id"] = optionalID(vgpu.GPUInstanceID)
+		m.vgpuInfo.With(infoLabels).Set(1)
+
+		m.vgpuTotalMemory.With(labels).Set(float64(vgpu.TotalMemory))
+		m.vgpuUsedMemory.With(labels).Set(float64(vgpu.UsedMemory))
+		m.vgpuFreeMemory.With(labels).Set(float64(vgpu.FreeMemory))
+		for engine, value := range map[string]float64{
+			"gpu":     vgpu.GPUUtilization,
+			"memory":  vgpu.MemoryUtilization,
+			"encoder": vgpu.EncoderUtilization,
+			"decoder": vgpu.DecoderUtilization,
+		} {
+			m.vgpuUtilization.With(withLabel(labels, "engine", engine)).Set(value)
+		}
+		m.vgpuEncoderSessions.With(labels).Set(float64(vgpu.EncoderSessions))
+		m.vgpuEncoderAverageFPS.With(labels).Set(vgpu.EncoderAverageFPS)
+		m.vgpuEncoderLatency.With(labels).Set(vgpu.EncoderAverageLatency)
+	}
+}
+
+// UpdateNVLinks updates NVLink metrics.
+func (m *Metrics) UpdateNVLinks(links []types.NVLink) {
+	m.nvlinkActive.Reset()
+	m.nvlinkSpeed.Reset()
+	m.nvlinkData.Reset()
+	m.nvlinkErrors.Reset()
+
+	for _, link := range links {
+		labels := prometheus.Labels{
+			"hostname": link.Hostname,
+			"gpu_id":   strconv.Itoa(link.GPUID),
+			"gpu_uuid": link.GPUUUID,
+			"gpu_name": link.GPUName,
+			"link":     strconv.Itoa(link.Link),
+		}
+
+		m.nvlinkActive.With(labels).Set(boolToFloat(link.Active))
+		m.nvlinkSpeed.With(labels).Set(link.Speed)
+		if link.HasDataCounters {
+			m.nvlinkData.Set(withLabel(labels, "direction", "tx"), float64(link.TxBytes))
+			m.nvlinkData.Set(withLabel(labels, "direction", "rx"), float64(link.RxBytes))
+		}
+		for errorType, count := range link.Errors {
+			m.nvlinkErrors.Set(withLabel(labels, "error_type", errorType), float64(count))
+		}
+	}
+}
+
+// UpdateTopology updates GPU topology metrics. A nil topology removes them.
+func (m *Metrics) UpdateTopology(topology *types.Topology) {
+	m.topologyInfo.Reset()
+	m.topologyLink.Reset()
+	m.topologyNICLink.Reset()
+
+	if topology == nil {
+		return
+	}
+
+	nicDevices := make(map[string]string, len(topology.NICs))
+	for _, nic := range topology.NICs {
+		nicDevices[nic.Name] = nic.Device
+	}
+
+	for _, gpu := range topology.GPUs {
+		labels := prometheus.Labels{
+			"hostname": topology.Hostname,
+			"gpu_id":   strconv.Itoa(gpu.GPUID),
+			"gpu_uuid": gpu.GPUUUID,
+			"gpu_name": gpu.GPUName,
+		}
+
+		infoLabels := withLabel(labels, "cpu_affinity", gpu.CPUAffinity)
+		infoLabels["numa_affinity"] = gpu.NUMAAffinity
+		infoLabels["gpu_numa_id"] = optionalID(gpu.GPUNUMAID)
+		m.topologyInfo.With(infoLabels).Set(1)
+
+		for peer, linkType := range gpu.GPULinks {
+			m.topologyLink.With(prometheus.Labels{
+				"hostname": topology.Hostname,
+				"gpu_a":    strconv.Itoa(gpu.GPUID),
+				"gpu_b":    strconv.Itoa(peer),
+				"type":     linkType,
+			}).Set(1)
+		}
+
+		for nic, linkType := range gpu.NICLinks {
+			nicLabels := withLabel(labels, "nic", nic)
+			nicLabels["nic_device"] = nicDevices[nic]
+			nicLabels["type"] = linkType
+			m.topologyNICLink.With(nicLabels).Set(1)
+		}
+	}
+}
+
+// UpdateAccountingStats updates finished-process accounting metrics.
+func (m *Metrics) UpdateAccountingStats(stats []types.AccountingStats) {
+	m.accountedProcesses.Reset()
+	m.accountedSeconds.Reset()
+	m.accountedGPUBusy.Reset()
+	m.accountedMemoryBusy.Reset()
+	m.accountedMaxMemory.Reset()
+	m.finishedSeconds.Reset()
+	m.finishedGPUUtil.Reset()
+	m.finishedMemoryUtil.Reset()
+	m.finishedMaxMemory.Reset()
+
+	for _, gpu := range stats {
+		labels := prometheus.Labels{
+			"hostname": gpu.Hostname,
+			"gpu_id":   optionalID(gpu.GPUID),
+			"gpu_uuid": gpu.GPUUUID,
+			"gpu_name": gpu.GPUName,
+		}
+
+		m.accountedProcesses.Set(labels, float64(gpu.Processes))
+		m.accountedSeconds.Set(labels, gpu.Seconds)
+		m.accountedGPUBusy.Set(labels, gpu.GPUBusySeconds)
+		m.accountedMemoryBusy.Set(labels, gpu.MemoryBusySeconds)
+
+		buckets := make(map[float64]uint64, len(gpu.MaxMemoryBuckets))
+		for bound, count := range gpu.MaxMemoryBuckets {
+			buckets[float64(bound)] = count
+		}
+		m.accountedMaxMemory.Set(labels, gpu.Processes, float64(gpu.MaxMemoryBytes), buckets)
+
+		for _, process := range gpu.FinishedProcesses {
+			processLabels := withLabel(labels, "pid", strconv.Itoa(process.PID))
+			m.finishedSeconds.With(processLabels).Set(process.Seconds)
+			m.finishedGPUUtil.With(processLabels).Set(process.GPUUtilization)
+			m.finishedMemoryUtil.With(processLabels).Set(process.MemoryUtilization)
+			m.finishedMaxMemory.With(processLabels).Set(float64(process.MaxMemoryBytes))
+		}
+	}
+}
+
+// UpdateXIDErrors updates Xid error metrics.
+func (m *Metrics) UpdateXIDErrors(xidErrors []types.XIDErrors) {
+	m.xidErrors.Reset()
+	m.lastXID.Reset()
+
+	for _, gpu := range xidErrors {
+		labels := prometheus.Labels{
+			"hostname":   gpu.Hostname,
+			"gpu_id":     optionalID(gpu.GPUID),
+			"gpu_uuid":   gpu.GPUUUID,
+			"gpu_name":   gpu.GPUName,
+			"pci_bus_id": gpu.PCIBusID,
+		}
+
+		for xid, count := range gpu.Counts {
+			m.xidErrors.Set(withLabel(labels, "xid", strconv.Itoa(xid)), float64(count))
+		}
+		m.lastXID.With(labels).Set(float64(gpu.LastXID))
 	}
 }
 
@@ -154,19 +1360,66 @@ func (m *Metrics) UpdateProcesses(processes []types.GPUProcess) {
 	m.processGPUMemory.Reset()
 	m.processCPU.Reset()
 	m.processMemory.Reset()
+	m.processSM.Reset()
+	m.processMemoryBandwidth.Reset()
+	m.processEncoder.Reset()
+	m.processDecoder.Reset()
 
 	for _, process := range processes {
 		labels := prometheus.Labels{
-			"hostname":     process.Hostname,
-			"gpu_id":       strconv.Itoa(process.GPUID),
-			"pid":          strconv.Itoa(process.PID),
-			"process_name": process.ProcessName,
-			"user":         process.User,
-			"command":      process.Command,
+			"hostname":            process.Hostname,
+			"gpu_id":              optionalID(process.GPUID),
+			"gpu_uuid":            process.GPUUUID,
+			"gpu_instance_id":     optionalID(process.GPUInstanceID),
+			"compute_instance_id": optionalID(process.ComputeInstanceID),
+			"mig_profile":         process.MIGProfile,
+			"pid":                 strconv.Itoa(process.PID),
+			"process_name":        process.ProcessName,
+			"type":                process.Type,
+			"user":                process.User,
+			"command":             process.Command,
 		}
 
-		m.processGPUMemory.With(labels).Set(float64(process.UsedGPUMemory * 1024 * 1024))
+		m.processGPUMemory.With(labels).Set(float64(process.UsedGPUMemory))
 		m.processCPU.With(labels).Set(process.UsedCPU)
 		m.processMemory.With(labels).Set(process.UsedMemory)
+		if process.HasUtilization {
+			m.processSM.With(labels).Set(process.SMUtilization)
+			m.processMemoryBandwidth.With(labels).Set(process.MemoryUtilization)
+			m.processEncoder.With(labels).Set(process.EncoderUtilization)
+			m.processDecoder.With(labels).Set(process.DecoderUtilization)
+		}
+	}
+}
+
+// extend returns a copy of labels with extra label names appended.
+func extend(labels []string, extra ...string) []string {
+	return append(append([]string{}, labels...), extra...)
+}
+
+// withLabel returns a copy of labels with name set to value.
+func withLabel(labels prometheus.Labels, name, value string) prometheus.Labels {
+	result := make(prometheus.Labels, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// optionalID formats an ID or index that is -1 when unknown or not
+// applicable, using an empty label value for -1.
+func optionalID(id int) string {
+	if id < 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// boolToFloat converts a flag to a 0/1 gauge value.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,142 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nvidia-gpu-list-exporter/internal/collector"
+	"github.com/nvidia-gpu-list-exporter/internal/metrics"
+	"github.com/nvidia-gpu-list-exporter/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// collectFake runs one collection over a FakeSource, the way the exporter's
+// main loop does, and returns the registry the metrics were updated in.
+func collectFake(t *testing.T) *prometheus.Registry {
+	t.Helper()
+
+	c, err := collector.NewWithSource(types.CollectorConfig{HostnameOverride: "test"}, collector.NewFakeSource())
+	if err != nil {
+		t.Fatalf("NewWithSource: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	m := metrics.New()
+	registry := prometheus.NewPedanticRegistry()
+	if err := m.Register(registry); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	gpus, err := c.CollectGPUMetrics()
+	if err != nil {
+		t.Fatalf("CollectGPUMetrics: %v", err)
+	}
+	m.UpdateGPU(gpus)
+
+	migs, err := c.CollectMIGDevices()
+	if err != nil {
+		t.Fatalf("CollectMIGDevices: %v", err)
+	}
+	m.UpdateMIGDevices(migs)
+
+	vgpus, err := c.CollectVGPUs()
+	if err != nil {
+		t.Fatalf("CollectVGPUs: %v", err)
+	}
+	m.UpdateVGPUs(vgpus)
+
+	links, err := c.CollectNVLinks()
+	if err != nil {
+		t.Fatalf("CollectNVLinks: %v", err)
+	}
+	m.UpdateNVLinks(links)
+
+	topology, err := c.CollectTopology()
+	if err != nil {
+		t.Fatalf("CollectTopology: %v", err)
+	}
+	m.UpdateTopology(topology)
+
+	accounting, err := c.CollectAccountingStats()
+	if err != nil {
+		t.Fatalf("CollectAccountingStats: %v", err)
+	}
+	m.UpdateAccountingStats(accounting)
+
+	m.UpdateXIDErrors(c.CollectXIDErrors())
+
+	processes, err := c.CollectProcesses()
+	if err != nil {
+		t.Fatalf("CollectProcesses: %v", err)
+	}
+	m.UpdateProcesses(processes)
+
+	return registry
+}
+
+func TestUpdateFromFakeSource(t *testing.T) {
+	registry := collectFake(t)
+
+	expected := `
+# HELP nvidia_gpu_temperature_celsius GPU temperature in Celsius
+# TYPE nvidia_gpu_temperature_celsius gauge
+nvidia_gpu_temperature_celsius{gpu_id="0",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000000",hostname="test"} 45
+nvidia_gpu_temperature_celsius{gpu_id="1",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000001",hostname="test"} 38
+# HELP nvidia_gpu_mig_info MIG device identity and placement, always 1
+# TYPE nvidia_gpu_mig_info gauge
+nvidia_gpu_mig_info{compute_instance_id="0",gpu_id="1",gpu_instance_id="1",gpu_instance_profile_id="9",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000001",hostname="test",mig_index="0",mig_profile="3g.12gb",mig_uuid="MIG-00000000-0000-0000-0000-000000000010",placement_size="4",placement_start="0"} 1
+nvidia_gpu_mig_info{compute_instance_id="0",gpu_id="1",gpu_instance_id="2",gpu_instance_profile_id="9",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000001",hostname="test",mig_index="1",mig_profile="3g.12gb",mig_uuid="MIG-00000000-0000-0000-0000-000000000011",placement_size="4",placement_start="4"} 1
+# HELP nvidia_gpu_nvlink_active Whether the NVLink is active (1 = active)
+# TYPE nvidia_gpu_nvlink_active gauge
+nvidia_gpu_nvlink_active{gpu_id="0",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000000",hostname="test",link="0"} 1
+nvidia_gpu_nvlink_active{gpu_id="0",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000000",hostname="test",link="1"} 1
+nvidia_gpu_nvlink_active{gpu_id="1",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000001",hostname="test",link="0"} 1
+nvidia_gpu_nvlink_active{gpu_id="1",gpu_name="NVIDIA Fake GPU",gpu_uuid="GPU-00000000-0000-0000-0000-000000000001",hostname="test",link="1"} 0
+# HELP nvidia_gpu_topology_link Connection type between two GPUs as shown by nvidia-smi topo -m, always 1
+# TYPE nvidia_gpu_topology_link gauge
+nvidia_gpu_topology_link{gpu_a="0",gpu_b="1",hostname="test",type="NV2"} 1
+nvidia_gpu_topology_link{gpu_a="1",gpu_b="0",hostname="test",type="NV2"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"nvidia_gpu_temperature_celsius",
+		"nvidia_gpu_mig_info",
+		"nvidia_gpu_nvlink_active",
+		"nvidia_gpu_topology_link",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateFromFakeSourceFamilies(t *testing.T) {
+	registry := collectFake(t)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	gathered := make(map[string]bool)
+	for _, family := range families {
+		gathered[family.GetName()] = true
+	}
+
+	for _, name := range []string{
+		"nvidia_gpu_info",
+		"nvidia_gpu_clock_event_reason_active",
+		"nvidia_gpu_ecc_aggregate_errors_total",
+		"nvidia_gpu_mig_info",
+		"nvidia_gpu_vgpu_info",
+		"nvidia_gpu_nvlink_data_bytes_total",
+		"nvidia_gpu_topology_link",
+		"nvidia_gpu_topology_nic_link",
+		"nvidia_gpu_accounted_processes_total",
+		"nvidia_gpu_accounted_process_max_memory_bytes",
+		"nvidia_gpu_finished_process_max_memory_bytes",
+		"nvidia_gpu_process_gpu_memory_bytes",
+		"nvidia_gpu_process_sm_utilization_percent",
+	} {
+		if !gathered[name] {
+			t.Errorf("%s was not gathered", name)
+		}
+	}
+}
@@ -33,8 +33,11 @@ func Load() (*Config, error) {
 			MetricsUpdateInterval: 15,
 		},
 		Collector: types.CollectorConfig{
+			Source:           "nvidia-smi",
 			Timeout:          10 * time.Second,
 			NvidiaSmiPath:    "nvidia-smi",
+			ProcfsPath:       "/proc",
+			KmsgPath:         "/dev/kmsg",
 			HostnameOverride: "",
 		},
 	}
@@ -42,9 +45,14 @@ func Load() (*Config, error) {
 	flag.StringVar(&cfg.Server.Host, "host", cfg.Server.Host, "HTTP server host")
 	flag.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "HTTP server port")
 	flag.IntVar(&cfg.Server.MetricsUpdateInterval, "interval", cfg.Server.MetricsUpdateInterval, "Metrics update interval (seconds)")
+	flag.StringVar(&cfg.Collector.Source, "source", cfg.Collector.Source, "GPU data source (nvidia-smi, nvidia-smi-xml, nvml, fake)")
 	flag.DurationVar(&cfg.Collector.Timeout, "timeout", cfg.Collector.Timeout, "nvidia-smi command timeout")
 	flag.StringVar(&cfg.Collector.NvidiaSmiPath, "nvidia-smi-path", cfg.Collector.NvidiaSmiPath, "Path to nvidia-smi command")
+	flag.StringVar(&cfg.Collector.ProcfsPath, "procfs-path", cfg.Collector.ProcfsPath, "Path to procfs mount for process details")
+	flag.StringVar(&cfg.Collector.KmsgPath, "kmsg-path", cfg.Collector.KmsgPath, "Kernel log to read Xid errors from (empty to disable)")
 	flag.StringVar(&cfg.Collector.HostnameOverride, "hostname", cfg.Collector.HostnameOverride, "Hostname override")
+	flag.DurationVar(&cfg.Collector.StreamInterval, "stream-interval", cfg.Collector.StreamInterval, "Keep nvidia-smi running and sample GPUs at this interval (0 to run it per collection)")
+	flag.BoolVar(&cfg.Collector.DisablePCIeThroughput, "disable-pcie-throughput", cfg.Collector.DisablePCIeThroughput, "Do not sample PCIe throughput with nvidia-smi dmon, which adds about a second to each collection when not streaming")
 
 	if host := os.Getenv("EXPORTER_HOST"); host != "" {
 		cfg.Server.Host = host
@@ -59,6 +67,9 @@ func Load() (*Config, error) {
 			cfg.Server.MetricsUpdateInterval = i
 		}
 	}
+	if source := os.Getenv("EXPORTER_SOURCE"); source != "" {
+		cfg.Collector.Source = source
+	}
 	if timeout := os.Getenv("EXPORTER_TIMEOUT"); timeout != "" {
 		if d, err := time.ParseDuration(timeout); err == nil {
 			cfg.Collector.Timeout = d
@@ -67,9 +78,25 @@ func Load() (*Config, error) {
 	if path := os.Getenv("NVIDIA_SMI_PATH"); path != "" {
 		cfg.Collector.NvidiaSmiPath = path
 	}
+	if path := os.Getenv("PROCFS_PATH"); path != "" {
+		cfg.Collector.ProcfsPath = path
+	}
+	if path, ok := os.LookupEnv("KMSG_PATH"); ok {
+		cfg.Collector.KmsgPath = path
+	}
 	if hostname := os.Getenv("HOSTNAME_OVERRIDE"); hostname != "" {
 		cfg.Collector.HostnameOverride = hostname
 	}
+	if interval := os.Getenv("EXPORTER_STREAM_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			cfg.Collector.StreamInterval = d
+		}
+	}
+	if disable := os.Getenv("EXPORTER_DISABLE_PCIE_THROUGHPUT"); disable != "" {
+		if b, err := strconv.ParseBool(disable); err == nil {
+			cfg.Collector.DisablePCIeThroughput = b
+		}
+	}
 
 	flag.Parse()
 
@@ -82,6 +109,9 @@ func Load() (*Config, error) {
 	if cfg.Collector.Timeout <= 0 {
 		return nil, fmt.Errorf("invalid timeout: %v", cfg.Collector.Timeout)
 	}
+	if cfg.Collector.StreamInterval < 0 {
+		return nil, fmt.Errorf("invalid stream interval: %v", cfg.Collector.StreamInterval)
+	}
 
 	return cfg, nil
 }
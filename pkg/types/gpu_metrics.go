@@ -5,35 +5,289 @@ import "time"
 
 // GPUMetrics represents current metrics for a single GPU.
 type GPUMetrics struct {
-	Hostname          string    `json:"hostname"`
-	GPUID             int       `json:"gpu_id"`
-	Timestamp         time.Time `json:"timestamp"`
-	GPUName           string    `json:"gpu_name"`
-	Temperature       float64   `json:"temperature"`
-	FreeMemory        uint64    `json:"free_memory"`
-	UsedMemory        uint64    `json:"used_memory"`
-	TotalMemory       uint64    `json:"total_memory"`
-	GPUUtilization    float64   `json:"gpu_utilization"`
-	MemoryUtilization float64   `json:"memory_utilization"`
+	Hostname                      string            `json:"hostname"`
+	GPUID                         int               `json:"gpu_id"`
+	Timestamp                     time.Time         `json:"timestamp"`
+	GPUName                       string            `json:"gpu_name"`
+	UUID                          string            `json:"uuid"`
+	Serial                        string            `json:"serial"`
+	PCIBusID                      string            `json:"pci_bus_id"` // e.g. "00000000:3B:00.0"
+	VBIOSVersion                  string            `json:"vbios_version"`
+	DriverVersion                 string            `json:"driver_version"`
+	CUDAVersion                   string            `json:"cuda_version"` // highest CUDA version the driver supports
+	BoardPartNumber               string            `json:"board_part_number"`
+	Temperature                   float64           `json:"temperature"`
+	MemoryTemperature             float64           `json:"memory_temperature"`   // HBM temperature, 0 if not reported
+	ShutdownTemperature           float64           `json:"shutdown_temperature"` // thresholds are 0 if not reported
+	SlowdownTemperature           float64           `json:"slowdown_temperature"`
+	MaxOperatingTemperature       float64           `json:"max_operating_temperature"`
+	MemoryMaxOperatingTemperature float64           `json:"memory_max_operating_temperature"`
+	FreeMemory                    uint64            `json:"free_memory"`            // bytes
+	UsedMemory                    uint64            `json:"used_memory"`            // bytes
+	TotalMemory                   uint64            `json:"total_memory"`           // bytes
+	ReservedMemory                uint64            `json:"reserved_memory"`        // bytes, held by the driver and firmware
+	BAR1TotalMemory               uint64            `json:"bar1_total_memory"`      // bytes
+	BAR1UsedMemory                uint64            `json:"bar1_used_memory"`       // bytes
+	ProtectedTotalMemory          uint64            `json:"protected_total_memory"` // bytes, 0 unless confidential computing is enabled
+	ProtectedUsedMemory           uint64            `json:"protected_used_memory"`  // bytes
+	GPUUtilization                float64           `json:"gpu_utilization"`
+	MemoryUtilization             float64           `json:"memory_utilization"`
+	EncoderUtilization            float64           `json:"encoder_utilization"` // percent
+	DecoderUtilization            float64           `json:"decoder_utilization"` // percent
+	EncoderSessions               int               `json:"encoder_sessions"`
+	EncoderAverageFPS             float64           `json:"encoder_average_fps"`
+	EncoderAverageLatency         float64           `json:"encoder_average_latency"` // seconds
+	PowerDraw                     float64           `json:"power_draw"`              // watts
+	PowerLimit                    float64           `json:"power_limit"`             // watts
+	EnforcedPowerLimit            float64           `json:"enforced_power_limit"`    // watts
+	PowerMinLimit                 float64           `json:"power_min_limit"`         // watts
+	PowerMaxLimit                 float64           `json:"power_max_limit"`         // watts
+	PowerDefaultLimit             float64           `json:"power_default_limit"`     // watts
+	Clocks                        GPUClocks         `json:"clocks"`
+	MaxClocks                     GPUClocks         `json:"max_clocks"`
+	ApplicationClocks             GPUClocks         `json:"application_clocks"`
+	DefaultApplicationClocks      GPUClocks         `json:"default_application_clocks"`
+	ClockEventReasons             ClockEventReasons `json:"clock_event_reasons"`
+	ECCMode                       bool              `json:"ecc_mode"`
+	ECCCorrectedVolatile          ECCErrors         `json:"ecc_corrected_volatile"`
+	ECCUncorrectedVolatile        ECCErrors         `json:"ecc_uncorrected_volatile"`
+	ECCCorrectedAggregate         ECCErrors         `json:"ecc_corrected_aggregate"`
+	ECCUncorrectedAggregate       ECCErrors         `json:"ecc_uncorrected_aggregate"`
+	RetiredPagesSingleBit         uint64            `json:"retired_pages_single_bit"`
+	RetiredPagesDoubleBit         uint64            `json:"retired_pages_double_bit"`
+	RetiredPagesPending           bool              `json:"retired_pages_pending"`
+	RemappedRowsCorrectable       uint64            `json:"remapped_rows_correctable"`
+	RemappedRowsUncorrectable     uint64            `json:"remapped_rows_uncorrectable"`
+	RemappedRowsPending           bool              `json:"remapped_rows_pending"`
+	RemappedRowsFailure           bool              `json:"remapped_rows_failure"`
+	PCIeLinkGen                   int               `json:"pcie_link_gen"`
+	PCIeLinkGenMax                int               `json:"pcie_link_gen_max"`
+	PCIeLinkWidth                 int               `json:"pcie_link_width"`
+	PCIeLinkWidthMax              int               `json:"pcie_link_width_max"`
+	PCIeRxThroughput              float64           `json:"pcie_rx_throughput"` // bytes per second
+	PCIeTxThroughput              float64           `json:"pcie_tx_throughput"` // bytes per second
+	FanSpeed                      float64           `json:"fan_speed"`          // percent
+	PerformanceState              int               `json:"performance_state"`  // 0 (P0) to 15 (P15), -1 if unknown
+	ComputeMode                   string            `json:"compute_mode"`       // as reported by nvidia-smi, e.g. "Exclusive_Process"
+	PersistenceMode               bool              `json:"persistence_mode"`
+	DisplayActive                 bool              `json:"display_active"`
+	MIGMode                       bool              `json:"mig_mode"`
+	VirtualizationMode            string            `json:"virtualization_mode"` // e.g. "None", "Pass-Through" or "Host VGPU"
+	AccountingMode                bool              `json:"accounting_mode"`
+	Fabric                        GPUFabric         `json:"fabric"`
+}
+
+// GPUFabric is the state of a GPU's registration with the NVLink fabric,
+// as managed by the fabric manager on NVSwitch systems. Values are empty if
+// not reported.
+type GPUFabric struct {
+	State       string `json:"state"`  // e.g. "In Progress" or "Completed"
+	Status      string `json:"status"` // result of the registration, e.g. "Success"
+	CliqueID    string `json:"clique_id"`
+	ClusterUUID string `json:"cluster_uuid"`
+}
+
+// ECCErrors represents ECC error counts by memory location.
+// Locations a GPU does not report are zero.
+type ECCErrors struct {
+	DeviceMemory  uint64 `json:"device_memory"`
+	DRAM          uint64 `json:"dram"`
+	SRAM          uint64 `json:"sram"`
+	RegisterFile  uint64 `json:"register_file"`
+	L1Cache       uint64 `json:"l1_cache"`
+	L2Cache       uint64 `json:"l2_cache"`
+	TextureMemory uint64 `json:"texture_memory"`
+	CBU           uint64 `json:"cbu"`
+	Total         uint64 `json:"total"`
+}
+
+// GPUClocks represents the clock speeds of a GPU's clock domains in MHz.
+// Domains that a reading does not cover, such as video for maximum clocks, are zero.
+type GPUClocks struct {
+	Graphics float64 `json:"graphics"`
+	SM       float64 `json:"sm"`
+	Memory   float64 `json:"memory"`
+	Video    float64 `json:"video"`
+}
+
+// ClockEventReasons reports which reasons are currently holding GPU clocks
+// down. Older drivers call these clock throttle reasons.
+type ClockEventReasons struct {
+	GPUIdle                   bool `json:"gpu_idle"`
+	ApplicationsClocksSetting bool `json:"applications_clocks_setting"`
+	SWPowerCap                bool `json:"sw_power_cap"`
+	HWSlowdown                bool `json:"hw_slowdown"`
+	HWThermalSlowdown         bool `json:"hw_thermal_slowdown"`
+	HWPowerBrakeSlowdown      bool `json:"hw_power_brake_slowdown"`
+	SWThermalSlowdown         bool `json:"sw_thermal_slowdown"`
+	SyncBoost                 bool `json:"sync_boost"`
+}
+
+// MIGDevice represents a MIG device, i.e. a compute instance within a GPU
+// instance of a GPU in MIG mode.
+type MIGDevice struct {
+	Hostname             string `json:"hostname"`
+	GPUID                int    `json:"gpu_id"`   // index of the parent GPU
+	GPUUUID              string `json:"gpu_uuid"` // UUID of the parent GPU
+	GPUName              string `json:"gpu_name"`
+	UUID                 string `json:"uuid"` // MIG device UUID, e.g. "MIG-..."
+	Index                int    `json:"index"`
+	Profile              string `json:"profile"` // e.g. "3g.40gb"
+	GPUInstanceID        int    `json:"gpu_instance_id"`
+	ComputeInstanceID    int    `json:"compute_instance_id"`
+	GPUInstanceProfileID int    `json:"gpu_instance_profile_id"` // -1 if unknown
+	PlacementStart       int    `json:"placement_start"`         // memory slice offset, -1 if unknown
+	PlacementSize        int    `json:"placement_size"`          // memory slices, -1 if unknown
+	TotalMemory          uint64 `json:"total_memory"`            // bytes, shared by the GPU instance's compute instances
+	UsedMemory           uint64 `json:"used_memory"`             // bytes
+	FreeMemory           uint64 `json:"free_memory"`             // bytes
+}
+
+// NVLink represents one NVLink of a GPU.
+type NVLink struct {
+	Hostname        string            `json:"hostname"`
+	GPUID           int               `json:"gpu_id"`
+	GPUUUID         string            `json:"gpu_uuid"`
+	GPUName         string            `json:"gpu_name"`
+	Link            int               `json:"link"`
+	Active          bool              `json:"active"`
+	Speed           float64           `json:"speed"`    // bytes per second, 0 if inactive
+	TxBytes         uint64            `json:"tx_bytes"` // since the driver was loaded or counters were reset
+	RxBytes         uint64            `json:"rx_bytes"`
+	HasDataCounters bool              `json:"has_data_counters"` // whether TxBytes and RxBytes could be read
+	Errors          map[string]uint64 `json:"errors"`            // by error type, e.g. "crc", "replay", "recovery"
+}
+
+// Topology describes how the GPUs of a host connect to each other, to NICs
+// and to CPUs, as shown by nvidia-smi topo -m.
+type Topology struct {
+	Hostname string        `json:"hostname"`
+	GPUs     []TopologyGPU `json:"gpus"`
+	NICs     []TopologyNIC `json:"nics"`
+}
+
+// TopologyGPU is a GPU in a Topology. Link types are those of nvidia-smi
+// topo -m: "NV#" for # bonded NVLinks, or the PCIe path "PIX", "PXB",
+// "PHB", "NODE" or "SYS", from nearest to farthest.
+type TopologyGPU struct {
+	GPUID        int               `json:"gpu_id"`
+	GPUUUID      string            `json:"gpu_uuid"`
+	GPUName      string            `json:"gpu_name"`
+	CPUAffinity  string            `json:"cpu_affinity"`  // CPU list, e.g. "0-31,64-95"; empty if unknown
+	NUMAAffinity string            `json:"numa_affinity"` // NUMA node list, e.g. "0"; empty if unknown
+	GPUNUMAID    int               `json:"gpu_numa_id"`   // NUMA node of the GPU's own memory, -1 if none
+	GPULinks     map[int]string    `json:"gpu_links"`     // link type by peer GPU index
+	NICLinks     map[string]string `json:"nic_links"`     // link type by NIC name
+}
+
+// TopologyNIC is a network interface in a Topology.
+type TopologyNIC struct {
+	Name   string `json:"name"`   // e.g. "NIC0"
+	Device string `json:"device"` // e.g. "mlx5_0"
+}
+
+// VGPU represents an active vGPU instance on a vGPU host.
+type VGPU struct {
+	Hostname              string  `json:"hostname"`
+	GPUID                 int     `json:"gpu_id"`   // index of the physical GPU
+	GPUUUID               string  `json:"gpu_uuid"` // UUID of the physical GPU
+	GPUName               string  `json:"gpu_name"`
+	ID                    string  `json:"id"` // vGPU ID as shown by nvidia-smi vgpu
+	UUID                  string  `json:"uuid"`
+	TypeName              string  `json:"type_name"` // e.g. "GRID A100-4C"
+	VMName                string  `json:"vm_name"`
+	VMUUID                string  `json:"vm_uuid"`
+	GuestDriverVersion    string  `json:"guest_driver_version"` // empty if not reported
+	LicenseStatus         string  `json:"license_status"`       // e.g. "Licensed (Expiry: ...)"
+	GPUInstanceID         int     `json:"gpu_instance_id"`      // -1 unless the vGPU is backed by a MIG instance
+	TotalMemory           uint64  `json:"total_memory"`         // bytes
+	UsedMemory            uint64  `json:"used_memory"`          // bytes
+	FreeMemory            uint64  `json:"free_memory"`          // bytes
+	GPUUtilization        float64 `json:"gpu_utilization"`      // percent
+	MemoryUtilization     float64 `json:"memory_utilization"`   // percent
+	EncoderUtilization    float64 `json:"encoder_utilization"`  // percent
+	DecoderUtilization    float64 `json:"decoder_utilization"`  // percent
+	EncoderSessions       int     `json:"encoder_sessions"`
+	EncoderAverageFPS     float64 `json:"encoder_average_fps"`
+	EncoderAverageLatency float64 `json:"encoder_average_latency"` // seconds
+}
+
+// AccountingStats accumulates the accounting statistics of the processes
+// that finished on one GPU since the exporter started. Each process is
+// counted once.
+type AccountingStats struct {
+	Hostname          string            `json:"hostname"`
+	GPUID             int               `json:"gpu_id"` // -1 if the GPU is not known
+	GPUUUID           string            `json:"gpu_uuid"`
+	GPUName           string            `json:"gpu_name"`
+	Processes         uint64            `json:"processes"`
+	Seconds           float64           `json:"seconds"`             // total run time
+	GPUBusySeconds    float64           `json:"gpu_busy_seconds"`    // run time weighted by average GPU utilization
+	MemoryBusySeconds float64           `json:"memory_busy_seconds"` // run time weighted by average memory utilization
+	MaxMemoryBytes    uint64            `json:"max_memory_bytes"`    // sum of each process's peak memory usage
+	MaxMemoryBuckets  map[uint64]uint64 `json:"max_memory_buckets"`  // processes whose peak memory usage was at most each bound in bytes
+
+	FinishedProcesses []AccountedProcess `json:"finished_processes"` // processes counted recently, each for a limited time
+}
+
+// AccountedProcess holds the accounting statistics of one finished process.
+type AccountedProcess struct {
+	PID               int     `json:"pid"`
+	Seconds           float64 `json:"seconds"`            // run time
+	GPUUtilization    float64 `json:"gpu_utilization"`    // percent, averaged over the run time
+	MemoryUtilization float64 `json:"memory_utilization"` // percent, averaged over the run time
+	MaxMemoryBytes    uint64  `json:"max_memory_bytes"`   // peak memory usage
 }
 
 // GPUProcess represents information about a process running on GPU.
 type GPUProcess struct {
 	Hostname      string    `json:"hostname"`
-	GPUID         int       `json:"gpu_id"`
+	GPUID         int       `json:"gpu_id"` // -1 if the GPU is not known
+	GPUUUID       string    `json:"gpu_uuid"`
 	Timestamp     time.Time `json:"timestamp"`
 	User          string    `json:"user"`
 	PID           int       `json:"pid"`
 	ProcessName   string    `json:"process_name"`
-	UsedGPUMemory uint64    `json:"used_gpu_memory"` // MiB
+	Type          string    `json:"type"`            // "compute", "graphics", "mps_server" or "mps_client"
+	UsedGPUMemory uint64    `json:"used_gpu_memory"` // bytes
 	UsedCPU       float64   `json:"used_cpu"`
 	UsedMemory    float64   `json:"used_memory"`
 	Command       string    `json:"command"`
+
+	// MIG device the process runs on; instance IDs are -1 if it is not on one
+	GPUInstanceID     int    `json:"gpu_instance_id"`
+	ComputeInstanceID int    `json:"compute_instance_id"`
+	MIGProfile        string `json:"mig_profile"`
+
+	// GPU engine utilization by the process in percent, set only if HasUtilization
+	SMUtilization      float64 `json:"sm_utilization"`
+	MemoryUtilization  float64 `json:"memory_utilization"` // memory bandwidth
+	EncoderUtilization float64 `json:"encoder_utilization"`
+	DecoderUtilization float64 `json:"decoder_utilization"`
+	HasUtilization     bool    `json:"has_utilization"`
+}
+
+// XIDErrors summarizes the Xid errors the NVIDIA driver logged for one GPU.
+type XIDErrors struct {
+	Hostname string         `json:"hostname"`
+	GPUID    int            `json:"gpu_id"` // -1 if the GPU is not known
+	GPUUUID  string         `json:"gpu_uuid"`
+	GPUName  string         `json:"gpu_name"`
+	PCIBusID string         `json:"pci_bus_id"`
+	Counts   map[int]uint64 `json:"counts"` // by Xid code
+	LastXID  int            `json:"last_xid"`
+	LastPID  int            `json:"last_pid"` // 0 if the driver did not report one
 }
 
 // CollectorConfig represents GPU metrics collection configuration.
 type CollectorConfig struct {
+	Source           string        `json:"source"`
 	Timeout          time.Duration `json:"timeout"`
 	NvidiaSmiPath    string        `json:"nvidia_smi_path"`
+	ProcfsPath       string        `json:"procfs_path"`
+	KmsgPath         string        `json:"kmsg_path"` // kernel log to read Xid errors from, empty to disable
 	HostnameOverride string        `json:"hostname_override"`
+	StreamInterval   time.Duration `json:"stream_interval"` // sampling interval of a long-running nvidia-smi, 0 to run it per collection
+
+	DisablePCIeThroughput bool `json:"disable_pcie_throughput"` // leave PCIe throughput unset rather than sample it with dmon per collection
 }